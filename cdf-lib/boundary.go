@@ -0,0 +1,326 @@
+package cdf
+
+import (
+	"crypto/dsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// boundaryKey is a key pair of boundary value, given to the programs as
+// fixed-width hex arguments, many of its bytes being zero
+type boundaryKey struct {
+	name      string
+	priv, pub []string // the arguments of signing and of verification
+}
+
+// boundarySig is a signature by the key of Config, with a boundary nonce or
+// leading zero bytes, which the verifiers must accept
+type boundarySig struct {
+	name string
+	r, s *big.Int
+}
+
+// boundaryScalars returns the private keys, or nonces, 1, 2, n-1 and n-2, and
+// a random one of half the size of n, whose leading half is zero, along with
+// their names, n being named order
+func boundaryScalars(n *big.Int, order string) ([]string, []*big.Int, error) {
+	one, two := big.NewInt(1), big.NewInt(2)
+	small, err := cryptoScalar(new(big.Int).Lsh(one, uint(n.BitLen()/2)))
+	if err != nil {
+		return nil, nil, err
+	}
+	return []string{"1", "2", order + "-1", order + "-2", "with leading zero bytes"},
+		[]*big.Int{one, two, new(big.Int).Sub(n, one), new(big.Int).Sub(n, two), small}, nil
+}
+
+// leadingZero tells whether v has a zero first byte once padded to size
+func leadingZero(v *big.Int, size int) bool {
+	return v.BitLen() <= 8*(size-1)
+}
+
+// signWithNonce returns the ECDSA signature of the digest by d with the
+// nonce k, if neither r nor s is zero
+func (c *ecCurve) signWithNonce(d, k *big.Int, digest []byte) (r, s *big.Int, ok bool) {
+	rx, _ := c.baseMult(k)
+	r = rx.Mod(rx, c.n)
+	s = new(big.Int).Mul(r, d)
+	s.Add(s, c.hashToInt(digest)).Mul(s, new(big.Int).ModInverse(k, c.n)).Mod(s, c.n)
+	return r, s, r.Sign() != 0 && s.Sign() != 0
+}
+
+// ecdsaBoundaryKeys returns the boundaryKeys of curve: the private keys of
+// boundaryScalars, and the ones whose public x or y has a leading zero byte
+func ecdsaBoundaryKeys(curve *ecCurve) ([]boundaryKey, error) {
+	size, orderSize := curve.byteLen(), curve.orderLen()
+	key := func(name string, d, x, y *big.Int) boundaryKey {
+		px, py := hex.EncodeToString(padTo(x.Bytes(), size)), hex.EncodeToString(padTo(y.Bytes(), size))
+		return boundaryKey{name: name, pub: []string{px, py},
+			priv: []string{px, py, hex.EncodeToString(padTo(d.Bytes(), orderSize))}}
+	}
+	names, scalars, err := boundaryScalars(curve.n, "n")
+	if err != nil {
+		return nil, err
+	}
+	var keys []boundaryKey
+	for i, d := range scalars {
+		x, y := curve.baseMult(d)
+		keys = append(keys, key("d = "+names[i], d, x, y))
+	}
+	for coord := 0; coord < 2; coord++ {
+		for i := 0; i < 4096; i++ {
+			d, err := cryptoScalar(curve.n)
+			if err != nil {
+				return nil, err
+			}
+			x, y := curve.baseMult(d)
+			if leadingZero([]*big.Int{x, y}[coord], size) {
+				keys = append(keys, key([]string{"x", "y"}[coord]+" with a leading zero byte", d, x, y))
+				break
+			}
+		}
+	}
+	return keys, nil
+}
+
+// ecdsaBoundarySigs returns the boundarySigs of the digest by d on curve: the
+// ones of the nonces of boundaryScalars, and ones whose r or s has a leading
+// zero byte
+func ecdsaBoundarySigs(curve *ecCurve, d *big.Int, digest []byte) ([]boundarySig, error) {
+	names, nonces, err := boundaryScalars(curve.n, "n")
+	if err != nil {
+		return nil, err
+	}
+	var sigs []boundarySig
+	for i, k := range nonces {
+		if r, s, ok := curve.signWithNonce(d, k, digest); ok {
+			sigs = append(sigs, boundarySig{"k = " + names[i], r, s})
+		}
+	}
+	size := curve.orderLen()
+	for coord := 0; coord < 2; coord++ {
+		for i := 0; i < 4096; i++ {
+			k, err := cryptoScalar(curve.n)
+			if err != nil {
+				return nil, err
+			}
+			r, s, ok := curve.signWithNonce(d, k, digest)
+			if ok && leadingZero([]*big.Int{r, s}[coord], size) {
+				sigs = append(sigs, boundarySig{[]string{"r", "s"}[coord] + " with a leading zero byte", r, s})
+				break
+			}
+		}
+	}
+	return sigs, nil
+}
+
+// dsaSignWithNonce returns the DSA signature of the digest, truncated to the
+// byte length of Q, by priv with the nonce k, if neither r nor s is zero
+func dsaSignWithNonce(priv *dsa.PrivateKey, k *big.Int, digest []byte) (r, s *big.Int, ok bool) {
+	q := priv.Q
+	if size := (q.BitLen() + 7) / 8; len(digest) > size {
+		digest = digest[:size]
+	}
+	r = new(big.Int).Exp(priv.G, k, priv.P)
+	r.Mod(r, q)
+	s = new(big.Int).Mul(r, priv.X)
+	s.Add(s, new(big.Int).SetBytes(digest)).Mul(s, new(big.Int).ModInverse(k, q)).Mod(s, q)
+	return r, s, r.Sign() != 0 && s.Sign() != 0
+}
+
+// configDsaKey returns the DSA key of Config
+func configDsaKey() *dsa.PrivateKey {
+	ints, _ := parseHex(Config.DsaP, Config.DsaQ, Config.DsaG, Config.DsaY, Config.DsaX)
+	return &dsa.PrivateKey{PublicKey: dsa.PublicKey{
+		Parameters: dsa.Parameters{P: ints[0], Q: ints[1], G: ints[2]}, Y: ints[3]}, X: ints[4]}
+}
+
+// dsaBoundaryKeys returns the boundaryKeys of the parameters of Config: the
+// private keys of boundaryScalars, and one whose Y has a leading zero byte
+func dsaBoundaryKeys(params dsa.Parameters) ([]boundaryKey, error) {
+	size, orderSize := (params.P.BitLen()+7)/8, (params.Q.BitLen()+7)/8
+	key := func(name string, x *big.Int) boundaryKey {
+		y := hex.EncodeToString(padTo(new(big.Int).Exp(params.G, x, params.P).Bytes(), size))
+		pub := []string{Config.DsaP, Config.DsaQ, Config.DsaG, y}
+		return boundaryKey{name: name, pub: pub, priv: withArgs(pub, hex.EncodeToString(padTo(x.Bytes(), orderSize)))}
+	}
+	names, scalars, err := boundaryScalars(params.Q, "q")
+	if err != nil {
+		return nil, err
+	}
+	var keys []boundaryKey
+	for i, x := range scalars {
+		keys = append(keys, key("x = "+names[i], x))
+	}
+	for i := 0; i < 4096; i++ {
+		x, err := cryptoScalar(params.Q)
+		if err != nil {
+			return nil, err
+		}
+		if leadingZero(new(big.Int).Exp(params.G, x, params.P), size) {
+			keys = append(keys, key("y with a leading zero byte", x))
+			break
+		}
+	}
+	return keys, nil
+}
+
+// dsaBoundarySigs returns the boundarySigs of the digest by priv, as
+// ecdsaBoundarySigs does
+func dsaBoundarySigs(priv *dsa.PrivateKey, digest []byte) ([]boundarySig, error) {
+	names, nonces, err := boundaryScalars(priv.Q, "q")
+	if err != nil {
+		return nil, err
+	}
+	var sigs []boundarySig
+	for i, k := range nonces {
+		if r, s, ok := dsaSignWithNonce(priv, k, digest); ok {
+			sigs = append(sigs, boundarySig{"k = " + names[i], r, s})
+		}
+	}
+	size := (priv.Q.BitLen() + 7) / 8
+	for coord := 0; coord < 2; coord++ {
+		for i := 0; i < 4096; i++ {
+			k, err := cryptoScalar(priv.Q)
+			if err != nil {
+				return nil, err
+			}
+			r, s, ok := dsaSignWithNonce(priv, k, digest)
+			if ok && leadingZero([]*big.Int{r, s}[coord], size) {
+				sigs = append(sigs, boundarySig{[]string{"r", "s"}[coord] + " with a leading zero byte", r, s})
+				break
+			}
+		}
+	}
+	return sigs, nil
+}
+
+// testBoundary has each program sign msg with the boundaryKeys, the other
+// one verifying the signatures, and gives both verifiers the boundarySigs
+// under pub, with fixed-width r and s of size bytes and without their leading
+// zeros. The verdicts are checked by the oracle, with vector building the test
+// vectors of the signatures: a failure to sign, or a disagreement, is a
+// finding.
+func testBoundary(test string, keys []boundaryKey, sigs []boundarySig, pub []string, size int, msg string,
+	vector func(pub []string, r, s, comment string, flags ...string) (testVector, bool)) error {
+	LogInfo.Printf("testing %d boundary keys and %d signatures with boundary nonces or leading zeros.\n",
+		len(keys), len(sigs))
+	progs := []string{Prog1, Prog2}
+	jobs := newJobGroup(test, len(progs))
+	for i := range progs {
+		prog, other := progs[i], progs[1-i]
+		jobs.Go(func() error {
+			var mainErr MultiError
+			signer, verifier := prog, other
+			for _, k := range keys {
+				id := test + "#" + k.name + "_" + signer
+				argsSign := withArgs(k.priv, msg)
+				out, err := runProg(signer, id, argsSign)
+				r, s, ok := splitSignature(out)
+				if err != nil || !ok {
+					LogError.Printf("%s failed to sign with the key %s: %s\n", signer, k.name, out)
+					addFinding(Finding{Test: test, Progs: []string{signer}, Inputs: argsSign,
+						Message: "failed to sign with the key " + k.name})
+					mainErr = append(mainErr, fmt.Errorf("%s failed to sign with the key %s", signer, k.name))
+					continue
+				}
+				res, err := runProg(verifier, id, withArgs(k.pub, r, s, msg))
+				accepted := err == nil && res == trueStr
+				v, vok := vector(k.pub, r, s, "signature by "+signer+" with the key "+k.name)
+				if note := oracleSignature(v, vok, signer, verifier, accepted); note != "" || !accepted {
+					verdict := "rejected"
+					if accepted {
+						verdict = "accepted"
+					}
+					LogError.Printf("%s %s the signature by %s with the key %s. %s\n", verifier, verdict, signer, k.name, note)
+					addFinding(Finding{Test: test, Progs: []string{signer, verifier}, Inputs: argsSign,
+						Message: "signature with the key " + k.name + " not verified consistently", Oracle: note})
+					v.test.Comment = verifier + " disagreed on the " + v.test.Comment
+					v.test.Flags = []string{"Mismatch"}
+					addVector(v, vok)
+					mainErr = append(mainErr, fmt.Errorf("%s and %s disagree on a signature with the key %s",
+						signer, verifier, k.name))
+					continue
+				}
+				v.test.Flags = []string{"Generated"}
+				addGeneratedVector(v, vok)
+			}
+
+			for _, sig := range sigs {
+				for _, width := range []int{size, 1} {
+					r, s := hex.EncodeToString(padTo(sig.r.Bytes(), width)), hex.EncodeToString(padTo(sig.s.Bytes(), width))
+					name := sig.name
+					if width == 1 {
+						name += ", without leading zeros"
+					}
+					argsP := withArgs(pub, r, s, msg)
+					res, err := runProg(prog, test+"#"+name+"_"+prog, argsP)
+					if err == nil && res == trueStr {
+						continue
+					}
+					LogError.Printf("%s rejected a valid signature with %s.\n", prog, name)
+					addFinding(Finding{Test: test, Progs: []string{prog}, Inputs: argsP,
+						Message: "rejected a valid signature with " + name})
+					addVector(vector(pub, r, s, prog+" rejected a valid signature with "+name))
+					mainErr = append(mainErr, fmt.Errorf("%s rejected a valid signature with %s", prog, name))
+				}
+			}
+			if len(mainErr) > 0 {
+				return mainErr
+			}
+			LogSuccess.Printf("%s signed with the boundary keys and verified the boundary signatures.\n", prog)
+			return nil
+		})
+	}
+	return jobs.Wait()
+}
+
+// testEcdsaBoundary runs testBoundary on the curve of the key of Config
+func testEcdsaBoundary() error {
+	curve, ok := keyCurve()
+	if !ok {
+		return errors.New("the ECDSA key is not on a known curve")
+	}
+	msg := "DEADC0DE"
+	hashed, ok := digest(msg)
+	if !ok {
+		return fmt.Errorf("unsupported hash %s", hashName())
+	}
+	keys, err := ecdsaBoundaryKeys(curve)
+	if err != nil {
+		return err
+	}
+	d, _ := parseHex(Config.EcdsaD)
+	sigs, err := ecdsaBoundarySigs(curve, d[0], hashed)
+	if err != nil {
+		return err
+	}
+	return testBoundary("ecdsa.boundary", keys, sigs, []string{Config.EcdsaX, Config.EcdsaY}, curve.orderLen(), msg,
+		func(pub []string, r, s, comment string, flags ...string) (testVector, bool) {
+			return ecdsaVector(pub[0], pub[1], r, s, msg, "", comment, flags...)
+		})
+}
+
+// testDsaBoundary runs testBoundary on the parameters of Config
+func testDsaBoundary() error {
+	msg := "DEADC0DE"
+	hashed, ok := digest(msg)
+	if !ok {
+		return fmt.Errorf("unsupported hash %s", hashName())
+	}
+	priv := configDsaKey()
+	keys, err := dsaBoundaryKeys(priv.Parameters)
+	if err != nil {
+		return err
+	}
+	sigs, err := dsaBoundarySigs(priv, hashed)
+	if err != nil {
+		return err
+	}
+	pub := []string{Config.DsaP, Config.DsaQ, Config.DsaG, Config.DsaY}
+	return testBoundary("dsa.boundary", keys, sigs, pub, (priv.Q.BitLen()+7)/8, msg,
+		func(pub []string, r, s, comment string, flags ...string) (testVector, bool) {
+			return dsaVector(pub[0], pub[1], pub[2], pub[3], r, s, msg, "", comment, flags...)
+		})
+}
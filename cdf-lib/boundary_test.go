@@ -0,0 +1,112 @@
+package cdf
+
+import (
+	"crypto/dsa"
+	"crypto/sha256"
+	"strings"
+	"testing"
+)
+
+func TestEcdsaBoundaryValues(t *testing.T) {
+	initForTesting("ECDSA")
+	digest := sha256.Sum256([]byte{0xde, 0xad, 0xc0, 0xde})
+	for _, name := range []string{"secp256r1", "secp384r1", "secp521r1"} {
+		curve, _ := curveByName(name)
+		keys, err := ecdsaBoundaryKeys(curve)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(keys) != 7 {
+			t.Errorf("%s: expected 7 keys, got %d", name, len(keys))
+		}
+		for _, k := range keys {
+			ints, _ := parseHex(k.priv...)
+			if x, y := curve.baseMult(ints[2]); x.Cmp(ints[0]) != 0 || y.Cmp(ints[1]) != 0 {
+				t.Errorf("%s: the public key %s does not match its private key", name, k.name)
+			}
+			if strings.HasPrefix(k.name, "x ") && !strings.HasPrefix(k.pub[0], "00") ||
+				strings.HasPrefix(k.name, "y ") && !strings.HasPrefix(k.pub[1], "00") {
+				t.Errorf("%s: no leading zero byte in the key %s: %v", name, k.name, k.pub)
+			}
+		}
+
+		d := randomScalar(Prng, curve.n)
+		x, y := curve.baseMult(d)
+		sigs, err := ecdsaBoundarySigs(curve, d, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sigs) != 7 {
+			t.Errorf("%s: expected 7 signatures, got %d", name, len(sigs))
+		}
+		for _, sig := range sigs {
+			if !curve.verify(x, y, digest[:], sig.r, sig.s) {
+				t.Errorf("%s: the signature with %s is invalid", name, sig.name)
+			}
+		}
+	}
+}
+
+func TestDsaBoundaryValues(t *testing.T) {
+	initForTesting("DSA")
+	digest := sha256.Sum256([]byte{0xde, 0xad, 0xc0, 0xde})
+	priv := configDsaKey()
+	keys, err := dsaBoundaryKeys(priv.Parameters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 6 || keys[5].name != "y with a leading zero byte" || !strings.HasPrefix(keys[5].pub[3], "00") {
+		t.Errorf("Unexpected keys %v", keys)
+	}
+	sigs, err := dsaBoundarySigs(priv, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sigs) != 7 {
+		t.Errorf("Expected 7 signatures, got %d", len(sigs))
+	}
+	for _, sig := range sigs {
+		if !dsa.Verify(&priv.PublicKey, digest[:(priv.Q.BitLen()+7)/8], sig.r, sig.s) {
+			t.Errorf("The signature with %s is invalid", sig.name)
+		}
+	}
+}
+
+func TestBoundary(t *testing.T) {
+	for _, interf := range []string{"ecdsa", "dsa"} {
+		// both signature encodings
+		withBuiltins(t, interf, Builtins(interf)[0], Builtins(interf)[1])
+		test := testEcdsaBoundary
+		if interf == "dsa" {
+			test = testDsaBoundary
+		}
+		if err := test(); err != nil {
+			t.Errorf("%s: %v", interf, err)
+		}
+	}
+}
+
+// fixedWidthEcdsa is builtin:ecdsa-p256-sha256 rejecting the signatures whose
+// r or s is not given on 32 bytes
+func fixedWidthEcdsa(args []string) (string, error) {
+	if len(args) == 5 && (len(args[2]) != 64 || len(args[3]) != 64) {
+		return "false", nil
+	}
+	return builtinEcdsa(args)
+}
+
+func TestBoundaryFixedWidth(t *testing.T) {
+	fixed := registerBuiltin(t, "ecdsa-fixed-width", "ecdsa-p256-sha256", fixedWidthEcdsa)
+	withBuiltins(t, "ecdsa", fixed, "builtin:ecdsa-p256-sha256")
+	if err := testEcdsaBoundary(); err == nil {
+		t.Fatal("Expected the signatures without leading zeros to be rejected")
+	}
+	for _, name := range []string{"r", "s"} {
+		if !hasFinding(fixed, "rejected a valid signature with "+name+" with a leading zero byte, without leading zeros") {
+			t.Errorf("Expected a finding on the %s without leading zeros, got %v", name, Findings())
+		}
+	}
+	if hasFinding(fixed, "rejected a valid signature with r with a leading zero byte") {
+		t.Error("The signature with leading zeros was reported")
+	}
+}
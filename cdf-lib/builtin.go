@@ -0,0 +1,463 @@
+package cdf
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/dsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// builtinPrefix is the prefix of the programs implemented by cdf itself, to
+// be given in place of a path, e.g. builtin:sha256
+const builtinPrefix = "builtin:"
+
+// builtin is a reference implementation of an interface, using the Go crypto
+// packages. It takes the same arguments as the tested programs and returns
+// their expected output.
+type builtin struct {
+	interf string
+	run    func(args []string) (string, error)
+}
+
+// builtins are the reference programs, by name
+var builtins = map[string]builtin{
+	"aes-ctr":               {"enc", builtinAesCtr},
+	"hmac-sha256":           {"prf", builtinHmacSha256},
+	"sha256":                {"xof", builtinSha256},
+	"rsa-oaep-sha256":       {"rsaenc", builtinRsaOaep},
+	"rsa-pkcs1-sha256":      {"rsasign", builtinRsaPkcs1},
+	"ecdsa-p256-sha256":     {"ecdsa", builtinEcdsa},
+	"ecdsa-p256-sha256-der": {"ecdsa", builtinDER(builtinEcdsa)},
+	"dsa":                   {"dsa", builtinDsa},
+	"dsa-der":               {"dsa", builtinDER(builtinDsa)},
+}
+
+// Builtins returns the names of the built-in programs of the given interface,
+// to be used as builtin:name, or of all interfaces if interf is empty
+func Builtins(interf string) []string {
+	var names []string
+	for name, b := range builtins {
+		if interf == "" || b.interf == interf {
+			names = append(names, builtinPrefix+name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CheckProgram checks that prog is either an existing file or a built-in
+// program
+func CheckProgram(prog string) error {
+	if !strings.HasPrefix(prog, builtinPrefix) {
+		if _, err := os.Stat(prog); os.IsNotExist(err) {
+			return fmt.Errorf("this file doesn't exist: %s", prog)
+		}
+		return nil
+	}
+	if _, ok := builtins[strings.TrimPrefix(prog, builtinPrefix)]; !ok {
+		return fmt.Errorf("unknown built-in program %s, expected one of %s", prog,
+			strings.Join(Builtins(""), ", "))
+	}
+	return nil
+}
+
+// runBuiltin runs a built-in program in-process, as runProg would run an
+// executable: it waits for an execution slot, honours the timeout, and panics
+// are reported as errors. Unlike a process, the computation cannot be killed:
+// on timeout it keeps running, and holding its slot, until it returns.
+func runBuiltin(prog, runID string, args []string) (string, error) {
+	LogToFile.Println(strings.Join(append([]string{"Batch#", runID,
+		"Attempting :", prog}, args...), " "))
+	b := builtins[strings.TrimPrefix(prog, builtinPrefix)]
+	if b.run == nil {
+		return "", fmt.Errorf("unknown built-in program %s", prog)
+	}
+
+	type result struct {
+		out string
+		err error
+	}
+	done := make(chan result, 1)
+	// we wait for an execution slot, to honour Config.Concurrency globally
+	release := acquireSlot()
+	go func() {
+		defer release()
+		defer func() {
+			if r := recover(); r != nil {
+				done <- result{err: fmt.Errorf("%s panicked: %v", prog, r)}
+			}
+		}()
+		out, err := b.run(args)
+		done <- result{out, err}
+	}()
+
+	timeout, baseline := timeoutFor(prog)
+	select {
+	case res := <-done:
+		if res.err != nil {
+			LogToFile.Println("Error on batch#", runID, "with", prog)
+			LogToFile.Println("Program returned:", res.err)
+			// like a failing program, the error is part of the output
+			return strings.ToLower(res.err.Error()), res.err
+		}
+		LogToFile.Println("Batch#", runID, prog,
+			"runned successfully, it returned: ", res.out)
+		return strings.ToLower(strings.TrimSpace(res.out)), nil
+	case <-time.After(timeout):
+		return "", hangError{prog: prog, timeout: timeout, baseline: baseline}
+	}
+}
+
+// builtinHashFlag removes the optional -h flag from the arguments, returning
+// the digest it sets, if any
+func builtinHashFlag(args []string) ([]string, []byte, error) {
+	if len(args) < 2 || args[0] != "-h" {
+		return args, nil, nil
+	}
+	digest, err := hex.DecodeString(args[1])
+	return args[2:], digest, err
+}
+
+// builtinHash removes the optional -H flag from the arguments, returning the
+// hash it selects, SHA-256 by default
+func builtinHash(args []string) ([]string, crypto.Hash, error) {
+	if len(args) < 2 || args[0] != hashFlag {
+		return args, crypto.SHA256, nil
+	}
+	for _, h := range cavpHashes {
+		if strings.EqualFold(h.name, args[1]) && h.hash.Available() {
+			return args[2:], h.hash, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("unsupported hash %s", args[1])
+}
+
+// builtinDigest hashes the hex encoded message with h
+func builtinDigest(h crypto.Hash, msg string) ([]byte, error) {
+	m, err := hex.DecodeString(msg)
+	if err != nil {
+		return nil, err
+	}
+	hasher := h.New()
+	hasher.Write(m)
+	return hasher.Sum(nil), nil
+}
+
+// builtinInts parses the hex arguments as integers
+func builtinInts(args ...string) ([]*big.Int, error) {
+	ints, ok := parseHex(args...)
+	if !ok {
+		return nil, errors.New("invalid hex integer argument")
+	}
+	return ints, nil
+}
+
+// builtinAesCtr encrypts or decrypts with AES in CTR mode, with a zero IV:
+// key msg -> output
+func builtinAesCtr(args []string) (string, error) {
+	if len(args) != 2 {
+		return "", errors.New("usage: key msg")
+	}
+	key, err := hex.DecodeString(args[0])
+	if err != nil {
+		return "", err
+	}
+	msg, err := hex.DecodeString(args[1])
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	out := make([]byte, len(msg))
+	cipher.NewCTR(block, make([]byte, aes.BlockSize)).XORKeyStream(out, msg)
+	return hex.EncodeToString(out), nil
+}
+
+// builtinHmacSha256 computes a HMAC-SHA256 tag: key msg -> tag
+func builtinHmacSha256(args []string) (string, error) {
+	if len(args) != 2 {
+		return "", errors.New("usage: key msg")
+	}
+	key, err := hex.DecodeString(args[0])
+	if err != nil {
+		return "", err
+	}
+	msg, err := hex.DecodeString(args[1])
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(msg)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// builtinSha256 computes a SHA-256 hash: msg -> hash
+func builtinSha256(args []string) (string, error) {
+	if len(args) != 1 {
+		return "", errors.New("usage: msg")
+	}
+	msg, err := hex.DecodeString(args[0])
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(msg)
+	return hex.EncodeToString(h[:]), nil
+}
+
+// builtinRsaKey returns the RSA public key of the hex modulus and exponent,
+// the exponent must fit in an int, as in crypto/rsa
+func builtinRsaKey(n, e *big.Int) (*rsa.PublicKey, error) {
+	if !e.IsInt64() || e.Int64() > int64(^uint32(0)>>1) {
+		return nil, errors.New("fail: the public exponent is too large")
+	}
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+// builtinRsaPrivateKey returns the RSA private key of the hex primes and
+// exponents
+func builtinRsaPrivateKey(args []string) (*rsa.PrivateKey, error) {
+	ints, err := builtinInts(args...)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := builtinRsaKey(new(big.Int).Mul(ints[0], ints[1]), ints[2])
+	if err != nil {
+		return nil, err
+	}
+	key := &rsa.PrivateKey{PublicKey: *pub, D: ints[3], Primes: []*big.Int{ints[0], ints[1]}}
+	key.Precompute()
+	return key, nil
+}
+
+// builtinRsaOaep encrypts or decrypts with RSA OAEP and SHA-256:
+// N E msg -> ciphertext and P Q E D ciphertext -> msg
+func builtinRsaOaep(args []string) (string, error) {
+	switch len(args) {
+	case 3:
+		ints, err := builtinInts(args[0], args[1])
+		if err != nil {
+			return "", err
+		}
+		pub, err := builtinRsaKey(ints[0], ints[1])
+		if err != nil {
+			return "", err
+		}
+		msg, err := hex.DecodeString(args[2])
+		if err != nil {
+			return "", err
+		}
+		cipher, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, msg, nil)
+		if err != nil {
+			return "", fmt.Errorf("fail: %v", err)
+		}
+		return hex.EncodeToString(cipher), nil
+	case 5:
+		key, err := builtinRsaPrivateKey(args[:4])
+		if err != nil {
+			return "", err
+		}
+		cipher, err := hex.DecodeString(args[4])
+		if err != nil {
+			return "", err
+		}
+		msg, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, key, cipher, nil)
+		if err != nil {
+			return "", fmt.Errorf("fail: %v", err)
+		}
+		return hex.EncodeToString(msg), nil
+	}
+	return "", errors.New("usage: N E msg or P Q E D ciphertext")
+}
+
+// builtinRsaPkcs1 signs or verifies with RSA PKCS#1 v1.5 and SHA-256, unless
+// another hash is selected with -H: P Q E D msg -> signature and
+// N E signature msg -> validity
+func builtinRsaPkcs1(args []string) (string, error) {
+	args, h, err := builtinHash(args)
+	if err != nil {
+		return "", err
+	}
+	if len(args) != 4 && len(args) != 5 {
+		return "", errors.New("usage: [-H hash] P Q E D msg or N E signature msg")
+	}
+	hashed, err := builtinDigest(h, args[len(args)-1])
+	if err != nil {
+		return "", err
+	}
+	if len(args) == 5 {
+		key, err := builtinRsaPrivateKey(args[:4])
+		if err != nil {
+			return "", err
+		}
+		sig, err := rsa.SignPKCS1v15(nil, key, h, hashed)
+		if err != nil {
+			return "", fmt.Errorf("fail: %v", err)
+		}
+		return hex.EncodeToString(sig), nil
+	}
+	ints, err := builtinInts(args[0], args[1])
+	if err != nil {
+		return "", err
+	}
+	pub, err := builtinRsaKey(ints[0], ints[1])
+	if err != nil {
+		return "", err
+	}
+	sig, err := hex.DecodeString(args[2])
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprint(rsa.VerifyPKCS1v15(pub, h, hashed, sig) == nil), nil
+}
+
+// builtinEcdsa signs or verifies with ECDSA on P-256 and SHA-256, unless
+// another hash is selected with -H, another curve with -C or the digest is
+// given with -h: X Y D msg -> R S and X Y R S msg -> validity. The verifier
+// also takes the parameters of the curve with -P, which must be the ones of a
+// known curve.
+func builtinEcdsa(args []string) (string, error) {
+	args, h, err := builtinHash(args)
+	if err != nil {
+		return "", err
+	}
+	curve, _ := curveByName("secp256r1")
+	if len(args) >= 2 && args[0] == curveFlag {
+		var ok bool
+		if curve, ok = curveByName(args[1]); !ok {
+			return "", fmt.Errorf("unsupported curve %s", args[1])
+		}
+		args = args[2:]
+	}
+	if len(args) >= 8 && args[0] == explicitFlag {
+		params, err := builtinInts(args[1:8]...)
+		if err != nil {
+			return "", err
+		}
+		var ok bool
+		if curve, ok = explicitCurve(params); !ok || len(args) != 13 {
+			return "", errors.New("unsupported explicit parameters")
+		}
+		args = args[8:]
+	}
+	args, digest, err := builtinHashFlag(args)
+	if err != nil {
+		return "", err
+	}
+	if len(args) != 4 && len(args) != 5 {
+		return "", errors.New("usage: [-H hash] [-C curve] [-h digest | -P p a b gx gy n h] X Y D msg or X Y R S msg")
+	}
+	ints, err := builtinInts(args[:len(args)-1]...)
+	if err != nil {
+		return "", err
+	}
+	if digest == nil {
+		if digest, err = builtinDigest(h, args[len(args)-1]); err != nil {
+			return "", err
+		}
+	}
+	if len(args) == 5 {
+		return fmt.Sprint(curve.verify(ints[0], ints[1], digest, ints[2], ints[3])), nil
+	}
+	r, s, err := curve.sign(ints[2], digest, rand.Reader)
+	if err != nil {
+		return "", fmt.Errorf("fail: %v", err)
+	}
+	size := curve.orderLen()
+	return hex.EncodeToString(padTo(r.Bytes(), size)) + "\n" + hex.EncodeToString(padTo(s.Bytes(), size)), nil
+}
+
+// builtinDsa signs or verifies with DSA and SHA-256, unless another hash is
+// selected with -H or the digest is given with -h, truncated to the size of
+// Q: P Q G Y X msg -> R S and P Q G Y R S msg -> validity
+func builtinDsa(args []string) (string, error) {
+	args, h, err := builtinHash(args)
+	if err != nil {
+		return "", err
+	}
+	args, digest, err := builtinHashFlag(args)
+	if err != nil {
+		return "", err
+	}
+	if len(args) != 6 && len(args) != 7 {
+		return "", errors.New("usage: [-H hash] [-h digest] P Q G Y X msg or P Q G Y R S msg")
+	}
+	ints, err := builtinInts(args[:len(args)-1]...)
+	if err != nil {
+		return "", err
+	}
+	pub := dsa.PublicKey{Parameters: dsa.Parameters{P: ints[0], Q: ints[1], G: ints[2]}, Y: ints[3]}
+	if pub.Q.Sign() <= 0 {
+		return "", errors.New("fail: invalid Q")
+	}
+	// the digest is truncated to the byte length of Q, as per FIPS 186-4
+	size := (pub.Q.BitLen() + 7) / 8
+	if digest == nil {
+		if digest, err = builtinDigest(h, args[len(args)-1]); err != nil {
+			return "", err
+		}
+	}
+	if len(digest) > size {
+		digest = digest[:size]
+	}
+	if len(args) == 7 {
+		return fmt.Sprint(dsa.Verify(&pub, digest, ints[4], ints[5])), nil
+	}
+	r, s, err := dsa.Sign(rand.Reader, &dsa.PrivateKey{PublicKey: pub, X: ints[4]}, digest)
+	if err != nil {
+		return "", fmt.Errorf("fail: %v", err)
+	}
+	return hex.EncodeToString(padTo(r.Bytes(), size)) + "\n" + hex.EncodeToString(padTo(s.Bytes(), size)), nil
+}
+
+// builtinDER wraps the signature built-in run into its DER variant, which
+// outputs DER signatures and verifies the ones given with -D, as strict DER
+func builtinDER(run func([]string) (string, error)) func([]string) (string, error) {
+	return func(args []string) (string, error) {
+		// -D comes after -H and -C
+		i := 0
+		for i+1 < len(args) && (args[i] == hashFlag || args[i] == curveFlag) {
+			i += 2
+		}
+		if i < len(args) && args[i] == derFlag {
+			rest := args[i+1:]
+			if len(rest) < 2 {
+				return "", errors.New("usage: [-H hash] [-C curve] -D [flags] key... sig msg")
+			}
+			r, s, err := parseDERSignature(rest[len(rest)-2])
+			if err != nil {
+				return "", fmt.Errorf("fail: %v", err)
+			}
+			verify := withArgs(args[:i], rest[:len(rest)-2]...)
+			return run(withArgs(verify, hex.EncodeToString(padTo(r.Bytes(), 1)),
+				hex.EncodeToString(padTo(s.Bytes(), 1)), rest[len(rest)-1]))
+		}
+		out, err := run(args)
+		if err != nil {
+			return out, err
+		}
+		r, s, ok := splitSignature(out)
+		ints, parsed := parseHex(r, s)
+		if !ok || !parsed {
+			return "", fmt.Errorf("fail: invalid signature %s", out)
+		}
+		sig, ok := derSignatureHex(ints[0], ints[1])
+		if !ok {
+			return "", fmt.Errorf("fail: cannot encode the signature %s", out)
+		}
+		return sig, nil
+	}
+}
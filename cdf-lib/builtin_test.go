@@ -0,0 +1,100 @@
+package cdf
+
+import (
+	"encoding/hex"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuiltins(t *testing.T) {
+	initForTesting("RSA")
+	Config.Timeout = 10
+
+	run := func(prog string, args ...string) string {
+		out, err := runProg(builtinPrefix+prog, "test", args)
+		if err != nil {
+			t.Fatalf("%s %v: %v", prog, args, err)
+		}
+		return out
+	}
+
+	if out := run("sha256", "616263"); out != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Error("Unexpected SHA-256 hash:", out)
+	}
+	key, msg := hex.EncodeToString([]byte("Jefe")), hex.EncodeToString([]byte("what do ya want for nothing?"))
+	if out := run("hmac-sha256", key, msg); out != "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843" {
+		t.Error("Unexpected HMAC-SHA256 tag:", out)
+	}
+	aesKey := strings.Repeat("2b", 16)
+	if out := run("aes-ctr", aesKey, run("aes-ctr", aesKey, "00112233")); out != "00112233" {
+		t.Error("Expected AES-CTR decryption to recover the message, got", out)
+	}
+
+	cipher := run("rsa-oaep-sha256", Config.RsaN, Config.RsaE, "abcdef")
+	if out := run("rsa-oaep-sha256", Config.RsaP, Config.RsaQ, Config.RsaE, Config.RsaD, cipher); out != "abcdef" {
+		t.Error("Expected OAEP decryption to recover the message, got", out)
+	}
+	sig := run("rsa-pkcs1-sha256", Config.RsaP, Config.RsaQ, Config.RsaE, Config.RsaD, "abcdef")
+	if out := run("rsa-pkcs1-sha256", Config.RsaN, Config.RsaE, sig, "abcdef"); out != trueStr {
+		t.Error("Expected the PKCS#1 signature to be valid, got", out)
+	}
+
+	ecSig := strings.Split(run("ecdsa-p256-sha256", Config.EcdsaX, Config.EcdsaY, Config.EcdsaD, "abcdef"), "\n")
+	if out := run("ecdsa-p256-sha256", Config.EcdsaX, Config.EcdsaY, ecSig[0], ecSig[1], "abcdef"); out != trueStr {
+		t.Error("Expected the ECDSA signature to be valid, got", out)
+	}
+	if out := run("ecdsa-p256-sha256", Config.EcdsaX, Config.EcdsaY, ecSig[0], ecSig[1], "abcd"); out != "false" {
+		t.Error("Expected the ECDSA signature to be invalid for another message, got", out)
+	}
+
+	p, q, g, y, x := generateDSAKey(rand.New(rand.NewSource(1)), 512, 160)
+	dsaArgs := []string{p.Text(16), q.Text(16), g.Text(16), y.Text(16)}
+	dsaSig := strings.Split(run("dsa", append(dsaArgs, x.Text(16), "abcdef")...), "\n")
+	if len(dsaSig[0]) != 40 {
+		t.Error("Expected the signature to be padded to the size of Q, got", dsaSig[0])
+	}
+	if out := run("dsa", append(dsaArgs, dsaSig[0], dsaSig[1], "abcdef")...); out != trueStr {
+		t.Error("Expected the DSA signature to be valid, got", out)
+	}
+
+	// the errors are reported as those of the programs
+	if _, err := runProg(builtinPrefix+"rsa-oaep-sha256", "test", []string{Config.RsaN, "1" + strings.Repeat("0", 20), "ab"}); err == nil {
+		t.Error("Expected an error with a too large public exponent")
+	}
+	if _, err := runProg(builtinPrefix+"sha256", "test", []string{"zz"}); err == nil {
+		t.Error("Expected an error with an invalid hex argument")
+	}
+
+	// the built-in programs wait for an execution slot as the others
+	Config.Concurrency = 1
+	defer func() { Config.Concurrency = 3 }()
+	release := acquireSlot()
+	done := make(chan struct{})
+	go func() {
+		runProg(builtinPrefix+"sha256", "test", []string{"616263"})
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Error("Expected the built-in program to wait for the slot")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+	<-done
+}
+
+func TestCheckProgram(t *testing.T) {
+	if err := CheckProgram("builtin:sha256"); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	for _, prog := range []string{"builtin:md4", "/does/not/exist"} {
+		if err := CheckProgram(prog); err == nil {
+			t.Errorf("Expected an error with %s", prog)
+		}
+	}
+	if len(Builtins("ecdsa")) != 2 || len(Builtins("")) != len(builtins) {
+		t.Error("Unexpected built-in programs", Builtins(""))
+	}
+}
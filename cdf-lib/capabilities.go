@@ -0,0 +1,246 @@
+package cdf
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// capabilitiesFlag is the flag a program is run with to declare its
+// capabilities, printing them as a JSON object
+const capabilitiesFlag = "--cdf-capabilities"
+
+// Capabilities are the optional features a program supports. The lists left
+// empty and a zero MaxMsgLen mean that the program does not restrict them.
+type Capabilities struct {
+	Prehashed      bool     `json:"prehashed"`                // the -h flag
+	ExplicitParams bool     `json:"explicitParams,omitempty"` // the -P flag of ECDSA
+	DER            bool     `json:"der,omitempty"`            // DER signatures, verified with -D
+	Hashes         []string `json:"hashes,omitempty"`
+	Curves         []string `json:"curves,omitempty"`
+	KeySizes       []int    `json:"keySizes,omitempty"` // in bits, the L size for DSA
+	MaxMsgLen      int      `json:"maxMsgLen,omitempty"`
+	Algorithms     []string `json:"algorithms,omitempty"` // as named in the Wycheproof files
+}
+
+// the capabilities of the built-in programs, the signature ones selecting
+// their hash with -H and the ECDSA ones their curve with -C, or its
+// parameters with -P
+var builtinCapabilities = map[string]Capabilities{
+	"ecdsa-p256-sha256":     {Prehashed: true, ExplicitParams: true, Hashes: signatureHashes, Curves: CurveNames()},
+	"ecdsa-p256-sha256-der": {Prehashed: true, ExplicitParams: true, DER: true, Hashes: signatureHashes, Curves: CurveNames()},
+	"dsa":                   {Prehashed: true, Hashes: signatureHashes},
+	"dsa-der":               {Prehashed: true, DER: true, Hashes: signatureHashes},
+	"hmac-sha256":           {Hashes: []string{"SHA-256"}, Algorithms: []string{"HMACSHA256"}},
+	"sha256":                {Hashes: []string{"SHA-256"}},
+	"rsa-oaep-sha256":       {Hashes: []string{"SHA-256"}, Algorithms: []string{"RSAES-OAEP"}},
+	"rsa-pkcs1-sha256":      {Hashes: signatureHashes},
+}
+
+// the names of the curves, as in the Wycheproof files, by alias
+var curveAliases = map[string]string{
+	"p-224": "secp224r1", "p224": "secp224r1",
+	"p-256": "secp256r1", "p256": "secp256r1", "prime256v1": "secp256r1",
+	"p-384": "secp384r1", "p384": "secp384r1",
+	"p-521": "secp521r1", "p521": "secp521r1",
+}
+
+// the interfaces whose programs use the hash of Config
+var hashed = map[string]bool{"dsa": true, "ecdsa": true, "prf": true, "rsaenc": true, "rsasign": true}
+
+// capabilities caches the capabilities of the programs
+var capabilities = struct {
+	sync.Mutex
+	byProg map[string]Capabilities
+}{}
+
+// ProgramCapabilities returns the capabilities of prog: the ones set for it,
+// or for its base name, in Config.Capabilities, else the ones it declares when
+// run with --cdf-capabilities, else the -h flag only, as set by TestHashes.
+func ProgramCapabilities(prog string) Capabilities {
+	capabilities.Lock()
+	defer capabilities.Unlock()
+	if c, ok := capabilities.byProg[prog]; ok {
+		return c
+	}
+	c, source := programCapabilities(prog)
+	LogInfo.Printf("capabilities of %s (%s): %s\n", prog, source, c)
+	if capabilities.byProg == nil {
+		capabilities.byProg = make(map[string]Capabilities)
+	}
+	capabilities.byProg[prog] = c
+	return c
+}
+
+// programCapabilities looks up the capabilities of prog, returning where they
+// come from
+func programCapabilities(prog string) (Capabilities, string) {
+	for _, name := range []string{prog, filepath.Base(prog)} {
+		if c, ok := Config.Capabilities[name]; ok {
+			return c, "config.json"
+		}
+	}
+	if strings.HasPrefix(prog, builtinPrefix) {
+		return builtinCapabilities[strings.TrimPrefix(prog, builtinPrefix)], "built-in"
+	}
+	out, err := execProg(prog, "capabilities", []string{capabilitiesFlag})
+	var c Capabilities
+	if err == nil && json.Unmarshal([]byte(out), &c) == nil {
+		return c, "declared"
+	}
+	return Capabilities{Prehashed: TestHashes != nil && *TestHashes}, "undeclared"
+}
+
+// ResetCapabilities forgets the capabilities of the programs, and the hash
+// and curve selected for them, e.g. once the config is reloaded
+func ResetCapabilities() {
+	capabilities.Lock()
+	capabilities.byProg = nil
+	capabilities.Unlock()
+	clearSelection()
+}
+
+// String summarises the capabilities
+func (c Capabilities) String() string {
+	list := func(l []string) string {
+		if len(l) == 0 {
+			return "any"
+		}
+		return strings.Join(l, ", ")
+	}
+	sizes := "any"
+	if len(c.KeySizes) > 0 {
+		sizes = strings.Trim(fmt.Sprint(c.KeySizes), "[]")
+	}
+	maxLen := "any"
+	if c.MaxMsgLen > 0 {
+		maxLen = fmt.Sprint(c.MaxMsgLen)
+	}
+	algorithms := "of the interface"
+	if len(c.Algorithms) > 0 {
+		algorithms = strings.Join(c.Algorithms, ", ")
+	}
+	return fmt.Sprintf("prehashed %v, explicit parameters %v, DER %v, hashes %s, curves %s, key sizes %s, max message length %s, algorithms %s",
+		c.Prehashed, c.ExplicitParams, c.DER, list(c.Hashes), list(c.Curves), sizes, maxLen, algorithms)
+}
+
+// SupportsHash tells whether the program supports the named hash, the names
+// being compared regardless of case and dashes
+func (c Capabilities) SupportsHash(name string) bool {
+	norm := func(s string) string { return strings.ToUpper(strings.Replace(s, "-", "", -1)) }
+	return len(c.Hashes) == 0 || containsName(c.Hashes, name, norm)
+}
+
+// SupportsCurve tells whether the program supports the named curve, which
+// may be given by one of its aliases
+func (c Capabilities) SupportsCurve(name string) bool {
+	return len(c.Curves) == 0 || containsName(c.Curves, name, curveName)
+}
+
+// SupportsKeySize tells whether the program supports keys of the given size
+func (c Capabilities) SupportsKeySize(bits int) bool {
+	if len(c.KeySizes) == 0 || bits == 0 {
+		return true
+	}
+	for _, size := range c.KeySizes {
+		if size == bits {
+			return true
+		}
+	}
+	return false
+}
+
+// curveName returns the Wycheproof name of a curve given by any of its aliases
+func curveName(name string) string {
+	name = strings.ToLower(name)
+	if alias, ok := curveAliases[name]; ok {
+		return alias
+	}
+	return name
+}
+
+// containsName tells whether the list contains name, once normalised
+func containsName(list []string, name string, norm func(string) string) bool {
+	for _, n := range list {
+		if norm(n) == norm(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// capable tells whether all progs have the capability needed by the test,
+// recording the test as skipped otherwise
+func capable(test, capability string, has func(Capabilities) bool, progs ...string) bool {
+	var lacking []string
+	for _, prog := range progs {
+		if !has(ProgramCapabilities(prog)) {
+			lacking = append(lacking, prog)
+		}
+	}
+	if len(lacking) == 0 {
+		return true
+	}
+	reason := fmt.Sprintf("%s does not support %s", strings.Join(lacking, " and "), capability)
+	LogInfo.Printf("skipping %s: %s\n", test, reason)
+	addSkip(test, reason)
+	return false
+}
+
+// testedProgs returns Prog1 and, if set, Prog2
+func testedProgs() []string {
+	if Prog2 == "" {
+		return []string{Prog1}
+	}
+	return []string{Prog1, Prog2}
+}
+
+// prehashed tells whether a program supports the -h flag
+func prehashed(c Capabilities) bool {
+	return c.Prehashed
+}
+
+// NegotiateCapabilities adapts the run to the capabilities of Prog1 and Prog2:
+// the message lengths are capped to the smallest maximal one and the programs
+// must support the hash of Config, or have hashes in common for the signature
+// interfaces. It returns an error if the programs cannot be tested together.
+func NegotiateCapabilities() error {
+	for _, prog := range testedProgs() {
+		c := ProgramCapabilities(prog)
+		if c.MaxMsgLen > 0 && c.MaxMsgLen < Config.MaxMsgLen {
+			LogInfo.Printf("capping the message lengths to %d bytes, the maximum of %s\n", c.MaxMsgLen, prog)
+			Config.MaxMsgLen = c.MaxMsgLen
+		}
+		if hashed[Interf] && !hashAgile[Interf] && !c.SupportsHash(hashName()) {
+			return fmt.Errorf("%s does not support the hash %s of config.json", prog, hashName())
+		}
+	}
+	if hashAgile[Interf] {
+		hashes := TestedHashes()
+		if len(hashes) == 0 {
+			return fmt.Errorf("the programs have no hash in common, the one of config.json being %s", hashName())
+		}
+		LogInfo.Println("testing the hashes:", strings.Join(hashes, ", "))
+	}
+	if Config.MinMsgLen > Config.MaxMsgLen {
+		return fmt.Errorf("the programs support messages of %d bytes at most, less than minMsgLen", Config.MaxMsgLen)
+	}
+	return nil
+}
+
+// vectorSupport tells why prog cannot run a test vector with the given hash,
+// curve and key size, any of which may be empty, or returns an empty string
+func vectorSupport(prog, hash, curve string, keySize int) string {
+	c := ProgramCapabilities(prog)
+	switch {
+	case hash != "" && !c.SupportsHash(hash):
+		return fmt.Sprintf("hash %s not supported by %s", hash, prog)
+	case curve != "" && !c.SupportsCurve(curve):
+		return fmt.Sprintf("curve %s not supported by %s", curve, prog)
+	case !c.SupportsKeySize(keySize):
+		return fmt.Sprintf("%d-bit keys not supported by %s", keySize, prog)
+	}
+	return ""
+}
@@ -0,0 +1,54 @@
+package cdf
+
+import "testing"
+
+func TestCapabilities(t *testing.T) {
+	c := Capabilities{Hashes: []string{"SHA-256"}, Curves: []string{"P-256"}, KeySizes: []int{2048}}
+	if !c.SupportsHash("sha256") || c.SupportsHash("SHA-1") {
+		t.Error("Expected SHA-256 only to be supported, whatever its spelling")
+	}
+	if !c.SupportsCurve("secp256r1") || !c.SupportsCurve("prime256v1") || c.SupportsCurve("secp384r1") {
+		t.Error("Expected P-256 only to be supported, whatever its alias")
+	}
+	if !c.SupportsKeySize(2048) || c.SupportsKeySize(1024) {
+		t.Error("Expected 2048-bit keys only to be supported")
+	}
+	if any := (Capabilities{}); !any.SupportsHash("SHA-512") || !any.SupportsCurve("secp521r1") || !any.SupportsKeySize(4096) {
+		t.Error("Expected no restriction without declared capabilities")
+	}
+}
+
+func TestProgramCapabilities(t *testing.T) {
+	initForTesting("RSA")
+	defer func() { Config.Capabilities = nil }()
+
+	Config.Capabilities = map[string]Capabilities{"prog": {MaxMsgLen: 16}}
+	if c := ProgramCapabilities("/path/to/prog"); c.MaxMsgLen != 16 {
+		t.Error("Expected the capabilities of config.json to be found by base name, got", c)
+	}
+	if c := ProgramCapabilities("builtin:ecdsa-p256-sha256"); !c.Prehashed || !c.SupportsCurve("P-256") {
+		t.Error("Expected the built-in ECDSA program to support -h and P-256, got", c)
+	}
+
+	skips.list = nil
+	defer func() { skips.list = nil }()
+	Config.Capabilities["builtin:hmac-sha256"] = Capabilities{Prehashed: true}
+	if capable("test", "the -h flag", prehashed, "builtin:hmac-sha256", "builtin:sha256") {
+		t.Error("Expected builtin:sha256 not to support -h")
+	}
+	if len(skips.list) != 1 || skips.list[0] != "test: builtin:sha256 does not support the -h flag" {
+		t.Error("Expected the test to be recorded as skipped, got", skips.list)
+	}
+
+	Prog1, Prog2, Interf = "builtin:rsa-oaep-sha256", "/path/to/prog", "rsaenc"
+	defer func() { Prog1, Prog2, Interf = "", "", "" }()
+	Config.MinMsgLen, Config.MaxMsgLen, Config.Hash = 1, 64, "SHA-256"
+	if err := NegotiateCapabilities(); err != nil || Config.MaxMsgLen != 16 {
+		t.Errorf("Expected the message lengths to be capped to 16, got %d (%v)", Config.MaxMsgLen, err)
+	}
+	Config.Hash = "SHA-1"
+	if err := NegotiateCapabilities(); err == nil {
+		t.Error("Expected builtin:rsa-oaep-sha256 not to support SHA-1")
+	}
+	Config.Hash = ""
+}
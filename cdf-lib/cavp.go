@@ -0,0 +1,534 @@
+package cdf
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	_ "crypto/sha1" // registers the hashes used by the CAVP sections
+	_ "crypto/sha256"
+	_ "crypto/sha3"
+	_ "crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// cavpSection is a [section] of a CAVP response file. Its parameters are the
+// values set by the blocks which are not test cases, such as DSA domain
+// parameters, and are inherited by the following test cases. Mode is the
+// block cipher mode of the AES files, named in their header comments.
+type cavpSection struct {
+	Name   string
+	Mode   string
+	Params map[string]string
+	Tests  []map[string]string
+}
+
+// cavpCase is a CAVP test case mapped onto a cdf interface.
+type cavpCase struct {
+	section string
+	count   string
+	interf  string
+	// hash and curve are the ones of the section, selected for the programs
+	// declaring several ones
+	hash, curve string
+	args        []string
+	// check tells whether the output of the program matches the expected one
+	check func(out string, err error) error
+}
+
+// the hashes which may be named in the section headers, longest names first
+var cavpHashes = []struct {
+	name string
+	hash crypto.Hash
+}{
+	{"SHA-512/224", crypto.SHA512_224},
+	{"SHA-512/256", crypto.SHA512_256},
+	{"SHA-1", crypto.SHA1},
+	{"SHA-224", crypto.SHA224},
+	{"SHA-256", crypto.SHA256},
+	{"SHA-384", crypto.SHA384},
+	{"SHA-512", crypto.SHA512},
+	{"SHA3-224", crypto.SHA3_224},
+	{"SHA3-256", crypto.SHA3_256},
+	{"SHA3-384", crypto.SHA3_384},
+	{"SHA3-512", crypto.SHA3_512},
+}
+
+// the hashes of the HMAC and SHA sections, which are named by the length in
+// bytes of their output, e.g. [L=20]
+var cavpLengths = map[string]string{
+	"20": "SHA-1",
+	"28": "SHA-224",
+	"32": "SHA-256",
+	"48": "SHA-384",
+	"64": "SHA-512",
+}
+
+var cavpCurves = map[string]elliptic.Curve{
+	"P-224": elliptic.P224(),
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+// TestCAVP runs the known-answer tests of a NIST CAVP response file against
+// Prog1 and prints a pass/fail summary per section. Only the sections whose
+// name contains only are run, if it is not empty. The outputs are checked
+// against the expected ones, except for signature generation where the
+// signatures are verified against the key of the test case since they depend
+// on the nonce. The hash and the curve of the section are selected with -H
+// and -C for a program declaring several ones and, when Prog1 supports the -h
+// flag, the digest of the message is computed with the hash and passed to the
+// signature programs. The sections whose hash or curve Prog1 does not support
+// are skipped.
+func TestCAVP(file, only string) error {
+	LogInfo.Println("running the CAVP known-answer tests from", file, "against", Prog1)
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	sections, err := parseCAVP(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("invalid CAVP file %s: %v", file, err)
+	}
+
+	var cases []cavpCase
+	skipped := make(map[string]int)
+	for _, section := range sections {
+		if only != "" && !strings.Contains(section.Name, only) {
+			continue
+		}
+		if reason := cavpSupport(section.Name); reason != "" {
+			skipped[reason] += len(section.Tests)
+			continue
+		}
+		for _, test := range section.Tests {
+			c, err := cavpToCase(section, test)
+			if err != nil {
+				skipped[err.Error()]++
+				continue
+			}
+			c.hash, c.curve = cavpParams(section.Name)
+			// HMAC is computed with the hash of config.json by the programs
+			// declaring none, as with the Wycheproof files
+			if c.interf == "prf" && c.hash != "" {
+				hmac := "HMAC" + strings.Replace(c.hash, "SHA-", "SHA", 1)
+				if _, reason := algorithmSupport(Prog1, hmac); reason != "" {
+					skipped[reason]++
+					continue
+				}
+			}
+			cases = append(cases, c)
+		}
+	}
+	if len(cases) == 0 {
+		return errors.New("no test case to run in " + file)
+	}
+
+	TermPrepareFor(1)
+	results := make([]error, len(cases))
+	mainErr := MultiError{}
+	// the sections of each hash and curve are run with them selected
+	params := func(i int) (string, string) { return cases[i].hash, cases[i].curve }
+	for _, batch := range vectorBatches(len(cases), params) {
+		batch.run(func() {
+			jobs := newJobGroup("cavp", len(batch.indices))
+			for _, i := range batch.indices {
+				i, c := i, cases[i]
+				jobs.Go(func() error {
+					id := fmt.Sprintf("cavp#%s#%s", c.interf, c.count)
+					out, err := runProg(Prog1, id, c.args)
+					if isHang(err) {
+						return err
+					}
+					results[i] = c.check(out, err)
+					return nil
+				})
+			}
+			if err := jobs.Wait(); err != nil {
+				mainErr = append(mainErr, err.(MultiError)...)
+			}
+		})
+	}
+	fmt.Print("\n")
+
+	// we keep the order of the sections in the file for the summary
+	var names []string
+	passed := make(map[string]int)
+	failed := make(map[string]int)
+	for i, c := range cases {
+		if passed[c.section]+failed[c.section] == 0 {
+			names = append(names, c.section)
+		}
+		if results[i] == nil {
+			passed[c.section]++
+			continue
+		}
+		failed[c.section]++
+		msg := fmt.Sprintf("[%s] COUNT %s: %v", c.section, c.count, results[i])
+		LogWarning.Printf("%s\n\targs: %v\n", msg, c.args)
+		addFinding(Finding{Test: "cavp." + c.interf, Progs: []string{Prog1},
+			Inputs: c.args, Message: msg, Interf: c.interf, Hash: c.hash, Curve: c.curve})
+		mainErr = append(mainErr, errors.New(msg))
+	}
+
+	for _, name := range names {
+		if failed[name] == 0 {
+			LogSuccess.Printf("[%s]: PASS (%d tests)\n", name, passed[name])
+		} else {
+			LogWarning.Printf("[%s]: FAIL (%d / %d tests failed)\n", name,
+				failed[name], passed[name]+failed[name])
+		}
+	}
+	reasons := make([]string, 0, len(skipped))
+	for reason := range skipped {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		LogInfo.Printf("%d tests skipped: %s\n", skipped[reason], reason)
+	}
+
+	if len(mainErr) > 0 {
+		return mainErr
+	}
+	return nil
+}
+
+// parseCAVP reads the sections of a CAVP response file: comments start with
+// #, consecutive [section] headers are joined and blocks of Key = value lines
+// are separated by blank lines. A block defining a Msg, Plaintext or
+// Ciphertext is a test case, any other block sets parameters of the section.
+// The keys are upper cased. The mode of the AES files is read from their
+// "test data for <mode>" comment.
+func parseCAVP(r io.Reader) ([]cavpSection, error) {
+	var sections []cavpSection
+	var current *cavpSection
+	block := make(map[string]string)
+	lastWasHeader := false
+	mode := ""
+
+	flush := func() {
+		if len(block) == 0 {
+			return
+		}
+		_, msg := block["MSG"]
+		_, pt := block["PLAINTEXT"]
+		_, ct := block["CIPHERTEXT"]
+		if msg || pt || ct {
+			test := make(map[string]string, len(current.Params)+len(block))
+			for k, v := range current.Params {
+				test[k] = v
+			}
+			for k, v := range block {
+				test[k] = v
+			}
+			current.Tests = append(current.Tests, test)
+		} else {
+			for k, v := range block {
+				current.Params[k] = v
+			}
+		}
+		block = make(map[string]string)
+	}
+
+	scanner := bufio.NewScanner(r)
+	// some messages span hundreds of kilobytes
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for lineNb := 1; scanner.Scan(); lineNb++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			if current != nil {
+				flush()
+			}
+		case strings.HasPrefix(line, "#"):
+			if i := strings.Index(line, "test data for "); i >= 0 {
+				fields := strings.Fields(line[i+len("test data for "):])
+				if len(fields) > 0 {
+					mode = strings.ToUpper(fields[0])
+				}
+			}
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if lastWasHeader {
+				current.Name += ", " + name
+			} else {
+				if current != nil {
+					flush()
+				}
+				sections = append(sections, cavpSection{Name: name, Mode: mode, Params: make(map[string]string)})
+				current = &sections[len(sections)-1]
+			}
+			lastWasHeader = true
+			continue
+		default:
+			parts := strings.SplitN(line, "=", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("line %d: expected Key = value", lineNb)
+			}
+			if current == nil {
+				// some files have no section at all
+				sections = append(sections, cavpSection{Mode: mode, Params: make(map[string]string)})
+				current = &sections[len(sections)-1]
+			}
+			block[strings.ToUpper(strings.TrimSpace(parts[0]))] = strings.TrimSpace(parts[1])
+		}
+		lastWasHeader = false
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if current != nil {
+		flush()
+	}
+	return sections, nil
+}
+
+// cavpSupport tells why Prog1 cannot run the tests of the section, given the
+// hash and curve it names, or returns an empty string
+func cavpSupport(section string) string {
+	hash, curve := cavpParams(section)
+	return vectorSupport(Prog1, hash, curve, 0)
+}
+
+// cavpParams returns the names of the hash and the curve of the section, if
+// any
+func cavpParams(section string) (hash, curve string) {
+	for _, h := range cavpHashes {
+		if strings.Contains(section, h.name) {
+			hash = h.name
+			break
+		}
+	}
+	for _, param := range strings.Split(section, ",") {
+		param = strings.Replace(param, " ", "", -1)
+		if hash == "" && strings.HasPrefix(param, "L=") {
+			hash = cavpLengths[strings.TrimPrefix(param, "L=")]
+		}
+	}
+	for name := range cavpCurves {
+		if strings.Contains(section, name) {
+			curve = name
+		}
+	}
+	return hash, curve
+}
+
+// cavpHash returns the hash named in the section, if any
+func cavpHash(section string) (crypto.Hash, bool) {
+	for _, h := range cavpHashes {
+		if strings.Contains(section, h.name) {
+			return h.hash, h.hash.Available()
+		}
+	}
+	return 0, false
+}
+
+// cavpToCase maps a test case of the given section onto the matching cdf
+// interface. Its error tells why the case cannot be run.
+func cavpToCase(section cavpSection, t map[string]string) (cavpCase, error) {
+	c := cavpCase{section: section.Name, count: t["COUNT"]}
+	if c.count == "" {
+		// the hash files identify their cases by length
+		c.count = "Len=" + t["LEN"]
+	}
+	lower := func(key string) string { return strings.ToLower(t[key]) }
+	matches := func(expected string) func(string, error) error {
+		return func(out string, err error) error {
+			if err != nil {
+				return fmt.Errorf("expected %s, got error %v", expected, err)
+			}
+			if out != expected {
+				return fmt.Errorf("expected %s, got %s", expected, out)
+			}
+			return nil
+		}
+	}
+
+	msg := lower("MSG")
+	if bits, ok := t["LEN"]; ok {
+		n, err := strconv.Atoi(bits)
+		if err != nil || n%8 != 0 {
+			return c, errors.New("bit-oriented messages not supported")
+		}
+		if n/4 > len(msg) {
+			return c, errors.New("message shorter than its length")
+		}
+		// a zero length message is written 00
+		msg = msg[:n/4]
+	}
+
+	switch {
+	case t["MAC"] != "":
+		c.interf = "prf"
+		c.args = []string{lower("KEY"), msg}
+		tag := lower("MAC")
+		// the tags may be truncated to Tlen bytes
+		c.check = func(out string, err error) error {
+			if err != nil {
+				return fmt.Errorf("expected a tag starting with %s, got error %v", tag, err)
+			}
+			if !strings.HasPrefix(out, tag) {
+				return fmt.Errorf("expected a tag starting with %s, got %s", tag, out)
+			}
+			return nil
+		}
+	case t["MD"] != "":
+		c.interf = "xof"
+		c.args = []string{msg}
+		c.check = matches(lower("MD"))
+	case t["OUTPUT"] != "":
+		c.interf = "xof"
+		c.args = []string{msg}
+		expected := lower("OUTPUT")
+		// the program returns a fixed output length, so we compare the prefix
+		// both have in common
+		c.check = func(out string, err error) error {
+			if err == nil && out != "" && (strings.HasPrefix(out, expected) || strings.HasPrefix(expected, out)) {
+				return nil
+			}
+			return matches(expected)(out, err)
+		}
+	case t["PLAINTEXT"] != "" && t["CIPHERTEXT"] != "":
+		// the enc interface is AES-CTR, which the AESAVS files do not cover
+		switch section.Mode {
+		case "CTR":
+		case "":
+			return c, errors.New("AES mode not given in the file, the enc interface is AES-CTR")
+		default:
+			return c, fmt.Errorf("AES-%s not supported by the enc interface, which is AES-CTR", section.Mode)
+		}
+		if strings.Trim(t["IV"], "0") != "" {
+			return c, errors.New("non-zero IV not supported by the enc interface")
+		}
+		c.interf = "enc"
+		if strings.Contains(strings.ToUpper(section.Name), "DECRYPT") {
+			c.args = []string{lower("KEY"), lower("CIPHERTEXT")}
+			c.check = matches(lower("PLAINTEXT"))
+		} else {
+			c.args = []string{lower("KEY"), lower("PLAINTEXT")}
+			c.check = matches(lower("CIPHERTEXT"))
+		}
+	case t["R"] != "" && t["S"] != "":
+		return cavpSignatureCase(c, section.Name, t, msg)
+	default:
+		return c, errors.New("no known answer to check")
+	}
+	return c, nil
+}
+
+// cavpSignatureCase maps the SigVer and SigGen test cases of DSA and ECDSA.
+func cavpSignatureCase(c cavpCase, section string, t map[string]string, msg string) (cavpCase, error) {
+	h, hashOk := cavpHash(section)
+	var prefix []string
+	var digest []byte
+	if hashOk {
+		m, _ := hex.DecodeString(msg)
+		hasher := h.New()
+		hasher.Write(m)
+		digest = hasher.Sum(nil)
+		if ProgramCapabilities(Prog1).Prehashed {
+			prefix = []string{"-h", hex.EncodeToString(digest)}
+		}
+	}
+
+	isEcdsa := t["QX"] != ""
+	keys := []string{"P", "Q", "G", "Y"}
+	if isEcdsa {
+		c.interf = "ecdsa"
+		keys = []string{"QX", "QY"}
+	} else if t["P"] != "" {
+		c.interf = "dsa"
+	} else {
+		return c, errors.New("no known answer to check")
+	}
+	for _, key := range keys {
+		if !isHex(t[key]) {
+			return c, errors.New("malformed public key")
+		}
+	}
+
+	if result, ok := t["RESULT"]; ok {
+		// SigVer: the program has to agree with the expected verdict
+		if isEcdsa {
+			c.args = withArgs(prefix, t["QX"], t["QY"], t["R"], t["S"], msg)
+		} else {
+			c.args = withArgs(prefix, t["P"], t["Q"], t["G"], t["Y"], t["R"], t["S"], msg)
+		}
+		expected := strings.HasPrefix(result, "P")
+		c.check = func(out string, err error) error {
+			if (err == nil && out == trueStr) != expected {
+				return fmt.Errorf("expected Result = %s, got %q (error %v)", result, out, err)
+			}
+			return nil
+		}
+		return c, nil
+	}
+
+	// SigGen: the signature depends on the nonce, so we verify it
+	if !hashOk {
+		return c, errors.New("signature generation without a known hash in the section")
+	}
+	var verify func(r, s string) bool
+	if isEcdsa {
+		var curve elliptic.Curve
+		for name, cu := range cavpCurves {
+			if strings.Contains(section, name) {
+				curve = cu
+			}
+		}
+		if curve == nil {
+			return c, errors.New("signature generation on an unsupported curve")
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: fromBase16(t["QX"]), Y: fromBase16(t["QY"])}
+		c.args = withArgs(prefix, t["QX"], t["QY"], t["D"], msg)
+		verify = func(r, s string) bool { return ecdsa.Verify(pub, digest, fromBase16(r), fromBase16(s)) }
+	} else {
+		pub := &dsa.PublicKey{Parameters: dsa.Parameters{P: fromBase16(t["P"]),
+			Q: fromBase16(t["Q"]), G: fromBase16(t["G"])}, Y: fromBase16(t["Y"])}
+		// FIPS 186-3 uses the leftmost min(N, outlen) bits of the digest
+		if n := (pub.Q.BitLen() + 7) / 8; n < len(digest) {
+			digest = digest[:n]
+		}
+		c.args = withArgs(prefix, t["P"], t["Q"], t["G"], t["Y"], t["X"], msg)
+		verify = func(r, s string) bool { return dsa.Verify(pub, digest, fromBase16(r), fromBase16(s)) }
+	}
+	c.check = func(out string, err error) error {
+		if err != nil {
+			return fmt.Errorf("signing failed: %v", err)
+		}
+		sig := strings.Split(out, "\n")
+		if len(sig) != 2 || !isHex(sig[0]) || !isHex(sig[1]) {
+			return fmt.Errorf("expected r and s, got %q", out)
+		}
+		if !verify(sig[0], sig[1]) {
+			return fmt.Errorf("the signature r=%s, s=%s does not verify", sig[0], sig[1])
+		}
+		return nil
+	}
+	return c, nil
+}
+
+// isHex tells whether s is a non-empty hexadecimal string
+func isHex(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+	return true
+}
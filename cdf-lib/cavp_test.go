@@ -0,0 +1,230 @@
+package cdf
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const cavpSample = `#  CAVS 11.1
+#  "SigVer" information
+
+[mod = L=2048, N=256, SHA-256]
+
+P = 0b
+Q = 05
+G = 03
+
+Msg = 0102
+X = 02
+Y = 09
+R = 01
+S = 02
+Result = F (2 - R changed)
+
+P = 0d
+
+Msg = 0304
+Y = 0a
+R = 03
+S = 04
+Result = P
+
+[Tested for Output of byte-oriented messages]
+[Input Length = 8]
+
+COUNT = 0
+Outputlen = 16
+Msg = aa
+Output = 1234
+`
+
+func TestParseCAVP(t *testing.T) {
+	sections, err := parseCAVP(strings.NewReader(cavpSample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sections) != 2 {
+		t.Fatalf("Expected 2 sections, got %d", len(sections))
+	}
+	if name := sections[1].Name; name != "Tested for Output of byte-oriented messages, Input Length = 8" {
+		t.Error("Consecutive headers not joined:", name)
+	}
+	tests := sections[0].Tests
+	if len(tests) != 2 {
+		t.Fatalf("Expected 2 test cases in the first section, got %d", len(tests))
+	}
+	// the parameters are inherited until they are redefined, but not the
+	// values of the previous test cases
+	if tests[0]["P"] != "0b" || tests[1]["P"] != "0d" || tests[1]["Q"] != "05" {
+		t.Error("Wrong inherited parameters:", tests)
+	}
+	if _, ok := tests[1]["X"]; ok {
+		t.Error("A test case inherited the values of the previous one")
+	}
+	if tests[0]["RESULT"] != "F (2 - R changed)" {
+		t.Error("Wrong value:", tests[0]["RESULT"])
+	}
+
+	if _, err := parseCAVP(strings.NewReader("[L = 32]\nLen 0\n")); err == nil {
+		t.Error("Expected an error on a line without =")
+	}
+}
+
+func TestCAVPToCase(t *testing.T) {
+	initForTesting("DSA")
+	sections, err := parseCAVP(strings.NewReader(cavpSample))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := cavpToCase(sections[0], sections[0].Tests[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.interf != "dsa" || strings.Join(c.args, " ") != "0b 05 03 09 01 02 0102" {
+		t.Errorf("Unexpected case %s %v", c.interf, c.args)
+	}
+	if c.check("false", nil) != nil || c.check(trueStr, nil) == nil {
+		t.Error("Wrong interpretation of a failing SigVer result")
+	}
+
+	// the output of a xof may be compared on a prefix
+	c, err = cavpToCase(sections[1], sections[1].Tests[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.interf != "xof" || c.check("123456", nil) != nil || c.check("1235", nil) == nil {
+		t.Error("Wrong interpretation of a xof output")
+	}
+
+	hashes := []struct {
+		test  map[string]string
+		valid bool
+	}{
+		{map[string]string{"LEN": "0", "MSG": "00", "MD": "AB"}, true},
+		{map[string]string{"LEN": "8", "MSG": "D3", "MD": "AB"}, true},
+		{map[string]string{"LEN": "5", "MSG": "68", "MD": "AB"}, false},
+		{map[string]string{"LEN": "16", "MSG": "68", "MD": "AB"}, false},
+	}
+	for _, h := range hashes {
+		c, err := cavpToCase(cavpSection{Name: "L = 32"}, h.test)
+		if (err == nil) != h.valid {
+			t.Errorf("%v: expected validity %v, got error %v", h.test, h.valid, err)
+		}
+		if err == nil && c.check("ab", nil) != nil {
+			t.Errorf("%v: expected output ab to match", h.test)
+		}
+	}
+
+	// the truncated tags are compared on their prefix, and an error reports
+	// the expected tag
+	c, err = cavpToCase(cavpSection{Name: "L=32"}, map[string]string{"KEY": "00", "MSG": "01", "MAC": "ABCD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.check("abcdef", nil) != nil || c.check("abce", nil) == nil {
+		t.Error("Wrong interpretation of a MAC output")
+	}
+	if err := c.check("", errors.New("exit status 1")); err == nil || !strings.Contains(err.Error(), "abcd") {
+		t.Error("Expected the error to report the expected tag, got", err)
+	}
+
+	// the enc interface is AES-CTR, so the AES files of other modes are
+	// skipped
+	aes := "# AESVS GFSbox test data for %s\n\n[ENCRYPT]\n\nCOUNT = 0\nKEY = 00\nPLAINTEXT = 01\nCIPHERTEXT = 02\n"
+	for mode, valid := range map[string]bool{"ECB": false, "CBC": false, "CTR": true} {
+		sections, err := parseCAVP(strings.NewReader(fmt.Sprintf(aes, mode)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sections[0].Mode != mode {
+			t.Errorf("Expected mode %s, got %q", mode, sections[0].Mode)
+		}
+		if _, err := cavpToCase(sections[0], sections[0].Tests[0]); (err == nil) != valid {
+			t.Errorf("AES-%s: expected validity %v, got error %v", mode, valid, err)
+		}
+	}
+	if _, err := cavpToCase(cavpSection{Name: "ENCRYPT"}, map[string]string{"KEY": "00",
+		"PLAINTEXT": "01", "CIPHERTEXT": "02"}); err == nil {
+		t.Error("Expected an AES file without mode to be skipped")
+	}
+}
+
+func TestCAVPParams(t *testing.T) {
+	params := []struct {
+		section, hash, curve string
+	}{
+		{"L=20", "SHA-1", ""},
+		{"L = 32", "SHA-256", ""},
+		{"L=64", "SHA-512", ""},
+		{"L = 256", "", ""},
+		{"mod = L=2048, N=256, SHA-384", "SHA-384", ""},
+		{"P-384,SHA-512", "SHA-512", "P-384"},
+	}
+	for _, p := range params {
+		hash, curve := cavpParams(p.section)
+		if hash != p.hash || curve != p.curve {
+			t.Errorf("[%s]: expected %q %q, got %q %q", p.section, p.hash, p.curve, hash, curve)
+		}
+	}
+}
+
+func TestCAVPHash(t *testing.T) {
+	initForTesting("ECDSA")
+	Config.Timeout = 10
+	defer func() { Prog1, Config.Capabilities = "", nil }()
+
+	curve, _ := curveByName("secp256r1")
+	ints, _ := parseHex(Config.EcdsaX, Config.EcdsaY, Config.EcdsaD)
+	Config.Hash = "SHA-384"
+	hashed, _ := digest("deadc0de")
+	Config.Hash = ""
+	r, s, err := curve.sign(ints[2], hashed, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sample := fmt.Sprintf("[P-256,SHA-384]\n\nMsg = deadc0de\nQx = %s\nQy = %s\nR = %s\nS = %s\nResult = P\n",
+		Config.EcdsaX, Config.EcdsaY, r.Text(16), s.Text(16))
+	file := filepath.Join(t.TempDir(), "SigVer.rsp")
+	if err := os.WriteFile(file, []byte(sample), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// without -h, the built-in program has to be given the hash with -H
+	Prog1 = "builtin:ecdsa-p256-sha256"
+	Config.Capabilities = map[string]Capabilities{Prog1: {Hashes: signatureHashes}}
+	if err := TestCAVP(file, ""); err != nil {
+		t.Error("Expected the SHA-384 section to pass, got", err)
+	}
+}
+
+func TestCAVPHmac(t *testing.T) {
+	initForTesting("")
+	Config.Timeout = 10
+	defer func() { Prog1 = "" }()
+
+	mac := hmac.New(sha256.New, []byte{0x0b})
+	mac.Write([]byte{0x01})
+	sample := fmt.Sprintf("[L=20]\n\nCount = 0\nKlen = 1\nTlen = 20\nKey = 0b\nMsg = 01\nMac = 00\n\n"+
+		"[L=32]\n\nCount = 1\nKlen = 1\nTlen = 32\nKey = 0b\nMsg = 01\nMac = %x\n", mac.Sum(nil))
+	file := filepath.Join(t.TempDir(), "HMAC.rsp")
+	if err := os.WriteFile(file, []byte(sample), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the SHA-1 section is skipped, the program using the SHA-256 of config
+	Prog1 = "builtin:hmac-sha256"
+	if err := TestCAVP(file, ""); err != nil {
+		t.Error("Expected the SHA-1 section to be skipped, got", err)
+	}
+	if err := TestCAVP(file, "L=20"); err == nil {
+		t.Error("Expected no test case to run in the SHA-1 section")
+	}
+}
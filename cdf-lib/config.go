@@ -0,0 +1,67 @@
+package cdf
+
+import "fmt"
+
+// CheckConfig checks that Config can be used to test the given interface,
+// reporting all the problems found at once rather than failing in the middle
+// of a run. The keys must have been loaded from their files beforehand.
+func CheckConfig(interf string) error {
+	var errs MultiError
+	check := func(ok bool, format string, a ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, a...))
+		}
+	}
+
+	if _, ok := LookupInterface(interf); !ok {
+		return fmt.Errorf("unknown interface %q", interf)
+	}
+
+	check(Config.MinMsgLen >= 0 && Config.MinMsgLen <= Config.MaxMsgLen,
+		"minMsgLen (%d) and maxMsgLen (%d) must be such that 0 <= minMsgLen <= maxMsgLen",
+		Config.MinMsgLen, Config.MaxMsgLen)
+	switch interf {
+	case "enc", "xof", "rsaenc", "rsasign":
+		check(Config.IncrementMsg > 0, "incrementMsg must be positive")
+	}
+	switch interf {
+	case "enc", "prf":
+		check(Config.MinKeyLen > 0 && Config.MinKeyLen <= Config.MaxKeyLen,
+			"minKeyLen (%d) and maxKeyLen (%d) must be such that 0 < minKeyLen <= maxKeyLen",
+			Config.MinKeyLen, Config.MaxKeyLen)
+	case "rsaenc":
+		check(Config.MaxKeyLen >= 2, "maxKeyLen, the largest public exponent length, must be at least 2")
+	}
+	if interf == "enc" {
+		check(Config.IncrementKey > 0, "incrementKey must be positive")
+	}
+
+	check(Config.Timeout >= 0, "timeout must not be negative")
+	check(Config.TimeoutFactor >= 0 && Config.WarmupRuns >= 0,
+		"timeoutFactor and warmupRuns must not be negative")
+	check(Config.PropertyRuns >= 0 && Config.Reruns >= 0,
+		"propertyRuns and reruns must not be negative")
+	_, ok := configHash()
+	check(ok, "unsupported hash %q", Config.Hash)
+
+	switch interf {
+	case "rsaenc", "rsasign":
+		for _, bits := range Config.RsaKeySizes {
+			check(bits >= 128, "invalid RSA key size: %d", bits)
+		}
+	case "dsa":
+		for _, size := range Config.DsaKeySizes {
+			check(size.N >= 2 && size.N < size.L, "invalid DSA key size (%d, %d)", size.L, size.N)
+		}
+	case "ecdsa":
+		check(Config.EcdsaKeys >= 0, "ecdsaKeys must not be negative")
+	}
+	if err := ValidateKeys(interf); err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package cdf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckConfig(t *testing.T) {
+	initForTesting("ECDSA")
+	Config.Hash = "SHA-256"
+	if err := CheckConfig("ecdsa"); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	if err := CheckConfig("ecdh"); err == nil {
+		t.Error("Expected an error with an unknown interface")
+	}
+
+	saved := Config.MaxMsgLen
+	Config.MaxMsgLen, Config.Hash = 0, "MD9"
+	err := CheckConfig("xof")
+	Config.MaxMsgLen, Config.Hash = saved, "SHA-256"
+	if err == nil {
+		t.Fatal("Expected an error with an invalid config")
+	}
+	// all the problems are reported at once
+	for _, s := range []string{"maxMsgLen", "MD9"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("Expected %q to be reported in %v", s, err)
+		}
+	}
+}
+
+func TestInterfaces(t *testing.T) {
+	for _, i := range Interfaces {
+		if found, ok := LookupInterface(i.Name); !ok || found.Name != i.Name {
+			t.Errorf("Could not look up %s", i.Name)
+		}
+		for _, s := range i.SubTests {
+			if !strings.HasPrefix(s.Name, i.Name+".") {
+				t.Errorf("Sub-test %s should be prefixed with its interface", s.Name)
+			}
+		}
+	}
+}
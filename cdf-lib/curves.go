@@ -0,0 +1,438 @@
+package cdf
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+)
+
+// curveFlag is the flag selecting the curve of the programs which declare
+// several ones, followed by its name. It comes after -H and before -h.
+const curveFlag = "-C"
+
+// ecCurve is a short Weierstrass curve y² = x³ + ax + b over GF(p), whose base
+// point G is of prime order n, the curve having hn points. Its arithmetic uses
+// Jacobian coordinates, Go's implementation being used instead for the NIST
+// curves.
+type ecCurve struct {
+	name               string // as in the Wycheproof files
+	p, a, b, gx, gy, n *big.Int
+	h                  int64
+	std                elliptic.Curve
+}
+
+// EcdsaKey is an ECDSA key pair given as hex strings, as in Config
+type EcdsaKey struct {
+	X string `json:"x"`
+	Y string `json:"y"`
+	D string `json:"d"`
+}
+
+// ecCurves are the curves cdf knows the parameters of
+var ecCurves = []*ecCurve{
+	nistCurve("secp224r1", elliptic.P224()),
+	nistCurve("secp256r1", elliptic.P256()),
+	nistCurve("secp384r1", elliptic.P384()),
+	nistCurve("secp521r1", elliptic.P521()),
+	newCurve("secp224k1", "fffffffffffffffffffffffffffffffffffffffffffffffeffffe56d", "0", "5",
+		"a1455b334df099df30fc28a169a467e9e47075a90f7e650eb6b7a45c",
+		"7e089fed7fba344282cafbd6f7e319f7c0b0bd59e2ca4bdb556d61a5",
+		"010000000000000000000000000001dce8d2ec6184caf0a971769fb1f7"),
+	newCurve("secp256k1", "fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f", "0", "7",
+		"79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798",
+		"483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8",
+		"fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141"),
+	newCurve("brainpoolP224r1", "d7c134aa264366862a18302575d1d787b09f075797da89f57ec8c0ff",
+		"68a5e62ca9ce6c1c299803a6c1530b514e182ad8b0042a59cad29f43",
+		"2580f63ccfe44138870713b1a92369e33e2135d266dbb372386c400b",
+		"0d9029ad2c7e5cf4340823b2a87dc68c9e4ce3174c1e6efdee12c07d",
+		"58aa56f772c0726f24c6b89e4ecdac24354b9e99caa3f6d3761402cd",
+		"d7c134aa264366862a18302575d0fb98d116bc4b6ddebca3a5a7939f"),
+	newCurve("brainpoolP256r1", "a9fb57dba1eea9bc3e660a909d838d726e3bf623d52620282013481d1f6e5377",
+		"7d5a0975fc2c3057eef67530417affe7fb8055c126dc5c6ce94a4b44f330b5d9",
+		"26dc5c6ce94a4b44f330b5d9bbd77cbf958416295cf7e1ce6bccdc18ff8c07b6",
+		"8bd2aeb9cb7e57cb2c4b482ffc81b7afb9de27e1e3bd23c23a4453bd9ace3262",
+		"547ef835c3dac4fd97f8461a14611dc9c27745132ded8e545c1d54c72f046997",
+		"a9fb57dba1eea9bc3e660a909d838d718c397aa3b561a6f7901e0e82974856a7"),
+	newCurve("brainpoolP320r1", "d35e472036bc4fb7e13c785ed201e065f98fcfa6f6f40def4f92b9ec7893ec28fcd412b1f1b32e27",
+		"3ee30b568fbab0f883ccebd46d3f3bb8a2a73513f5eb79da66190eb085ffa9f492f375a97d860eb4",
+		"520883949dfdbc42d3ad198640688a6fe13f41349554b49acc31dccd884539816f5eb4ac8fb1f1a6",
+		"43bd7e9afb53d8b85289bcc48ee5bfe6f20137d10a087eb6e7871e2a10a599c710af8d0d39e20611",
+		"14fdd05545ec1cc8ab4093247f77275e0743ffed117182eaa9c77877aaac6ac7d35245d1692e8ee1",
+		"d35e472036bc4fb7e13c785ed201e065f98fcfa5b68f12a32d482ec7ee8658e98691555b44c59311"),
+	newCurve("brainpoolP384r1", "8cb91e82a3386d280f5d6f7e50e641df152f7109ed5456b412b1da197fb71123acd3a729901d1a71874700133107ec53",
+		"7bc382c63d8c150c3c72080ace05afa0c2bea28e4fb22787139165efba91f90f8aa5814a503ad4eb04a8c7dd22ce2826",
+		"04a8c7dd22ce28268b39b55416f0447c2fb77de107dcd2a62e880ea53eeb62d57cb4390295dbc9943ab78696fa504c11",
+		"1d1c64f068cf45ffa2a63a81b7c13f6b8847a3e77ef14fe3db7fcafe0cbd10e8e826e03436d646aaef87b2e247d4af1e",
+		"8abe1d7520f9c2a45cb1eb8e95cfd55262b70b29feec5864e19c054ff99129280e4646217791811142820341263c5315",
+		"8cb91e82a3386d280f5d6f7e50e641df152f7109ed5456b31f166e6cac0425a7cf3ab6af6b7fc3103b883202e9046565"),
+	newCurve("brainpoolP512r1", "aadd9db8dbe9c48b3fd4e6ae33c9fc07cb308db3b3c9d20ed6639cca703308717d4d9b009bc66842aecda12ae6a380e62881ff2f2d82c68528aa6056583a48f3",
+		"7830a3318b603b89e2327145ac234cc594cbdd8d3df91610a83441caea9863bc2ded5d5aa8253aa10a2ef1c98b9ac8b57f1117a72bf2c7b9e7c1ac4d77fc94ca",
+		"3df91610a83441caea9863bc2ded5d5aa8253aa10a2ef1c98b9ac8b57f1117a72bf2c7b9e7c1ac4d77fc94cadc083e67984050b75ebae5dd2809bd638016f723",
+		"81aee4bdd82ed9645a21322e9c4c6a9385ed9f70b5d916c1b43b62eef4d0098eff3b1f78e2d0d48d50d1687b93b97d5f7c6d5047406a5e688b352209bcb9f822",
+		"7dde385d566332ecc0eabfa9cf7822fdf209f70024a57b1aa000c55b881f8111b2dcde494a5f485e5bca4bd88a2763aed1ca2b2fa8f0540678cd1e0f3ad80892",
+		"aadd9db8dbe9c48b3fd4e6ae33c9fc07cb308db3b3c9d20ed6639cca70330870553e5c414ca92619418661197fac10471db1d381085ddaddb58796829ca90069"),
+	// Curve25519 in short Weierstrass form, the only one with a cofactor
+	withCofactor(newCurve("wei25519", "7fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffed",
+		"2aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa984914a144",
+		"7b425ed097b425ed097b425ed097b425ed097b425ed097b4260b5e9c7710c864",
+		"2aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaad245a",
+		"20ae19a1b8a086b4e01edd2c7748d14c923d4d7e6d7c61b229e9c5a27eced3d9",
+		"1000000000000000000000000000000014def9dea2f79cd65812631a5cf5d3ed"), 8),
+}
+
+// newCurve builds a curve from its hex parameters
+func newCurve(name, p, a, b, gx, gy, n string) *ecCurve {
+	return &ecCurve{name: name, p: fromBase16(p), a: fromBase16(a), b: fromBase16(b),
+		gx: fromBase16(gx), gy: fromBase16(gy), n: fromBase16(n), h: 1}
+}
+
+// withCofactor sets the cofactor of the curve
+func withCofactor(c *ecCurve, h int64) *ecCurve {
+	c.h = h
+	return c
+}
+
+// nistCurve builds a NIST curve, whose parameter a is -3, from Go's one
+func nistCurve(name string, std elliptic.Curve) *ecCurve {
+	params := std.Params()
+	return &ecCurve{name: name, p: params.P, a: new(big.Int).Sub(params.P, big.NewInt(3)),
+		b: params.B, gx: params.Gx, gy: params.Gy, n: params.N, h: 1, std: std}
+}
+
+// CurveNames returns the names of the curves cdf knows
+func CurveNames() []string {
+	names := make([]string, len(ecCurves))
+	for i, c := range ecCurves {
+		names[i] = c.name
+	}
+	return names
+}
+
+// curveByName returns the curve of the given name or alias
+func curveByName(name string) (*ecCurve, bool) {
+	for _, c := range ecCurves {
+		if curveName(c.name) == curveName(name) {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// curveOf returns the curve the point lies on, amongst the known ones
+func curveOf(x, y *big.Int) (*ecCurve, bool) {
+	for _, c := range ecCurves {
+		if c.onCurve(x, y) {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// keyCurve returns the curve of the ECDSA key of Config
+func keyCurve() (*ecCurve, bool) {
+	ints, ok := parseHex(Config.EcdsaX, Config.EcdsaY)
+	if !ok {
+		return nil, false
+	}
+	return curveOf(ints[0], ints[1])
+}
+
+// byteLen is the byte length of the coordinates
+func (c *ecCurve) byteLen() int {
+	return (c.p.BitLen() + 7) / 8
+}
+
+// orderLen is the byte length of the scalars, as r and s
+func (c *ecCurve) orderLen() int {
+	return (c.n.BitLen() + 7) / 8
+}
+
+// onCurve tells whether (x, y) is a point of the curve, with reduced
+// coordinates
+func (c *ecCurve) onCurve(x, y *big.Int) bool {
+	if x.Sign() < 0 || y.Sign() < 0 || x.Cmp(c.p) >= 0 || y.Cmp(c.p) >= 0 {
+		return false
+	}
+	left := new(big.Int).Mul(y, y)
+	right := new(big.Int).Mul(x, x)
+	right.Add(right, c.a).Mul(right, x).Add(right, c.b)
+	return left.Sub(left, right).Mod(left, c.p).Sign() == 0
+}
+
+// jacobian is the point (x/z², y/z³), the point at infinity having z = 0
+type jacobian struct {
+	x, y, z *big.Int
+}
+
+// toJacobian converts the affine point, the point at infinity being nil
+func toJacobian(x, y *big.Int) jacobian {
+	if x == nil {
+		return jacobian{new(big.Int), new(big.Int), new(big.Int)}
+	}
+	return jacobian{new(big.Int).Set(x), new(big.Int).Set(y), big.NewInt(1)}
+}
+
+// toAffine converts the point back, the point at infinity being nil
+func (c *ecCurve) toAffine(p jacobian) (*big.Int, *big.Int) {
+	if p.z.Sign() == 0 {
+		return nil, nil
+	}
+	zinv := new(big.Int).ModInverse(p.z, c.p)
+	zinv2 := new(big.Int).Mul(zinv, zinv)
+	x := new(big.Int).Mul(p.x, zinv2)
+	y := new(big.Int).Mul(p.y, zinv2.Mul(zinv2, zinv))
+	return x.Mod(x, c.p), y.Mod(y, c.p)
+}
+
+// double returns 2p
+func (c *ecCurve) double(p jacobian) jacobian {
+	if p.z.Sign() == 0 || p.y.Sign() == 0 {
+		return toJacobian(nil, nil)
+	}
+	yy := new(big.Int).Mul(p.y, p.y)
+	yy.Mod(yy, c.p)
+	zz := new(big.Int).Mul(p.z, p.z)
+	zz.Mod(zz, c.p)
+	// S = 4xy², M = 3x² + az⁴
+	s := new(big.Int).Mul(p.x, yy)
+	s.Lsh(s, 2).Mod(s, c.p)
+	m := new(big.Int).Mul(p.x, p.x)
+	m.Mul(m, big.NewInt(3))
+	m.Add(m, zz.Mul(zz, zz).Mul(zz, c.a)).Mod(m, c.p)
+	// x' = M² - 2S, y' = M(S - x') - 8y⁴, z' = 2yz
+	x := new(big.Int).Mul(m, m)
+	x.Sub(x, new(big.Int).Lsh(s, 1)).Mod(x, c.p)
+	y := new(big.Int).Sub(s, x)
+	y.Mul(y, m).Sub(y, yy.Mul(yy, yy).Lsh(yy, 3)).Mod(y, c.p)
+	z := new(big.Int).Mul(p.y, p.z)
+	z.Lsh(z, 1).Mod(z, c.p)
+	return jacobian{x, y, z}
+}
+
+// addJacobian returns p + q
+func (c *ecCurve) addJacobian(p, q jacobian) jacobian {
+	if p.z.Sign() == 0 {
+		return q
+	}
+	if q.z.Sign() == 0 {
+		return p
+	}
+	pz2 := new(big.Int).Mul(p.z, p.z)
+	qz2 := new(big.Int).Mul(q.z, q.z)
+	u1 := new(big.Int).Mul(p.x, qz2)
+	u1.Mod(u1, c.p)
+	u2 := new(big.Int).Mul(q.x, pz2)
+	u2.Mod(u2, c.p)
+	s1 := new(big.Int).Mul(p.y, qz2.Mul(qz2, q.z))
+	s1.Mod(s1, c.p)
+	s2 := new(big.Int).Mul(q.y, pz2.Mul(pz2, p.z))
+	s2.Mod(s2, c.p)
+	if u1.Cmp(u2) == 0 {
+		if s1.Cmp(s2) == 0 {
+			return c.double(p)
+		}
+		return toJacobian(nil, nil)
+	}
+	// H = u2 - u1, R = s2 - s1
+	h := u2.Sub(u2, u1)
+	r := s2.Sub(s2, s1)
+	hh := new(big.Int).Mul(h, h)
+	hhh := new(big.Int).Mul(h, hh)
+	v := hh.Mul(u1, hh)
+	// x' = R² - H³ - 2V, y' = R(V - x') - s1H³, z' = z1z2H
+	x := new(big.Int).Mul(r, r)
+	x.Sub(x, hhh).Sub(x, new(big.Int).Lsh(v, 1)).Mod(x, c.p)
+	y := v.Sub(v, x)
+	y.Mul(y, r).Sub(y, s1.Mul(s1, hhh)).Mod(y, c.p)
+	z := new(big.Int).Mul(p.z, q.z)
+	z.Mul(z, h).Mod(z, c.p)
+	return jacobian{x, y, z}
+}
+
+// add returns the sum of two points, the point at infinity being nil
+func (c *ecCurve) add(x1, y1, x2, y2 *big.Int) (*big.Int, *big.Int) {
+	return c.toAffine(c.addJacobian(toJacobian(x1, y1), toJacobian(x2, y2)))
+}
+
+// scalarMult returns k(x, y), by double and add
+func (c *ecCurve) scalarMult(x, y, k *big.Int) (*big.Int, *big.Int) {
+	p, r := toJacobian(x, y), toJacobian(nil, nil)
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		r = c.double(r)
+		if k.Bit(i) == 1 {
+			r = c.addJacobian(r, p)
+		}
+	}
+	return c.toAffine(r)
+}
+
+// baseMult returns kG
+func (c *ecCurve) baseMult(k *big.Int) (*big.Int, *big.Int) {
+	if c.std != nil {
+		return c.std.ScalarBaseMult(new(big.Int).Mod(k, c.n).Bytes())
+	}
+	return c.scalarMult(c.gx, c.gy, k)
+}
+
+// hashToInt converts a digest to an integer, keeping its leftmost bits up to
+// the bit length of n, as per SEC 1
+func (c *ecCurve) hashToInt(digest []byte) *big.Int {
+	if size := c.orderLen(); len(digest) > size {
+		digest = digest[:size]
+	}
+	z := new(big.Int).SetBytes(digest)
+	if excess := len(digest)*8 - c.n.BitLen(); excess > 0 {
+		z.Rsh(z, uint(excess))
+	}
+	return z
+}
+
+// digestOf returns the digest of the length of n whose truncation is z
+func (c *ecCurve) digestOf(z *big.Int) []byte {
+	shifted := new(big.Int).Lsh(z, uint(c.orderLen()*8-c.n.BitLen()))
+	return padTo(shifted.Bytes(), c.orderLen())
+}
+
+// inSubgroup tells whether the point of the curve is of order n, which only
+// needs to be checked on the curves with a cofactor
+func (c *ecCurve) inSubgroup(x, y *big.Int) bool {
+	if c.h == 1 {
+		return true
+	}
+	nx, _ := c.scalarMult(x, y, c.n)
+	return nx == nil
+}
+
+// verify checks the ECDSA signature (r, s) of the digest under (x, y)
+func (c *ecCurve) verify(x, y *big.Int, digest []byte, r, s *big.Int) bool {
+	if c.std != nil {
+		return ecdsa.Verify(&ecdsa.PublicKey{Curve: c.std, X: x, Y: y}, digest, r, s)
+	}
+	if !c.onCurve(x, y) || !c.inSubgroup(x, y) ||
+		r.Sign() <= 0 || s.Sign() <= 0 || r.Cmp(c.n) >= 0 || s.Cmp(c.n) >= 0 {
+		return false
+	}
+	// the order of forged parameters may be composite
+	w := new(big.Int).ModInverse(s, c.n)
+	if w == nil {
+		return false
+	}
+	u1 := new(big.Int).Mul(c.hashToInt(digest), w)
+	u2 := new(big.Int).Mul(r, w)
+	x1, y1 := c.scalarMult(c.gx, c.gy, u1.Mod(u1, c.n))
+	x2, y2 := c.scalarMult(x, y, u2.Mod(u2, c.n))
+	rx, _ := c.add(x1, y1, x2, y2)
+	return rx != nil && rx.Mod(rx, c.n).Cmp(r) == 0
+}
+
+// sign returns an ECDSA signature of the digest with the private key d, the
+// nonces and the signatures which are not invertible modulo n being skipped
+func (c *ecCurve) sign(d *big.Int, digest []byte, random io.Reader) (r, s *big.Int, err error) {
+	if c.std != nil {
+		x, y := c.std.ScalarBaseMult(d.Bytes())
+		return ecdsa.Sign(random, &ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: c.std, X: x, Y: y}, D: d}, digest)
+	}
+	if d.Sign() <= 0 || d.Cmp(c.n) >= 0 {
+		return nil, nil, errors.New("invalid private key")
+	}
+	z := c.hashToInt(digest)
+	for {
+		k, err := rand.Int(random, c.n)
+		if err != nil {
+			return nil, nil, err
+		}
+		kInv := new(big.Int).ModInverse(k, c.n)
+		if k.Sign() == 0 || kInv == nil {
+			continue
+		}
+		rx, _ := c.scalarMult(c.gx, c.gy, k)
+		r = rx.Mod(rx, c.n)
+		if r.Sign() == 0 {
+			continue
+		}
+		s = new(big.Int).Mul(r, d)
+		s.Add(s, z).Mul(s, kInv).Mod(s, c.n)
+		if new(big.Int).ModInverse(s, c.n) != nil {
+			return r, s, nil
+		}
+	}
+}
+
+// validate checks that the public key is a point of a known curve and that it
+// is the one of the private key, returning its curve
+func (k EcdsaKey) validate() (*ecCurve, error) {
+	ints, ok := parseHex(k.X, k.Y, k.D)
+	if !ok {
+		return nil, errors.New("the ECDSA key fields must all be set as hex strings")
+	}
+	x, y, d := ints[0], ints[1], ints[2]
+	curve, ok := curveOf(x, y)
+	if !ok {
+		return nil, errors.New("ECDSA key: the public key is not on a supported curve")
+	}
+	if d.Sign() <= 0 || d.Cmp(curve.n) >= 0 {
+		return nil, errors.New("ECDSA key: D is not in [1, n-1]")
+	}
+	if qx, qy := curve.baseMult(d); qx == nil || qx.Cmp(x) != 0 || qy.Cmp(y) != 0 {
+		return nil, errors.New("ECDSA key: Q != dG")
+	}
+	return curve, nil
+}
+
+// curveSupported tells whether both programs support the curve, recording
+// the tests on it as skipped otherwise
+func curveSupported(name string) bool {
+	return capable("curve "+name, "the curve "+name,
+		func(c Capabilities) bool { return c.SupportsCurve(name) }, Prog1, Prog2)
+}
+
+// selectCurve passes the curve with -C to the programs declaring several
+// curves
+func selectCurve(name string) {
+	args := make(map[string][]string)
+	for _, prog := range testedProgs() {
+		if len(ProgramCapabilities(prog).Curves) > 1 {
+			args[prog] = []string{curveFlag, name}
+		}
+	}
+	selected.Lock()
+	selected.curve, selected.curveName = args, name
+	selected.Unlock()
+}
+
+// selectedCurve returns the name of the curve selected, if any
+func selectedCurve() string {
+	selected.RLock()
+	defer selected.RUnlock()
+	return selected.curveName
+}
+
+// checkCurves checks the curves and the keys per curve of Config
+func checkCurves() error {
+	var errs MultiError
+	for _, name := range Config.Curves {
+		if _, ok := curveByName(name); !ok {
+			errs = append(errs, fmt.Errorf("unknown curve %s, expected one of %s", name,
+				strings.Join(CurveNames(), ", ")))
+		}
+	}
+	for name, key := range Config.EcdsaCurveKeys {
+		curve, err := key.validate()
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("the key of %s: %v", name, err))
+		case curveName(curve.name) != curveName(name):
+			errs = append(errs, fmt.Errorf("the key of %s is on %s", name, curve.name))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
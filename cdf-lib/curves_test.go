@@ -0,0 +1,95 @@
+package cdf
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"math/big"
+	"testing"
+)
+
+func TestCurves(t *testing.T) {
+	for _, curve := range ecCurves {
+		if !curve.onCurve(curve.gx, curve.gy) {
+			t.Errorf("%s: G is not on the curve", curve.name)
+		}
+		if !curve.n.ProbablyPrime(20) {
+			t.Errorf("%s: n is not prime", curve.name)
+		}
+		// the textbook arithmetic is checked against Go's on the NIST curves
+		generic := *curve
+		generic.std = nil
+		if x, _ := generic.scalarMult(curve.gx, curve.gy, curve.n); x != nil {
+			t.Errorf("%s: nG is not the point at infinity", curve.name)
+		}
+		k := big.NewInt(0xc0ffee)
+		x1, y1 := generic.baseMult(k)
+		x2, y2 := curve.baseMult(k)
+		if x1.Cmp(x2) != 0 || y1.Cmp(y2) != 0 || !curve.onCurve(x1, y1) {
+			t.Errorf("%s: inconsistent scalar multiplications", curve.name)
+		}
+
+		// a SHA-512 digest is longer than most orders, and truncated
+		d := new(big.Int).Sub(curve.n, big.NewInt(2))
+		x, y := curve.baseMult(d)
+		digest := sha512.Sum512([]byte("CCC"))
+		r, s, err := generic.sign(d, digest[:], rand.Reader)
+		if err != nil {
+			t.Fatalf("%s: %v", curve.name, err)
+		}
+		if !curve.verify(x, y, digest[:], r, s) || !generic.verify(x, y, digest[:], r, s) {
+			t.Errorf("%s: the signature is not valid", curve.name)
+		}
+		if generic.verify(x, y, digest[1:], r, s) {
+			t.Errorf("%s: the signature of another digest is valid", curve.name)
+		}
+	}
+}
+
+func TestDigestOf(t *testing.T) {
+	curve, _ := curveByName("P-521")
+	digest := curve.digestOf(curve.n)
+	if len(digest) != 66 || curve.hashToInt(digest).Cmp(curve.n) != 0 {
+		t.Errorf("Expected a 66-byte digest truncated to n, got %x", digest)
+	}
+	if c, ok := curveByName("prime256v1"); !ok || c.name != "secp256r1" {
+		t.Error("Expected prime256v1 to be an alias of secp256r1")
+	}
+}
+
+func TestEcdsaTestKeys(t *testing.T) {
+	initForTesting("ECDSA")
+	Config.Curves, Config.EcdsaKeys = []string{"secp384r1", "P-256", "secp256k1"}, 1
+	defer func() { Config.Curves, Config.EcdsaKeys = nil, 0 }()
+	x, y, d := Config.EcdsaX, Config.EcdsaY, Config.EcdsaD
+
+	keys := TestKeys("ecdsa")
+	names := []string{"ecdsa-secp384r1", "ecdsa-secp384r1-1", "config.json", "ecdsa-secp256r1-1",
+		"ecdsa-secp256k1", "ecdsa-secp256k1-1"}
+	if len(keys) != len(names) {
+		t.Fatalf("Expected %d keys, got %d", len(names), len(keys))
+	}
+	for i, key := range keys {
+		if key.Name != names[i] {
+			t.Errorf("Expected the key %s, got %s", names[i], key.Name)
+		}
+		key.Use()
+		curve, err := EcdsaKey{Config.EcdsaX, Config.EcdsaY, Config.EcdsaD}.validate()
+		if err != nil {
+			t.Errorf("Invalid key %s: %v", key.Name, err)
+		} else if c, _ := keyCurve(); c != curve {
+			t.Errorf("Expected the key %s to be on its curve", key.Name)
+		}
+	}
+	// the key of config.json is set back when used
+	keys[2].Use()
+	if Config.EcdsaX != x || Config.EcdsaY != y || Config.EcdsaD != d {
+		t.Error("Expected the key of config.json to be used")
+	}
+
+	Config.Curves = []string{"secp521r1"}
+	Config.EcdsaCurveKeys = map[string]EcdsaKey{"P-521": {X: x, Y: y, D: d}}
+	defer func() { Config.EcdsaCurveKeys = nil }()
+	if err := checkCurves(); err == nil {
+		t.Error("Expected the P-256 key given for P-521 to be rejected")
+	}
+}
@@ -0,0 +1,317 @@
+package cdf
+
+import (
+	"crypto/dsa"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+// derFlag precedes the arguments of the verifications given to the programs
+// declaring DER signatures, the signature being then a single hex DER
+// SEQUENCE of r and s in place of them: without it, a verification would take
+// as many arguments as a signing. It comes after -C, before -h or -P.
+const derFlag = "-D"
+
+// derVerifyArgs is the number of arguments, flags aside, of the verifications
+// of the interfaces whose signatures may be DER encoded, the r and s of which
+// precede the message
+var derVerifyArgs = map[string]int{"ecdsa": 5, "dsa": 7}
+
+// derSignatures tells whether a program outputs and verifies DER signatures
+func derSignatures(c Capabilities) bool {
+	return c.DER
+}
+
+// usesDER tells whether prog is to be given DER signatures by the tests of
+// the current interface
+func usesDER(prog string) bool {
+	_, ok := derVerifyArgs[Interf]
+	return ok && ProgramCapabilities(prog).DER
+}
+
+// derArgs converts the r and s of the arguments of a verification into the
+// DER signature given with -D. The arguments of a signing, or already given
+// with -D, are left as they are.
+func derArgs(args []string) []string {
+	if len(args) > 0 && args[0] == derFlag {
+		return args
+	}
+	flags := 0
+	switch {
+	case len(args) >= 2 && args[0] == "-h":
+		flags = 2
+	case len(args) >= 8 && args[0] == explicitFlag:
+		flags = 8
+	}
+	n := len(args)
+	if n-flags != derVerifyArgs[Interf] {
+		return args
+	}
+	ints, ok := parseHex(args[n-3], args[n-2])
+	if !ok {
+		return args
+	}
+	sig, ok := derSignatureHex(ints[0], ints[1])
+	if !ok {
+		return args
+	}
+	return withArgs(append([]string{derFlag}, args[:n-3]...), sig, args[n-1])
+}
+
+// derOutput converts a DER signature output by a signer into its r and s on
+// two lines, as the tests expect them. Any other output, including signatures
+// which are not strict DER, is left as is.
+func derOutput(out string) string {
+	r, s, err := parseDERSignature(strings.TrimSpace(out))
+	if err != nil {
+		return out
+	}
+	return hex.EncodeToString(padTo(r.Bytes(), 1)) + "\n" + hex.EncodeToString(padTo(s.Bytes(), 1))
+}
+
+// derLength encodes the length of a DER content, in the short form below 128
+func derLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
+
+// nonMinimalLength encodes the length n on one more byte than needed, which
+// BER allows but not DER
+func nonMinimalLength(n int) []byte {
+	l := derLength(n)
+	if len(l) == 1 {
+		return []byte{0x81, byte(n)}
+	}
+	return append([]byte{l[0] + 1, 0}, l[1:]...)
+}
+
+// derInteger returns the content of the DER INTEGER v, its minimal two's
+// complement
+func derInteger(v *big.Int) []byte {
+	if v.Sign() >= 0 {
+		b := v.Bytes()
+		if len(b) == 0 || b[0]&0x80 != 0 {
+			b = append([]byte{0}, b...)
+		}
+		return b
+	}
+	// -|v| is 2^8k - |v| on the k bytes of |v|, unless its top bit is clear
+	k := len(v.Bytes())
+	c := new(big.Int).Lsh(big.NewInt(1), uint(8*k))
+	b := padTo(c.Add(c, v).Bytes(), k)
+	if b[0]&0x80 == 0 {
+		b = append([]byte{0xff}, b...)
+	}
+	return b
+}
+
+// tlv returns the tag, length and content of a DER element
+func tlv(tag byte, content []byte) []byte {
+	return append(append([]byte{tag}, derLength(len(content))...), content...)
+}
+
+// derCase is an encoding of a signature given to the verifiers, only the
+// genuine DER one being valid
+type derCase struct {
+	name string
+	der  []byte
+	flag string // the Wycheproof flag of its vector
+}
+
+// derCases returns the DER encoding of the signature (r, s), followed by the
+// encodings the verifiers must reject:
+//   - BER ones, with an indefinite or a non-minimal length;
+//   - r and s padded with a superfluous zero byte, which BER forbids too
+//     (X.690 8.3.2), so they are invalid encodings and not BER ones;
+//   - r as -r and s as s - n, which a verifier taking the absolute value or
+//     reducing modulo n would accept, and r without the zero byte its top bit
+//     requires, read as negative, if it has one;
+//   - trailing bytes after the signature;
+//   - a SET or a primitive tag instead of the SEQUENCE one.
+func derCases(r, s, n *big.Int) []derCase {
+	ri, si := tlv(0x02, derInteger(r)), tlv(0x02, derInteger(s))
+	ints := append(append([]byte(nil), ri...), si...)
+	der := tlv(0x30, ints)
+	seq := func(tag byte, length []byte, content ...[]byte) []byte {
+		b := append([]byte{tag}, length...)
+		for _, c := range content {
+			b = append(b, c...)
+		}
+		return b
+	}
+	padded := func(i []byte) []byte {
+		return tlv(0x02, append([]byte{0}, i[2:]...))
+	}
+	const ber, invalid = "BerEncodedSignature", "InvalidEncoding"
+	cases := []derCase{
+		{"DER", der, ""},
+		{"indefinite length", seq(0x30, []byte{0x80}, ints, []byte{0, 0}), ber},
+		{"non-minimal length of the sequence", seq(0x30, nonMinimalLength(len(ints)), ints), ber},
+		{"non-minimal length of r", tlv(0x30, seq(0x02, nonMinimalLength(len(ri)-2), ri[2:], si)), ber},
+		{"r padded with a zero byte", tlv(0x30, append(padded(ri), si...)), invalid},
+		{"s padded with a zero byte", tlv(0x30, append(append([]byte(nil), ri...), padded(si)...)), invalid},
+		{"negative r", tlv(0x30, append(tlv(0x02, derInteger(new(big.Int).Neg(r))), si...)), invalid},
+		{"s - n", tlv(0x30, append(append([]byte(nil), ri...), tlv(0x02, derInteger(new(big.Int).Sub(s, n)))...)), invalid},
+	}
+	if b := r.Bytes(); len(b) > 0 && b[0]&0x80 != 0 {
+		cases = append(cases, derCase{"r without its sign byte", tlv(0x30, append(tlv(0x02, b), si...)), invalid})
+	}
+	return append(cases,
+		derCase{"trailing zero byte", seq(0x30, der[1:], []byte{0}), invalid},
+		derCase{"trailing garbage", seq(0x30, der[1:], []byte{0xde, 0xad, 0xbe, 0xef}), invalid},
+		derCase{"SET tag", seq(0x31, der[1:]), invalid},
+		derCase{"primitive SEQUENCE tag", seq(0x10, der[1:]), invalid})
+}
+
+// testDER gives the verifiers declaring DER signatures, with -D, the derCases
+// of a signature of msg made by sign under key. The DER encoding must be
+// accepted, the other ones are reported when accepted, and are findings when
+// the verifiers differ on them. The signatures whose r has its top bit set are
+// preferred, for them to need a sign byte.
+func testDER(test string, key []string, msg string, n *big.Int,
+	sign func() (r, s *big.Int, err error),
+	vector func(r, s, comment, flag string) (testVector, bool)) error {
+	var progs []string
+	for _, prog := range []string{Prog1, Prog2} {
+		if capable(test, "DER signatures", derSignatures, prog) {
+			progs = append(progs, prog)
+		}
+	}
+	if len(progs) == 0 {
+		return nil
+	}
+	var r, s *big.Int
+	for i := 0; i < 32 && (r == nil || r.Bytes()[0]&0x80 == 0); i++ {
+		var err error
+		if r, s, err = sign(); err != nil {
+			return err
+		}
+	}
+	cases := derCases(r, s, n)
+	rHex, sHex := hex.EncodeToString(r.Bytes()), hex.EncodeToString(s.Bytes())
+	LogInfo.Printf("testing %d encodings of a signature against the DER verifiers.\n", len(cases))
+
+	var accepted sync.Map
+	jobs := newJobGroup(test, len(progs))
+	for _, prog := range progs {
+		prog := prog
+		jobs.Go(func() error {
+			var lax []string
+			byCase := make(map[string]bool)
+			for _, c := range cases {
+				sig := hex.EncodeToString(c.der)
+				out, err := runProg(prog, test+"#"+c.name+"_"+prog, withArgs(append([]string{derFlag}, key...), sig, msg))
+				ok := err == nil && out == trueStr
+				byCase[c.name] = ok
+				if c.flag == "" {
+					continue
+				}
+				v, vok := vector(rHex, sHex, "signature encoded with "+c.name, c.flag)
+				v.test.Sig = sig
+				if !ok {
+					addGeneratedVector(v, vok)
+					continue
+				}
+				lax = append(lax, c.name)
+				v.test.Comment = prog + " accepted a " + v.test.Comment
+				addVector(v, vok)
+			}
+			accepted.Store(prog, byCase)
+			if !byCase["DER"] {
+				LogError.Printf("%s rejected a valid DER signature.\n", prog)
+				addFinding(Finding{Test: test, Progs: []string{prog},
+					Inputs:  withArgs(append([]string{derFlag}, key...), hex.EncodeToString(cases[0].der), msg),
+					Message: "rejected a valid DER signature"})
+				return fmt.Errorf("%s rejected a valid DER signature", prog)
+			}
+			if len(lax) > 0 {
+				LogWarning.Printf("%s accepted signatures which are not DER: %s.\n", prog, strings.Join(lax, ", "))
+			} else {
+				LogSuccess.Printf("%s only accepted the DER signature.\n", prog)
+			}
+			return nil
+		})
+	}
+	err := jobs.Wait()
+	var mainErr MultiError
+	if err != nil {
+		mainErr = append(mainErr, err.(MultiError)...)
+	}
+
+	// the encodings on which the verifiers differ
+	if len(progs) == 2 && progs[0] != progs[1] {
+		a1, ok1 := accepted.Load(progs[0])
+		a2, ok2 := accepted.Load(progs[1])
+		var differ []string
+		for _, c := range cases {
+			if ok1 && ok2 && a1.(map[string]bool)[c.name] != a2.(map[string]bool)[c.name] {
+				differ = append(differ, c.name)
+				by := progs[0]
+				if a2.(map[string]bool)[c.name] {
+					by = progs[1]
+				}
+				LogError.Printf("only %s accepted the signature encoded with %s.\n", by, c.name)
+				addFinding(Finding{Test: test, Progs: progs,
+					Inputs:  withArgs(append([]string{derFlag}, key...), hex.EncodeToString(c.der), msg),
+					Message: fmt.Sprintf("signature encoded with %s only accepted by %s", c.name, by)})
+			}
+		}
+		if len(differ) > 0 {
+			mainErr = append(mainErr, fmt.Errorf("the DER verifiers differ on the encodings: %s",
+				strings.Join(differ, ", ")))
+		}
+	}
+	if len(mainErr) > 0 {
+		return mainErr
+	}
+	return nil
+}
+
+// testEcdsaDER runs testDER on a signature by the ECDSA key of Config
+func testEcdsaDER() error {
+	curve, ok := keyCurve()
+	if !ok {
+		return errors.New("the ECDSA key is not on a known curve")
+	}
+	msg := "DEADC0DE"
+	hashed, ok := digest(msg)
+	if !ok {
+		return fmt.Errorf("unsupported hash %s", hashName())
+	}
+	d, _ := parseHex(Config.EcdsaD)
+	return testDER("ecdsa.der", []string{Config.EcdsaX, Config.EcdsaY}, msg, curve.n,
+		func() (*big.Int, *big.Int, error) { return curve.sign(d[0], hashed, rand.Reader) },
+		func(r, s, comment, flag string) (testVector, bool) {
+			return ecdsaVector(Config.EcdsaX, Config.EcdsaY, r, s, msg, wycheInvalid, comment, flag)
+		})
+}
+
+// testDsaDER runs testDER on a signature by the DSA key of Config
+func testDsaDER() error {
+	msg := "DEADC0DE"
+	hashed, ok := digest(msg)
+	if !ok {
+		return fmt.Errorf("unsupported hash %s", hashName())
+	}
+	priv := configDsaKey()
+	// the digest is truncated to the byte length of Q, as per FIPS 186-4
+	if size := (priv.Q.BitLen() + 7) / 8; len(hashed) > size {
+		hashed = hashed[:size]
+	}
+	return testDER("dsa.der", []string{Config.DsaP, Config.DsaQ, Config.DsaG, Config.DsaY}, msg, priv.Q,
+		func() (*big.Int, *big.Int, error) { return dsa.Sign(rand.Reader, priv, hashed) },
+		func(r, s, comment, flag string) (testVector, bool) {
+			return dsaVector(Config.DsaP, Config.DsaQ, Config.DsaG, Config.DsaY, r, s, msg, wycheInvalid, comment, flag)
+		})
+}
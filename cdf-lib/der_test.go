@@ -0,0 +1,134 @@
+package cdf
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"encoding/hex"
+	"math/big"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDerInteger(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	values := []int64{0, 1, -1, 127, 128, -128, -129, 255, 256, -256, -32768, -32769}
+	for i := 0; i < 100; i++ {
+		values = append(values, rng.Int63()>>uint(rng.Intn(63))*int64(1-2*rng.Intn(2)))
+	}
+	for _, v := range values {
+		expected, _ := asn1.Marshal(big.NewInt(v))
+		if got := tlv(0x02, derInteger(big.NewInt(v))); !bytes.Equal(got, expected) {
+			t.Errorf("%d: expected %x, got %x", v, expected, got)
+		}
+	}
+	if l := nonMinimalLength(0x8b); !bytes.Equal(l, []byte{0x82, 0, 0x8b}) {
+		t.Errorf("Unexpected non-minimal length %x", l)
+	}
+}
+
+func TestDerCases(t *testing.T) {
+	curve, _ := curveByName("secp521r1")
+	r, _ := new(big.Int).SetString("8f"+"00112233445566778899aabbccddeeff", 16)
+	s := new(big.Int).Sub(curve.n, big.NewInt(1))
+	cases := derCases(r, s, curve.n)
+	if len(cases) != 13 {
+		t.Fatalf("Expected 13 cases, got %d", len(cases))
+	}
+	for i, c := range cases {
+		cr, cs, err := parseDERSignature(hex.EncodeToString(c.der))
+		if valid := err == nil && cr.Cmp(r) == 0 && cs.Cmp(s) == 0; valid != (i == 0) {
+			t.Errorf("%s: unexpected validity %v: %v", c.name, valid, err)
+		}
+		// BER requires minimal integers as DER does
+		if strings.HasSuffix(c.name, "padded with a zero byte") && c.flag != "InvalidEncoding" {
+			t.Errorf("%s: expected an invalid encoding, got %s", c.name, c.flag)
+		}
+	}
+	// the r of P-521 signatures never has its top bit set
+	if len(derCases(big.NewInt(1), s, curve.n)) != 12 {
+		t.Error("Expected no case without the sign byte of r")
+	}
+}
+
+func TestDerArgs(t *testing.T) {
+	defer func() { Interf = "" }()
+	Interf = "ecdsa"
+	sig, _ := derSignatureHex(big.NewInt(0x80), big.NewInt(2))
+	for _, c := range []struct{ args, expected []string }{
+		{[]string{"x", "y", "d", "m"}, []string{"x", "y", "d", "m"}},
+		{[]string{"01", "02", "80", "2", "m"}, []string{derFlag, "01", "02", sig, "m"}},
+		{[]string{"-h", "aa", "01", "02", "80", "02", "m"}, []string{derFlag, "-h", "aa", "01", "02", sig, "m"}},
+		{[]string{derFlag, "01", "02", "30", "m"}, []string{derFlag, "01", "02", "30", "m"}},
+	} {
+		if got := derArgs(c.args); !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("%v: expected %v, got %v", c.args, c.expected, got)
+		}
+	}
+	if out := derOutput(sig + "\n"); out != "80\n02" {
+		t.Errorf("Unexpected conversion of %s: %q", sig, out)
+	}
+	if out := derOutput("3006020180020102"); out != "3006020180020102" {
+		t.Errorf("Unexpected conversion of a negative r: %q", out)
+	}
+}
+
+func TestDER(t *testing.T) {
+	for _, interf := range []string{"ecdsa", "dsa"} {
+		// the DER built-in programs interoperate with the other ones
+		der := Builtins(interf)[1]
+		withBuiltins(t, interf, der, Builtins(interf)[0])
+		test, key := testEcdsaDER, []string{Config.EcdsaX, Config.EcdsaY, Config.EcdsaD}
+		if interf == "dsa" {
+			test, key = testDsaDER, []string{Config.DsaP, Config.DsaQ, Config.DsaG, Config.DsaY, Config.DsaX}
+		}
+		out, err := runProg(Prog1, "test", withArgs(key, "abcd"))
+		r, s, ok := splitSignature(out)
+		if err != nil || !ok {
+			t.Fatalf("%s: unexpected signature %q: %v", der, out, err)
+		}
+		for _, prog := range []string{Prog1, Prog2} {
+			if out, err := runProg(prog, "test", withArgs(key[:len(key)-1], r, s, "abcd")); err != nil || out != trueStr {
+				t.Errorf("%s rejected the signature of %s: %s %v", prog, der, out, err)
+			}
+		}
+
+		// and only accept strict DER
+		Prog2 = der
+		if err := test(); err != nil {
+			t.Errorf("%s: %v", interf, err)
+		}
+	}
+}
+
+// trailingDER is builtin:ecdsa-p256-sha256-der ignoring the bytes after the
+// signature given with -D
+func trailingDER(args []string) (string, error) {
+	if len(args) != 5 || args[0] != derFlag {
+		return builtins["ecdsa-p256-sha256-der"].run(args)
+	}
+	der, err := hex.DecodeString(args[3])
+	if err != nil {
+		return "", err
+	}
+	var sig derSignature
+	if _, err := asn1.Unmarshal(der, &sig); err != nil {
+		return "", err
+	}
+	strict, _ := derSignatureHex(sig.R, sig.S)
+	return builtins["ecdsa-p256-sha256-der"].run(withArgs(args[:3], strict, args[4]))
+}
+
+func TestDERTrailing(t *testing.T) {
+	trailing := registerBuiltin(t, "ecdsa-trailing-der", "ecdsa-p256-sha256-der", trailingDER)
+	withBuiltins(t, "ecdsa", trailing, "builtin:ecdsa-p256-sha256-der")
+	if err := testEcdsaDER(); err == nil {
+		t.Fatal("Expected the verifiers to differ")
+	}
+	for _, name := range []string{"trailing zero byte", "trailing garbage"} {
+		if !hasFinding(trailing, "signature encoded with "+name+" only accepted by "+trailing) {
+			t.Errorf("Expected a finding on the %s, got %v", name, Findings())
+		}
+	}
+}
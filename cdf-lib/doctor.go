@@ -0,0 +1,482 @@
+package cdf
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// the inputs of the probes, the message being longer than the key so that
+// both can be told apart when swapped. The invalid message differs from it by
+// its last byte.
+const (
+	doctorKey        = "000102030405060708090a0b0c0d0e0f"
+	doctorMsg        = "4343434343434343434343434343434343434343434343434343434343434343"
+	doctorInvalidMsg = "4343434343434343434343434343434343434343434343434343434343434344"
+	doctorRunID      = "doctor"
+)
+
+// doctorArg is an argument of a probe, named as in the interface's i/o
+type doctorArg struct {
+	name  string
+	value string
+}
+
+// doctorProbe is a run of the probed program on valid inputs, along with the
+// check of its output
+type doctorProbe struct {
+	desc  string
+	flags []string // the flags preceding the arguments, such as -h digest
+	args  []doctorArg
+	lines int // the number of hex values output, 0 for a truth value
+	check func(out []string) bool
+}
+
+// doctor holds the state of the probing of a program
+type doctor struct {
+	prog     string
+	ref      string // the built-in program giving the known answers
+	role     int
+	problems MultiError
+}
+
+// Doctor probes prog against the i/o contract of the interface: it runs it on
+// known answers of the interface's built-in program, computed with the keys of
+// Config, and explains what is wrong with the order of its arguments, the
+// format of its output, its exit code on failure or its support of -h, which
+// is only probed if the program supports it. role restricts the probes to the
+// operation of the first or of the second program of the interface, 0 probing
+// both. It returns the problems found.
+func Doctor(interf, prog string, role int) error {
+	refs := Builtins(interf)
+	if len(refs) == 0 {
+		return fmt.Errorf("no built-in program implements %s", interf)
+	}
+	d := &doctor{prog: prog, ref: refs[0], role: role}
+	LogInfo.Printf("probing %s as a %s program, with %s as reference\n", prog, interf, d.ref)
+
+	switch interf {
+	case "dsa":
+		pub := []doctorArg{{"p", Config.DsaP}, {"q", Config.DsaQ}, {"g", Config.DsaG}, {"y", Config.DsaY}}
+		d.signatures(append(pub, doctorArg{"x", Config.DsaX}), pub, true, "r", "s")
+	case "ecdsa":
+		pub := []doctorArg{{"x", Config.EcdsaX}, {"y", Config.EcdsaY}}
+		d.signatures(append(pub, doctorArg{"d", Config.EcdsaD}), pub, true, "r", "s")
+	case "rsasign":
+		d.signatures([]doctorArg{{"p", Config.RsaP}, {"q", Config.RsaQ}, {"e", Config.RsaE}, {"d", Config.RsaD}},
+			[]doctorArg{{"n", Config.RsaN}, {"e", Config.RsaE}}, false, "sig")
+	case "enc":
+		key := []doctorArg{{"k", doctorKey}}
+		d.encryption(key, key, doctorMsg, false)
+	case "rsaenc":
+		d.encryption([]doctorArg{{"n", Config.RsaN}, {"e", Config.RsaE}},
+			[]doctorArg{{"p", Config.RsaP}, {"q", Config.RsaQ}, {"e", Config.RsaE}, {"d", Config.RsaD}},
+			doctorMsg[:32], true)
+	case "prf":
+		d.computation(doctorArg{"k", doctorKey}, doctorArg{"m", doctorMsg})
+	case "xof":
+		d.computation(doctorArg{"m", doctorMsg})
+	}
+
+	if len(d.problems) > 0 {
+		return d.problems
+	}
+	return nil
+}
+
+// problem records and reports a problem of the program
+func (d *doctor) problem(format string, a ...interface{}) {
+	err := fmt.Errorf(format, a...)
+	LogWarning.Println(err)
+	d.problems = append(d.problems, err)
+}
+
+// reference returns the output of the built-in program on the given arguments
+func (d *doctor) reference(flags []string, args []doctorArg) []string {
+	out, err := runBuiltin(d.ref, doctorRunID, append(append([]string(nil), flags...), argValues(args)...))
+	if err != nil {
+		return nil
+	}
+	return strings.Split(out, "\n")
+}
+
+// probe runs the program on the probe's inputs, reporting the problems of its
+// output. It returns the output if it could be parsed, even if it failed its
+// check, in which case the programs may not implement the same primitive.
+func (d *doctor) probe(p doctorProbe) ([]string, bool) {
+	raw, err := runProgRaw(d.prog, doctorRunID, append(append([]string(nil), p.flags...), argValues(p.args)...))
+	if _, ok := err.(hangError); ok {
+		d.problem("%s: %v", p.desc, err)
+		return nil, false
+	}
+	var out []string
+	if err == nil {
+		var issues []string
+		var upper bool
+		out, issues, upper = parseOutput(raw, p.lines)
+		for _, issue := range issues {
+			d.problem("%s: %s %s", p.desc, d.prog, issue)
+		}
+		if upper {
+			LogInfo.Printf("%s: %s prints uppercase hex, which cdf lowercases\n", p.desc, d.prog)
+		}
+		if p.valid(out) {
+			LogSuccess.Printf("%s: the output of %s is right\n", p.desc, d.prog)
+			return out, true
+		}
+	}
+
+	// the arguments may be expected in another order
+	if names, ok := d.reordered(p); ok {
+		d.problem("%s: %s expects its arguments as %s instead of %s", p.desc, d.prog,
+			strings.Join(names, " "), strings.Join(argNames(p.args), " "))
+		return nil, false
+	}
+	if err != nil && strings.Contains(strings.ToLower(raw), "fail") {
+		LogInfo.Printf("%s: %s failed on the inputs of %s, which is expected only if it implements another primitive (e.g. with another hash)\n",
+			p.desc, d.prog, d.ref)
+		return nil, false
+	}
+	if err != nil {
+		d.problem("%s: %s exited with an error (%v) on valid inputs, it printed: %s", p.desc, d.prog,
+			err, strings.TrimSpace(raw))
+		return nil, false
+	}
+	if len(out) == 0 || (p.lines > 0 && len(out) < p.lines) {
+		return nil, false
+	}
+	LogInfo.Printf("%s: the output of %s differs from the one of %s, which is expected only if it implements another primitive (e.g. with another hash)\n",
+		p.desc, d.prog, d.ref)
+	return out, true
+}
+
+// valid tells whether out has the expected number of values and passes the
+// probe's check
+func (p doctorProbe) valid(out []string) bool {
+	want := p.lines
+	if want == 0 {
+		want = 1
+	}
+	return len(out) == want && p.check(out)
+}
+
+// reordered looks for an order of the probe's arguments, with two of them
+// swapped or one of them moved, on which the program gives the right output.
+// It returns the names of the arguments in the order the program expects.
+func (d *doctor) reordered(p doctorProbe) ([]string, bool) {
+	tried := map[string]bool{strings.Join(argNames(p.args), " "): true}
+	for _, args := range reorderings(p.args) {
+		names := argNames(args)
+		if tried[strings.Join(names, " ")] {
+			continue
+		}
+		tried[strings.Join(names, " ")] = true
+		raw, err := runProgRaw(d.prog, doctorRunID, append(append([]string(nil), p.flags...), argValues(args)...))
+		if err != nil {
+			continue
+		}
+		if out, _, _ := parseOutput(raw, p.lines); p.valid(out) {
+			return names, true
+		}
+	}
+	return nil, false
+}
+
+// reorderings returns the orders of the arguments with two of them swapped,
+// then the ones with one of them moved
+func reorderings(args []doctorArg) [][]doctorArg {
+	var orders [][]doctorArg
+	for i := range args {
+		for j := i + 1; j < len(args); j++ {
+			order := append([]doctorArg(nil), args...)
+			order[i], order[j] = order[j], order[i]
+			orders = append(orders, order)
+		}
+	}
+	for i := range args {
+		for j := range args {
+			if i == j {
+				continue
+			}
+			rest := append(append([]doctorArg(nil), args[:i]...), args[i+1:]...)
+			order := append(append(append([]doctorArg(nil), rest[:j]...), args[i]), rest[j:]...)
+			orders = append(orders, order)
+		}
+	}
+	return orders
+}
+
+// failure checks that the program exits with an error when its last argument
+// is not hex, or the digest given with -h since the message is then ignored
+func (d *doctor) failure(desc string, flags []string, args []doctorArg) {
+	flags = append([]string(nil), flags...)
+	values := argValues(args)
+	if len(flags) > 0 {
+		flags[len(flags)-1] = "zz"
+	} else {
+		values[len(values)-1] = "zz"
+	}
+	raw, err := runProgRaw(d.prog, doctorRunID, append(flags, values...))
+	switch err.(type) {
+	case nil:
+		d.problem("%s: %s exited with 0 on the invalid hex input zz, printing %q: it must exit with an error on failure",
+			desc, d.prog, strings.TrimSpace(raw))
+	case hangError:
+		d.problem("%s: %v", desc, err)
+	default:
+		LogSuccess.Printf("%s: %s exits with an error on invalid inputs\n", desc, d.prog)
+	}
+}
+
+// signatures probes the signature and verification operations, taking
+// respectively the sign arguments followed by the message and the verify ones
+// followed by the signature and the message. The -h flag is probed as well if
+// the interface and the program support it, with the digest of the message
+// under the selected hash.
+func (d *doctor) signatures(sign, verify []doctorArg, hashFlag bool, sigNames ...string) {
+	d.signaturesWith(nil, sign, verify, sigNames)
+	if hashFlag && ProgramCapabilities(d.prog).Prehashed {
+		hashed, ok := digest(doctorMsg)
+		if !ok {
+			LogWarning.Printf("cdf does not implement the hash %s, skipping the -h probes\n", hashName())
+			return
+		}
+		d.signaturesWith([]string{"-h", hex.EncodeToString(hashed)}, sign, verify, sigNames)
+	}
+}
+
+// signaturesWith probes the signature and verification operations with the
+// given flags
+func (d *doctor) signaturesWith(flags []string, sign, verify []doctorArg, sigNames []string) {
+	prefix := ""
+	if flags != nil {
+		prefix = "-h "
+	}
+	msg := doctorArg{"m", doctorMsg}
+	signArgs := append(append([]doctorArg(nil), sign...), msg)
+	verifyArgs := func(sig []string, m string) []doctorArg {
+		args := append([]doctorArg(nil), verify...)
+		for i, name := range sigNames {
+			args = append(args, doctorArg{name, sig[i]})
+		}
+		return append(args, doctorArg{"m", m})
+	}
+	accepts := func(out []string) bool { return out[0] == trueStr }
+
+	var sig []string
+	if d.role != 2 {
+		var ok bool
+		sig, ok = d.probe(doctorProbe{desc: prefix + "signature", flags: flags, args: signArgs, lines: len(sigNames),
+			check: func(out []string) bool {
+				ref := d.reference(flags, verifyArgs(out, doctorMsg))
+				return len(ref) == 1 && ref[0] == trueStr
+			}})
+		if !ok && flags != nil {
+			d.problem("%s does not support the -h flag, it must then not declare prehashed in its capabilities", d.prog)
+			return
+		}
+		d.failure(prefix+"signature", flags, signArgs)
+	}
+	if d.role == 1 {
+		return
+	}
+
+	refSig := d.reference(flags, signArgs)
+	if len(refSig) != len(sigNames) {
+		LogWarning.Printf("%s could not sign with the keys of config.json, skipping the verification probes\n", d.ref)
+		return
+	}
+	d.probe(doctorProbe{desc: prefix + "verification", flags: flags, args: verifyArgs(refSig, doctorMsg),
+		check: accepts})
+	// an invalid signature must be rejected without error, else cdf stops
+	// its tests. The signature is checked against another message, or
+	// another digest with -h.
+	invalidFlags, invalid := flags, doctorInvalidMsg
+	if flags != nil {
+		hashed, _ := digest(doctorInvalidMsg)
+		invalidFlags, invalid = []string{"-h", hex.EncodeToString(hashed)}, doctorMsg
+	}
+	raw, err := runProgRaw(d.prog, doctorRunID, append(append([]string(nil), invalidFlags...), argValues(verifyArgs(refSig, invalid))...))
+	out, _, _ := parseOutput(raw, 0)
+	switch {
+	case err != nil:
+		d.problem("%sverification: %s exited with an error (%v) on an invalid signature: it must print false and exit with 0, cdf stops its tests otherwise",
+			prefix, d.prog, err)
+	case len(out) == 1 && out[0] == "false":
+		LogSuccess.Printf("%sverification: %s rejects an invalid signature\n", prefix, d.prog)
+	case len(out) == 1 && out[0] == trueStr:
+		d.problem("%sverification: %s accepted an invalid signature", prefix, d.prog)
+	}
+	d.failure(prefix+"verification", flags, verifyArgs(refSig, doctorMsg))
+
+	if sig != nil {
+		raw, err := runProgRaw(d.prog, doctorRunID, append(append([]string(nil), flags...), argValues(verifyArgs(sig, doctorMsg))...))
+		if out, _, _ := parseOutput(raw, 0); err != nil || len(out) != 1 || out[0] != trueStr {
+			d.problem("%s: %s does not accept its own signature", prefix+"verification", d.prog)
+		}
+	}
+}
+
+// encryption probes the encryption and decryption operations, taking
+// respectively the encrypt arguments followed by the message and the decrypt
+// ones followed by the ciphertext. If authenticated is set, the program must
+// fail on an altered ciphertext, printing fail.
+func (d *doctor) encryption(encrypt, decrypt []doctorArg, msg string, authenticated bool) {
+	encArgs := append(append([]doctorArg(nil), encrypt...), doctorArg{"m", msg})
+	decArgs := func(c string) []doctorArg {
+		return append(append([]doctorArg(nil), decrypt...), doctorArg{"c", c})
+	}
+	recovers := func(out []string) bool { return out[0] == msg }
+
+	var cipher []string
+	if d.role != 2 {
+		cipher, _ = d.probe(doctorProbe{desc: "encryption", args: encArgs, lines: 1,
+			check: func(out []string) bool {
+				ref := d.reference(nil, decArgs(out[0]))
+				return len(ref) == 1 && ref[0] == msg
+			}})
+		d.failure("encryption", nil, encArgs)
+	}
+	if d.role == 1 {
+		return
+	}
+
+	refCipher := d.reference(nil, encArgs)
+	if len(refCipher) != 1 {
+		LogWarning.Printf("%s could not encrypt with the keys of config.json, skipping the decryption probes\n", d.ref)
+		return
+	}
+	d.probe(doctorProbe{desc: "decryption", args: decArgs(refCipher[0]), lines: 1, check: recovers})
+	if authenticated {
+		// an invalid ciphertext must be an expected failure, else cdf stops
+		// its tests
+		c := refCipher[0]
+		altered := c[:len(c)-1] + "0"
+		if strings.HasSuffix(c, "0") {
+			altered = c[:len(c)-1] + "1"
+		}
+		raw, err := runProgRaw(d.prog, doctorRunID, argValues(decArgs(altered)))
+		switch {
+		case err == nil:
+			d.problem("decryption: %s exited with 0 on an invalid ciphertext: it must exit with an error and print fail", d.prog)
+		case !strings.Contains(strings.ToLower(raw), "fail"):
+			d.problem("decryption: %s does not print fail on an invalid ciphertext, cdf then takes the error for a crash", d.prog)
+		default:
+			LogSuccess.Printf("decryption: %s fails on an invalid ciphertext\n", d.prog)
+		}
+	}
+	d.failure("decryption", nil, decArgs(refCipher[0]))
+
+	if cipher != nil {
+		raw, err := runProgRaw(d.prog, doctorRunID, argValues(decArgs(cipher[0])))
+		if out, _, _ := parseOutput(raw, 1); err != nil || len(out) != 1 || out[0] != msg {
+			d.problem("decryption: %s does not decrypt its own ciphertext", d.prog)
+		}
+	}
+}
+
+// computation probes the single operation of the prf and xof interfaces, the
+// programs may output truncated results
+func (d *doctor) computation(args ...doctorArg) {
+	ref := d.reference(nil, args)
+	d.probe(doctorProbe{desc: "computation", args: args, lines: 1,
+		check: func(out []string) bool {
+			return len(ref) == 1 && out[0] != "" && strings.HasPrefix(ref[0], out[0])
+		}})
+	d.failure("computation", nil, args)
+}
+
+// parseOutput extracts from the raw output of a program its hex values, one
+// per line, or its truth value if lines is 0. It returns them lowercased,
+// along with the problems of their format and whether some were uppercase.
+func parseOutput(raw string, lines int) (values, issues []string, upper bool) {
+	var extra []string
+	for _, line := range strings.Split(strings.TrimSpace(raw), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if lines == 0 {
+			switch v := strings.ToLower(line); v {
+			case trueStr, "false":
+				values = append(values, v)
+			case "1", "0":
+				issues = append(issues, fmt.Sprintf("prints %s instead of true or false", v))
+				if v == "1" {
+					values = append(values, trueStr)
+				} else {
+					values = append(values, "false")
+				}
+			default:
+				extra = append(extra, line)
+			}
+			continue
+		}
+
+		var hexes []string
+		text, prefixed := false, false
+		for _, field := range strings.FieldsFunc(line, func(r rune) bool {
+			return r == ' ' || r == '\t' || r == ':' || r == '=' || r == ','
+		}) {
+			if strings.HasPrefix(field, "0x") || strings.HasPrefix(field, "0X") {
+				field, prefixed = field[2:], true
+			}
+			if field == "" || strings.Trim(field, hexChars+"ABCDEF") != "" {
+				text = true
+				continue
+			}
+			upper = upper || strings.ToLower(field) != field
+			hexes = append(hexes, strings.ToLower(field))
+		}
+		switch {
+		case len(hexes) == 0:
+			extra = append(extra, line)
+			continue
+		case text:
+			issues = append(issues, fmt.Sprintf("prints text along with its output: %q, instead of the bare hex value", line))
+		case len(hexes) > 1:
+			issues = append(issues, fmt.Sprintf("prints several values on the line %q, instead of one per line", line))
+		}
+		if prefixed {
+			issues = append(issues, fmt.Sprintf("prefixes its output with 0x: %q", line))
+		}
+		values = append(values, hexes...)
+	}
+
+	want := lines
+	if lines == 0 {
+		want = 1
+		if len(values) == 0 && len(extra) > 0 {
+			return nil, append(issues, fmt.Sprintf("prints %q instead of true or false", extra[0])), upper
+		}
+	}
+	if len(extra) > 0 {
+		issues = append(issues, fmt.Sprintf("prints the extra line(s) %q: cdf reads both its stdout and stderr, which must only hold the output",
+			strings.Join(extra, "\n")))
+	}
+	switch {
+	case len(values) == 0:
+		issues = append(issues, "prints nothing")
+	case len(values) != want:
+		issues = append(issues, fmt.Sprintf("prints %d value(s) instead of %d", len(values), want))
+	}
+	return values, issues, upper
+}
+
+// argValues returns the values of the arguments
+func argValues(args []doctorArg) []string {
+	values := make([]string, len(args))
+	for i, a := range args {
+		values[i] = a.value
+	}
+	return values
+}
+
+// argNames returns the names of the arguments
+func argNames(args []doctorArg) []string {
+	names := make([]string, len(args))
+	for i, a := range args {
+		names[i] = a.name
+	}
+	return names
+}
@@ -0,0 +1,64 @@
+package cdf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDoctor(t *testing.T) {
+	initForTesting("RSA")
+	Config.Timeout = 10
+
+	// the built-in programs follow their interfaces
+	for _, interf := range []string{"ecdsa", "enc", "prf", "rsaenc", "rsasign", "xof"} {
+		if err := Doctor(interf, Builtins(interf)[0], 0); err != nil {
+			t.Errorf("Expected %s to follow the %s interface, got: %v", Builtins(interf)[0], interf, err)
+		}
+	}
+	// but not the ones of other interfaces
+	if err := Doctor("prf", "builtin:sha256", 0); err == nil {
+		t.Error("Expected builtin:sha256 not to follow the prf interface")
+	}
+}
+
+func TestParseOutput(t *testing.T) {
+	tests := []struct {
+		raw    string
+		lines  int
+		values []string
+		issues int
+		upper  bool
+	}{
+		{"abcd\n", 1, []string{"abcd"}, 0, false},
+		{"ABCD", 1, []string{"abcd"}, 0, true},
+		{"0xabcd", 1, []string{"abcd"}, 1, false},
+		{"tag: abcd", 1, []string{"abcd"}, 1, false},
+		{"debug\nabcd", 1, []string{"abcd"}, 1, false},
+		{"ab cd", 2, []string{"ab", "cd"}, 1, false},
+		{"ab\ncd\n", 2, []string{"ab", "cd"}, 0, false},
+		{"ab", 2, []string{"ab"}, 1, false},
+		{"", 1, nil, 1, false},
+		{"True\r\n", 0, []string{"true"}, 0, false},
+		{"1", 0, []string{"true"}, 1, false},
+		{"valid", 0, nil, 1, false},
+	}
+	for _, test := range tests {
+		values, issues, upper := parseOutput(test.raw, test.lines)
+		if strings.Join(values, " ") != strings.Join(test.values, " ") || len(issues) != test.issues || upper != test.upper {
+			t.Errorf("parseOutput(%q, %d) = %q, %q, %v", test.raw, test.lines, values, issues, upper)
+		}
+	}
+}
+
+func TestReorderings(t *testing.T) {
+	args := []doctorArg{{"r", "01"}, {"s", "02"}, {"m", "03"}}
+	found := false
+	for _, order := range reorderings(args) {
+		if strings.Join(argNames(order), " ") == "m r s" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Expected the message to be moved before the signature")
+	}
+}
@@ -3,11 +3,9 @@ package cdf
 import (
 	"errors"
 	"fmt"
-	"log"
 	"math/rand"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 )
 
@@ -15,33 +13,92 @@ import (
 func TestDsa() error {
 	LogInfo.Print("testing dsa")
 
+	// the tests are run with each hash supported by both programs
+	hashes := TestedHashes()
+	defer selectHash(Config.Hash)
+	selectHash(hashes[0])
+
+	// calibrating the timeouts on a short and a long message
+	for _, prog := range []string{Prog1, Prog2} {
+		calibrateTimeout(prog,
+			[]string{Config.DsaP, Config.DsaQ, Config.DsaG, Config.DsaY, Config.DsaX, warmupMsg(Config.MinMsgLen)},
+			[]string{Config.DsaP, Config.DsaQ, Config.DsaG, Config.DsaY, Config.DsaX, warmupMsg(Config.MaxMsgLen)})
+	}
+
 	failed := false
-	// Testing Message length
-	if err := testDsaMsgLen(); err != nil {
-		failed = true
-		LogError.Println("while testing messages lengths:", err)
-	} else {
-		LogSuccess.Println("message lengths tested without error.")
+	for _, hash := range hashes {
+		selectHash(hash)
+		if len(hashes) > 1 {
+			LogInfo.Println("testing with", hash)
+		}
+
+		// Testing Message length
+		if subTest("dsa.msgLen") {
+			if err := testDsaMsgLen(); err != nil {
+				failed = true
+				LogError.Println("while testing messages lengths:", err)
+			} else {
+				LogSuccess.Println("message lengths tested without error.")
+			}
+		}
+
+		if subTest("dsa.hashLen") && capable("dsa.hashLen", "the -h flag", prehashed, Prog1, Prog2) {
+			if err := testDsaHashLen(); err != nil {
+				failed = true
+				LogError.Println("while testing hash lengths:", err)
+			} else {
+				LogSuccess.Println("hash lengths tested without error.")
+			}
+		}
+
+		// Testing special cases
+		if subTest("dsa.cases") {
+			if err := testDsaCases(); err != nil {
+				failed = true
+				LogError.Println("while testing special cases:", err)
+			} else {
+				LogSuccess.Println("special cases tested without error.")
+			}
+		}
 	}
 
-	if *TestHashes { // test only if the -h flag is supported
-		if err := testDsaHashLen(); err != nil {
+	// Testing the validation of the domain parameters and public keys
+	if subTest("dsa.params") {
+		if err := testDsaParams(); err != nil {
 			failed = true
-			LogError.Println("while testing hash lengths:", err)
-		} else {
-			LogSuccess.Println("hash lengths tested without error.")
+			LogError.Println("while testing invalid domain parameters:", err)
 		}
 	}
 
-	// Testing special cases
-	if err := testDsaCases(); err != nil {
-		failed = true
-		LogError.Println("while testing special cases:", err)
-	} else {
-		LogSuccess.Println("special cases tested without error.")
+	// Testing the boundary keys and nonces, and the leading zeros
+	if subTest("dsa.boundary") {
+		if err := testDsaBoundary(); err != nil {
+			failed = true
+			LogError.Println("while testing boundary values:", err)
+		}
+	}
+
+	// Testing the strictness of the DER verifiers
+	if subTest("dsa.der") {
+		if err := testDsaDER(); err != nil {
+			failed = true
+			LogError.Println("while testing DER signatures:", err)
+		}
+	}
+
+	// Testing the signatures are randomised, unless as per RFC 6979
+	msg := randomHex(Config.MinMsgLen)
+	argsSign := []string{Config.DsaP, Config.DsaQ, Config.DsaG, Config.DsaY, Config.DsaX, msg}
+	if subTest("dsa.properties") {
+		if err := testProperties(
+			propertyCheck{prog: Prog1, op: "signing", args: argsSign, random: !Config.Rfc6979},
+			propertyCheck{prog: Prog2, op: "signing", args: argsSign, random: !Config.Rfc6979}); err != nil {
+			failed = true
+			LogError.Println("while testing determinism:", err)
+		}
 	}
 
-	if limit := *TestTimings; limit > 0 {
+	if limit := *TestTimings; limit > 0 && subTest("dsa.timing") {
 		dudectTest(limit, Prog1, doOneComputationForDsa, prepareInputsForDsa)
 		dudectTest(limit, Prog2, doOneComputationForDsa, prepareInputsForDsa)
 	}
@@ -82,34 +139,48 @@ func testDsaHashLen() error {
 	msg := randomHex(Config.MaxMsgLen)
 
 	LogInfo.Println("testing different hash's lengths over ")
-	toTest := make(map[string]int)
 	TermPrepareFor(3)
 	// we should add a setting maybe to have the hash range to test?
+	outs := make([]string, Config.MaxMsgLen)
+	jobs := newJobGroup("dsa hash lengths", Config.MaxMsgLen-1)
 	for i := 1; i < Config.MaxMsgLen; i++ {
-		id := "dsa#buf#" + strconv.Itoa(i)
-		TermDisplay(3, "%d / %d \n", i+1, Config.MaxMsgLen)
+		i := i
+		jobs.Go(func() error {
+			id := "dsa#buf#" + strconv.Itoa(i)
+			argsP2 := []string{"-h", msg[:i*2], Config.DsaP, Config.DsaQ, Config.DsaG, Config.DsaY}
+			argsP1 := withArgs(argsP2, Config.DsaX)
+			if err := testDsaConsistency(msg, argsP1, argsP2, 1); err != nil {
+				return err
+			}
 
-		argsP2 := []string{"-h", msg[:i*2], Config.DsaP, Config.DsaQ, Config.DsaG, Config.DsaY}
-		argsP1 := append(argsP2, Config.DsaX)
-		if err := testDsaConsistency(msg, argsP1, argsP2, 1); err != nil {
-			mainErr = append(mainErr, err)
-			continue
-		}
+			out, err := runProg(Prog1, id, withArgs(argsP1, msg))
+			outs[i] = out
+			return err
+		})
+	}
+	if err := jobs.Wait(); err != nil {
+		mainErr = append(mainErr, err.(MultiError)...)
+	}
+	// and a genuine digest, longer or shorter than Q
+	if err := testPrehashed("dsa.hashLen", []string{Config.DsaP, Config.DsaQ, Config.DsaG, Config.DsaY, Config.DsaX},
+		[]string{Config.DsaP, Config.DsaQ, Config.DsaG, Config.DsaY}, msg[:Config.MinMsgLen*2]); err != nil {
+		mainErr = append(mainErr, err)
+	}
 
-		out, err := runProg(Prog1, id, append(argsP1, msg))
-		if err != nil {
-			mainErr = append(mainErr, err)
+	// Then we check if the tag is the same as a previous one, since it
+	// should never be the case.
+	// Note that this is more useful in the deterministic DSA case than
+	// in general.
+	toTest := make(map[string]int)
+	for i := 1; i < Config.MaxMsgLen; i++ {
+		out := outs[i]
+		if out == "" {
 			continue
 		}
-
-		// Then we check if the tag is the same as a previous one, since it
-		// should never be the case.
-		// Note that this is more useful in the deterministic DSA case than
-		// in general.
 		if toTest[out] > 0 {
 			hasSame = true
 			mainErr = append(mainErr, fmt.Errorf("Same tag as with buff %d with len %d on job %s. ",
-				toTest[out], i, id))
+				toTest[out], i, "dsa#buf#"+strconv.Itoa(i)))
 		}
 		toTest[out] = i
 	}
@@ -132,137 +203,135 @@ func testDsaConsistency(msg string, argsP1, argsP2 []string, maxIter int) error
 		nbIter = Config.MaxMsgLen + 1
 	}
 	if len(msg) < nbIter {
-		log.Fatalln("The message provided is not big enough to be processed")
-	}
-
-	// Initializing a common, unbuffered, channel which gives tasks to
-	// the worker goroutines.
-	msgs := make(chan string)
-	errs := make(chan error, nbIter)
-	// Spawn some worker goroutines
-	var wg sync.WaitGroup
-	for j := uint(0); j < Config.Concurrency; j++ {
-		wg.Add(1)
-		go func() {
-			for m := range msgs {
-				id := "dsa#" + strconv.Itoa(len(m))
-				// We cannot use argsP1, we have to create a copy,
-				// to keep argsP1 unchanged
-				argsP1T := append(argsP1, m)
-
-				// We run the first program:
-				out1 := runOrExitOnErr(Prog1, id, argsP1T...)
-
-				out1Arr := strings.Split(out1, "\n")
-				// it is necessary to trim again after splitting to remove the CR
-				rOut := strings.TrimSpace(out1Arr[0])
-				sOut := strings.TrimSpace(out1Arr[1])
-
-				argsP2T := append(argsP2, rOut, sOut, m)
-				// we run the second program:
-				outStr2 := runOrExitOnErr(Prog2, id, argsP2T...)
-
-				if trueStr != outStr2 {
-					fmt.Print("\n")
-					LogWarning.Printf("verification failed on length %d", len(m))
-					fmt.Print("\n")
-					LogError.Println(strings.Join(append(
-						[]string{"failed to run on length ", strconv.Itoa(len(m)),
-							" ", Prog2}, argsP2T...), " "))
-					LogError.Println(append([]string{"After running:", Prog1},
-						argsP1T...))
-					fmt.Print("\n\n")
-					errs <- fmt.Errorf("verification error on length %d", len(m))
-				}
-			}
-			wg.Done()
-		}()
+		Fatalln("The message provided is not big enough to be processed")
 	}
 
 	// There we could argue that the MinMsgLen should always be 1 byte.
 	// We ignore the Config.MsgIncrement since we are testing each byte-length
+	jobs := newJobGroup("dsa", nbIter-Config.MinMsgLen)
 	for i := Config.MinMsgLen; i < nbIter; i++ {
-		TermPrintInline(1, "%d / %d", i-Config.MinMsgLen+1, nbIter-Config.MinMsgLen)
-		// we populate our channel:
-		msgs <- msg[:i*2]
-	}
+		m := msg[:i*2]
+		jobs.Go(func() error {
+			id := "dsa#" + strconv.Itoa(len(m))
+			argsP1T := withArgs(argsP1, m)
+
+			// We run the first program:
+			out1, err := runOrClassify("dsa", Prog1, id, argsP1T...)
+			if err != nil {
+				return err
+			}
 
-	close(msgs)
-	// let us wait for our workers to finish
-	wg.Wait()
-
-	if len(errs) > 0 {
-		// Initializing the return value
-		var mainErr MultiError
-		firstErr := true
-		for len(errs) > 0 {
-			e := <-errs
-			if firstErr {
-				firstErr = false
-				// This is not guaranteed to be the 1st one, but almost
-				LogInfo.Println("First error:", e)
+			out1Arr := strings.Split(out1, "\n")
+			if len(out1Arr) < 2 {
+				return fmt.Errorf("%s did not output a signature on length %d: %s", Prog1, len(m), out1)
 			}
-			mainErr = append(mainErr, e)
-		}
-		TermPrepareFor(1)
-		return mainErr
+			// it is necessary to trim again after splitting to remove the CR
+			rOut := strings.TrimSpace(out1Arr[0])
+			sOut := strings.TrimSpace(out1Arr[1])
+			recordSignature("dsa", Prog1, argsP1T, rOut, sOut)
+
+			argsP2T := withArgs(argsP2, rOut, sOut, m)
+			// we run the second program:
+			outStr2, err := runOrClassify("dsa", Prog2, id, argsP2T...)
+			if err != nil {
+				return err
+			}
+			// the cases run on a given hash cannot be exported, since the
+			// test vectors hash their message
+			exportable := argsP2[0] != "-h"
+			accepted := trueStr == outStr2
+			// the oracle checks the mismatches, and the agreements if enabled
+			note := ""
+			if exportable && (!accepted || Config.Oracle) {
+				v, ok := dsaVector(argsP2[0], argsP2[1], argsP2[2], argsP2[3], rOut, sOut, m, "", "")
+				note = oracleSignature(v, ok, Prog1, Prog2, accepted)
+			}
+
+			if !accepted {
+				fmt.Print("\n")
+				LogWarning.Printf("verification failed on length %d", len(m))
+				fmt.Print("\n")
+				LogError.Println(strings.Join(append(
+					[]string{"failed to run on length ", strconv.Itoa(len(m)),
+						" ", Prog2}, argsP2T...), " "))
+				LogError.Println(append([]string{"After running:", Prog1},
+					argsP1T...))
+				fmt.Print("\n\n")
+				// we rerun the failing case to see whether it reproduces
+				class := classifyFailure(func() (bool, error) {
+					return rerunSignVerify(id, argsP1T, argsP2, m)
+				})
+				addFinding(Finding{Test: "dsa", Progs: []string{Prog1, Prog2},
+					Inputs: argsP1T, Message: "verification error", Class: class.String(), Oracle: note})
+				if note != "" {
+					LogWarning.Println(note)
+				}
+				if exportable {
+					addVector(dsaVector(argsP2[0], argsP2[1], argsP2[2], argsP2[3], rOut, sOut, m, "",
+						Prog2+" rejected the signature by "+Prog1, "Mismatch"))
+				}
+				return fmt.Errorf("verification error on length %d, %v", len(m), class)
+			}
+			if Config.Oracle && note != "" {
+				addFinding(Finding{Test: "dsa", Progs: []string{Prog1, Prog2},
+					Inputs: argsP1T, Message: "invalid signature accepted", Oracle: note})
+				addVector(dsaVector(argsP2[0], argsP2[1], argsP2[2], argsP2[3], rOut, sOut, m, "",
+					Prog2+" accepted the invalid signature by "+Prog1, "Mismatch"))
+				return fmt.Errorf("%s, on length %d", note, len(m))
+			}
+			if exportable {
+				addGeneratedVector(dsaVector(argsP2[0], argsP2[1], argsP2[2], argsP2[3], rOut, sOut, m, "",
+					"signature by "+Prog1, "Generated"))
+			}
+			return nil
+		})
+	}
+
+	err := jobs.Wait()
+	if err != nil {
+		// This is not guaranteed to be the 1st one, but almost
+		LogInfo.Println("First error:", err.(MultiError)[0])
 	}
 	TermPrepareFor(1)
-	return nil
+	return err
 }
 
 // testDSACases is responsible for running the different tests for edge cases
 // for DSA. We currently test against 0 inputs, against 1 inputs and other
 // degenerated cases. Note that this function is simply a bundle of functions
-// which could have been directly added to the main TestDsa one.
+// which could have been directly added to the main TestDsa one. All those
+// tests are submitted to the scheduler for both programs.
 func testDsaCases() error {
 	TermPrepareFor(1)
-	var mainErr MultiError
-	// firstly we'll test both program against the 0 values
-	if err := testDsaZeros(Prog1); err != nil {
-		//LogWarning.Println(err)
-		mainErr = append(mainErr, err)
-	}
-
-	if err := testDsaZeros(Prog2); err != nil {
-		//LogWarning.Println(err)
-		mainErr = append(mainErr, err)
-	}
-
-	TermPrepareFor(1)
-	if err := testDsaOnes(Prog1); err != nil {
-		mainErr = append(mainErr, err)
-	}
-
-	if err := testDsaOnes(Prog2); err != nil {
-		mainErr = append(mainErr, err)
-	}
-
-	TermPrepareFor(1)
-	// next, we test the verification against the (0, s) and the (r, 0) signatures
-	if err := testDsaZeroSign(Prog1); err != nil {
-		mainErr = append(mainErr, err)
-	}
-
-	if err := testDsaZeroSign(Prog2); err != nil {
-		mainErr = append(mainErr, err)
-	}
-
-	TermPrepareFor(1)
-
-	if err := testDsaZeroHash(Prog1); err != nil {
-		mainErr = append(mainErr, err)
+	// we take the MinMsgLen since we don't need a big value, we just need any value
+	msgZeros := randomHex(Config.MinMsgLen)
+	msgOnes := randomHex(Config.MinMsgLen)
+
+	// the 00 hash can only be given to the programs supporting -h
+	progs := []string{Prog1, Prog2}
+	withHash := make([]bool, len(progs))
+	total := 3 * len(progs)
+	for i, prog := range progs {
+		if withHash[i] = capable("dsa.cases (00 hash)", "the -h flag", prehashed, prog); withHash[i] {
+			total++
+		}
 	}
-
-	if err := testDsaZeroHash(Prog2); err != nil {
-		mainErr = append(mainErr, err)
+	jobs := newJobGroup("dsa edge cases", total)
+	for i, prog := range progs {
+		prog := prog
+		// firstly we'll test both program against the 0 values
+		jobs.Go(func() error { return testDsaZeros(prog, msgZeros) })
+		jobs.Go(func() error { return testDsaOnes(prog, msgOnes) })
+		// next, we test the verification against the (0, s) and the (r, 0) signatures
+		jobs.Go(func() error { return testDsaZeroSign(prog) })
+		if withHash[i] {
+			jobs.Go(func() error { return testDsaZeroHash(prog) })
+		}
 	}
+	err := jobs.Wait()
 
 	TermPrepareFor(1)
-	if len(mainErr) > 0 {
-		return mainErr
-	}
-	return nil
+	return err
 }
 
 // testDsaOnes is a test to sign using the 01 values as a public parameters
@@ -270,24 +339,24 @@ func testDsaCases() error {
 // by the tested programs, since it means they do not perform correct domain
 // parameters checks on their input. Typically it can lead to signature
 // independent of the actual message, with r=01.
-func testDsaOnes(prog string) error {
+func testDsaOnes(prog, msg string) error {
 	LogInfo.Printf("testing %s against the 01 parameters.\n", prog)
 	var mainErr MultiError
 
-	// we take the MinMsgLen since we don't need a big value, we just need any value
-	msg := randomHex(Config.MinMsgLen)
-
 	argsP := []string{Config.DsaP, Config.DsaQ, Config.DsaG, Config.DsaY, Config.DsaX, msg}
 	var tmp string
 	for i := 0; i < 3; i++ {
 		id := "dsa#pts#01-" + fmt.Sprint(i) + "_" + prog
 		tmp, argsP[i] = argsP[i], "01"
 		out, err := runProg(prog, id, argsP)
+		if err == nil {
+			recordDsaBadParams(prog, argsP, i, out)
+		}
 		argsP[i] = tmp
 		if err != nil {
-			if strings.Contains(err.Error(), "STOP") {
+			if isHang(err) {
 				mainErr = append(mainErr, err)
-				LogWarning.Println(prog, "timed out using 01 as argument ", i+1, "it may indicate an infinite loop.")
+				LogWarning.Println(prog, "hang using 01 as argument ", i+1, "it may indicate an infinite loop:", err)
 			} else {
 				LogToFile.Println("As expected,", id, "failed:", out, "\nGot error:", err)
 				LogSuccess.Println(prog, "refused to sign using 01 at arg ", i+1)
@@ -309,13 +378,10 @@ func testDsaOnes(prog string) error {
 // well as the 00 integer as a private key. This can lead to infinite loops, which
 // would then trigger the timeout in runProg. This means that the tested program
 // does not perform proper parameters checks on its inputs.
-func testDsaZeros(prog string) error {
+func testDsaZeros(prog, msg string) error {
 	LogInfo.Printf("testing %s against the 00 parameters.\n", prog)
 	var mainErr MultiError
 
-	// we take the MinMsgLen since we don't need a big value, we just need any value
-	msg := randomHex(Config.MinMsgLen)
-
 	argsP := []string{Config.DsaP, Config.DsaQ, Config.DsaG, Config.DsaY, Config.DsaX, msg}
 	var tmp string
 	for i := 0; i < 5; i++ {
@@ -325,11 +391,14 @@ func testDsaZeros(prog string) error {
 		}
 		tmp, argsP[i] = argsP[i], "00"
 		out, err := runProg(prog, id, argsP)
+		if err == nil {
+			recordDsaBadParams(prog, argsP, i, out)
+		}
 		argsP[i] = tmp
 		if err != nil {
-			if strings.Contains(err.Error(), "STOP") {
+			if isHang(err) {
 				mainErr = append(mainErr, err)
-				LogWarning.Println(prog, " timed out using 00 as argument ", i+1, "it may indicate an infinite loop.")
+				LogWarning.Println(prog, " hang using 00 as argument ", i+1, "it may indicate an infinite loop:", err)
 			} else {
 				LogToFile.Println("As expected,", id, "failed:", out, "\nGot error:", err)
 				LogSuccess.Println(prog, " refused to sign using 00 at arg ", i+1)
@@ -346,6 +415,27 @@ func testDsaZeros(prog string) error {
 	return nil
 }
 
+// recordDsaBadParams records the finding and the test vector of a signature
+// produced by prog although its argument i was replaced by an invalid value.
+func recordDsaBadParams(prog string, argsP []string, i int, out string) {
+	addFinding(Finding{Test: "dsa.badParams", Progs: []string{prog}, Inputs: withArgs(argsP),
+		Message: fmt.Sprintf("signed using %s as argument %d", argsP[i], i+1)})
+	r, s, ok := splitSignature(out)
+	if !ok {
+		return
+	}
+	comment := fmt.Sprintf("signature by %s using %s as argument %d", prog, argsP[i], i+1)
+	if i < 3 {
+		addVector(dsaVector(argsP[0], argsP[1], argsP[2], argsP[3], r, s, argsP[5], wycheInvalid,
+			comment, "InvalidDomainParameters"))
+	} else {
+		// the private key does not match the public one, so the signature
+		// should not verify, but we let the verification tell
+		addVector(dsaVector(argsP[0], argsP[1], argsP[2], argsP[3], r, s, argsP[5], "",
+			comment, "InvalidPrivateKey"))
+	}
+}
+
 // pair is simply a struct to allow to write the following test in a nicer way.
 type pair struct {
 	a string
@@ -367,14 +457,20 @@ func testDsaZeroSign(prog string) error {
 		argsP[4] = p.a
 		argsP[5] = p.b
 		out, err := runProg(prog, id, argsP)
+		if err == nil && out == trueStr {
+			addFinding(Finding{Test: "dsa.zeroSign", Progs: []string{prog},
+				Inputs: withArgs(argsP), Message: "validated an invalid signature"})
+			addVector(dsaVector(argsP[0], argsP[1], argsP[2], argsP[3], p.a, p.b, argsP[6], wycheInvalid,
+				prog+" accepted r="+p.a+", s="+p.b, "RangeCheck"))
+			return fmt.Errorf("%s validated a 0 signature", prog)
+		}
+		addGeneratedVector(dsaVector(argsP[0], argsP[1], argsP[2], argsP[3], p.a, p.b, argsP[6], wycheInvalid,
+			"r="+p.a+", s="+p.b, "RangeCheck"))
 		if err != nil {
 			LogToFile.Println("As expected, ", id, "failed:", out, "\nGot error:", err)
 			LogSuccess.Println(prog, "rejected r=", p.a, ", s=", p.b, " with an error.")
 			continue
 		}
-		if out == "true" {
-			return fmt.Errorf("%s validated a 0 signature", prog)
-		}
 		LogInfo.Println(prog, "rejected r=", p.a, ", s=", p.b, " without error.")
 	}
 
@@ -394,7 +490,7 @@ func testDsaZeroHash(prog string) error {
 	out, err := runProg(prog, id, argsP)
 	if err != nil {
 		LogToFile.Println("As expected,", id, "failed:", out, "\nGot error:", err)
-		LogSuccess.Println(prog, "didn't accept this degenerated case, or you did not implement the -h flag.")
+		LogSuccess.Println(prog, "didn't accept this degenerated case.")
 		return nil
 	}
 	if out == trueStr {
@@ -17,6 +17,9 @@ import (
 func TestTestDSA(t *testing.T) {
 	initForTesting("DSA")
 	Config.Timeout = 1
+	// the helper process supports -h, and declares it
+	Config.Capabilities = map[string]Capabilities{Prog1: {Prehashed: true}}
+	defer func() { Config.Capabilities = nil }()
 	t.Run("testDsaMsgLen", func(*testing.T) {
 		err := testDsaMsgLen()
 		if err != nil {
@@ -0,0 +1,258 @@
+package cdf
+
+import (
+	"crypto/dsa"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// dsaParamCase is a set of invalid domain parameters, or an invalid public
+// key, along with a signature cdf made under them. The signers are given the
+// private key x with the parameters, unless only the public key is invalid.
+type dsaParamCase struct {
+	name       string
+	p, q, g, y *big.Int
+	x          *big.Int
+	r, s       *big.Int
+	signer     bool
+}
+
+// dsaLaxVerify verifies the DSA signature (r, s) of z with the formulas only,
+// as a verifier checking neither the parameters nor the key would
+func dsaLaxVerify(p, q, g, y, z, r, s *big.Int) bool {
+	w := new(big.Int).ModInverse(s, q)
+	if w == nil || r.Sign() <= 0 || r.Cmp(q) >= 0 {
+		return false
+	}
+	u1 := new(big.Int).Mul(z, w)
+	u2 := new(big.Int).Mul(r, w)
+	v := new(big.Int).Exp(g, u1.Mod(u1, q), p)
+	v.Mul(v, new(big.Int).Exp(y, u2.Mod(u2, q), p)).Mod(v, p)
+	return v.Mod(v, q).Cmp(r) == 0
+}
+
+// dsaForge signs the digest, truncated to the byte length of q, with x under
+// the given parameters, drawing the nonce until the signature verifies with
+// the formulas, which it may never do when g or y is not of order q. The last
+// signature is returned then.
+func dsaForge(p, q, g, y, x *big.Int, digest []byte) (r, s *big.Int, err error) {
+	if size := (q.BitLen() + 7) / 8; len(digest) > size {
+		digest = digest[:size]
+	}
+	z := new(big.Int).SetBytes(digest)
+	for i := 0; i < 1024; i++ {
+		k, err := cryptoScalar(q)
+		if err != nil {
+			return nil, nil, err
+		}
+		kInv := new(big.Int).ModInverse(k, q)
+		r0 := new(big.Int).Exp(g, k, p)
+		r0.Mod(r0, q)
+		if kInv == nil || r0.Sign() == 0 {
+			continue
+		}
+		s0 := new(big.Int).Mul(x, r0)
+		s0.Add(s0, z).Mul(s0, kInv).Mod(s0, q)
+		if s0.Sign() == 0 {
+			continue
+		}
+		r, s = r0, s0
+		if dsaLaxVerify(p, q, g, y, z, r, s) {
+			break
+		}
+	}
+	if r == nil {
+		return nil, nil, fmt.Errorf("cannot sign under q = %x", q)
+	}
+	return r, s, nil
+}
+
+// smallOrderElement returns an element of Z_p* of small prime order m other
+// than 2, with m dividing (p-1)/q, if any below 100
+func smallOrderElement(p, q *big.Int) (*big.Int, int64, bool) {
+	cofactor := new(big.Int).Div(new(big.Int).Sub(p, big.NewInt(1)), q)
+	for m := int64(3); m < 100; m += 2 {
+		bm := big.NewInt(m)
+		if !bm.ProbablyPrime(1) || new(big.Int).Mod(cofactor, bm).Sign() != 0 {
+			continue
+		}
+		e := new(big.Int).Div(new(big.Int).Sub(p, big.NewInt(1)), bm)
+		for h := int64(2); h < 100; h++ {
+			if t := new(big.Int).Exp(big.NewInt(h), e, p); t.Cmp(big.NewInt(1)) != 0 {
+				return t, m, true
+			}
+		}
+	}
+	return nil, 0, false
+}
+
+// dsaParamCases returns the invalid parameters derived from the valid ones of
+// priv, with the signatures of the digest cdf makes under them:
+//   - a composite P, the product of P and a prime R = 1 mod Q, with G lifted
+//     to an element of order Q, so that the signature verifies;
+//   - a composite Q, twice Q, with -G of order 2Q as generator;
+//   - a prime Q not dividing P-1;
+//   - G of order 2Q, -G, and G = P-1, of order 2;
+//   - Y equal to 0, 1, P-1 and P, Y plus P, and Y of small order, the
+//     signatures being forged for 1, P-1 and Y of small order with x = 0.
+func dsaParamCases(priv *dsa.PrivateKey, digest []byte) ([]dsaParamCase, error) {
+	p, q, g, x := priv.P, priv.Q, priv.G, priv.X
+	one := big.NewInt(1)
+	pMinus1 := new(big.Int).Sub(p, one)
+	var cases []dsaParamCase
+	add := func(name string, p, q, g, y, x *big.Int, signer bool) error {
+		if y == nil {
+			y = new(big.Int).Exp(g, x, p)
+		}
+		r, s, err := dsaForge(p, q, g, y, x, digest)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		cases = append(cases, dsaParamCase{name: name, p: p, q: q, g: g, y: y, x: x, r: r, s: s, signer: signer})
+		return nil
+	}
+
+	// P R, with G' = G mod P and 1 mod R, of order Q
+	for j := int64(2); j < 10000; j += 2 {
+		rp := new(big.Int).Mul(q, big.NewInt(j))
+		if rp.Add(rp, one); !rp.ProbablyPrime(20) {
+			continue
+		}
+		t := new(big.Int).Sub(one, g)
+		t.Mul(t, new(big.Int).ModInverse(p, rp)).Mod(t, rp)
+		g2 := new(big.Int).Add(g, t.Mul(t, p))
+		if err := add("composite P", new(big.Int).Mul(p, rp), q, g2, nil, x, true); err != nil {
+			return nil, err
+		}
+		break
+	}
+	minusG := new(big.Int).Sub(p, g)
+	if err := add("composite Q", p, new(big.Int).Lsh(q, 1), minusG, nil, x, true); err != nil {
+		return nil, err
+	}
+	q2 := new(big.Int).Add(q, big.NewInt(2))
+	for !q2.ProbablyPrime(20) || new(big.Int).Mod(pMinus1, q2).Sign() == 0 {
+		q2.Add(q2, big.NewInt(2))
+	}
+	if err := add("Q not dividing P-1", p, q2, g, nil, x, true); err != nil {
+		return nil, err
+	}
+	if err := add("G of order 2Q", p, q, minusG, nil, x, true); err != nil {
+		return nil, err
+	}
+	if err := add("G = P-1", p, q, pMinus1, nil, x, true); err != nil {
+		return nil, err
+	}
+
+	zero := new(big.Int)
+	for _, c := range []struct {
+		name string
+		y, x *big.Int
+	}{
+		{"Y = 1", one, zero},
+		{"Y = P-1", pMinus1, zero},
+	} {
+		if err := add(c.name, p, q, g, c.y, c.x, false); err != nil {
+			return nil, err
+		}
+	}
+	if t, m, ok := smallOrderElement(p, q); ok {
+		if err := add(fmt.Sprintf("Y of order %d", m), p, q, g, t, zero, false); err != nil {
+			return nil, err
+		}
+	}
+	// the genuine signature, under a Y that is not the key, or not reduced
+	r, s, err := dsaForge(p, q, g, priv.Y, x, digest)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range []struct {
+		name string
+		y    *big.Int
+	}{
+		{"Y = 0", zero},
+		{"Y = P", p},
+		{"Y + P", new(big.Int).Add(priv.Y, p)},
+	} {
+		cases = append(cases, dsaParamCase{name: c.name, p: p, q: q, g: g, y: c.y, x: x, r: r, s: s})
+	}
+	return cases, nil
+}
+
+// testDsaParams gives the verifiers the dsaParamCases of the parameters of
+// Config with the signatures cdf made under them, and the signers the invalid
+// parameters with the private key: a verifier accepting such a signature, or
+// a signer producing one, is a finding.
+func testDsaParams() error {
+	msg := "DEADC0DE"
+	hashed, ok := digest(msg)
+	if !ok {
+		return fmt.Errorf("unsupported hash %s", hashName())
+	}
+	cases, err := dsaParamCases(configDsaKey(), hashed)
+	if err != nil {
+		return err
+	}
+	LogInfo.Printf("testing %d sets of invalid domain parameters and public keys.\n", len(cases))
+	hexInt := func(i *big.Int) string { return hex.EncodeToString(padTo(i.Bytes(), 1)) }
+
+	jobs := newJobGroup("dsa domain parameters", 2)
+	for _, prog := range []string{Prog1, Prog2} {
+		prog := prog
+		jobs.Go(func() error {
+			var accepted, signed []string
+			for _, c := range cases {
+				key := []string{hexInt(c.p), hexInt(c.q), hexInt(c.g), hexInt(c.y)}
+				argsP := withArgs(key, hexInt(c.r), hexInt(c.s), msg)
+				out, err := runProg(prog, "dsa#params#"+c.name+"_"+prog, argsP)
+				v, vok := dsaVector(key[0], key[1], key[2], key[3], hexInt(c.r), hexInt(c.s), msg, wycheInvalid,
+					"signature under invalid parameters: "+c.name, "InvalidDomainParameters")
+				if err != nil || out != trueStr {
+					LogToFile.Println("As expected,", prog, "rejected the", c.name, "parameters:", out, err)
+					addGeneratedVector(v, vok)
+				} else {
+					LogError.Printf("%s accepted a signature under invalid parameters: %s.\n", prog, c.name)
+					addFinding(Finding{Test: "dsa.params", Progs: []string{prog}, Inputs: argsP,
+						Message: "accepted a signature under invalid parameters: " + c.name})
+					v.test.Comment = prog + " accepted a " + v.test.Comment
+					addVector(v, vok)
+					accepted = append(accepted, c.name)
+				}
+
+				if !c.signer {
+					continue
+				}
+				argsSign := withArgs(key, hexInt(c.x), msg)
+				out, err = runProg(prog, "dsa#params#sign#"+c.name+"_"+prog, argsSign)
+				r, s, ok := splitSignature(out)
+				if err != nil || !ok {
+					LogToFile.Println("As expected,", prog, "refused to sign under the", c.name, "parameters:", out, err)
+					continue
+				}
+				LogError.Printf("%s signed under invalid parameters: %s.\n", prog, c.name)
+				addFinding(Finding{Test: "dsa.params", Progs: []string{prog}, Inputs: argsSign,
+					Message: "signed under invalid parameters: " + c.name})
+				addVector(dsaVector(key[0], key[1], key[2], key[3], r, s, msg, wycheInvalid,
+					prog+" signed under invalid parameters: "+c.name, "InvalidDomainParameters"))
+				signed = append(signed, c.name)
+			}
+			var mainErr MultiError
+			if len(accepted) > 0 {
+				mainErr = append(mainErr, fmt.Errorf("%s accepted signatures under invalid parameters: %s",
+					prog, strings.Join(accepted, ", ")))
+			}
+			if len(signed) > 0 {
+				mainErr = append(mainErr, fmt.Errorf("%s signed under invalid parameters: %s",
+					prog, strings.Join(signed, ", ")))
+			}
+			if len(mainErr) > 0 {
+				return mainErr
+			}
+			LogSuccess.Printf("%s rejected the %d sets of invalid parameters.\n", prog, len(cases))
+			return nil
+		})
+	}
+	return jobs.Wait()
+}
@@ -0,0 +1,52 @@
+package cdf
+
+import (
+	"crypto/sha256"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestDsaParamCases(t *testing.T) {
+	initForTesting("DSA")
+	digest := sha256.Sum256([]byte{0xde, 0xad, 0xc0, 0xde})
+	priv := configDsaKey()
+	cases, err := dsaParamCases(priv, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) < 10 {
+		t.Fatalf("Expected at least 10 cases, got %d", len(cases))
+	}
+	one := big.NewInt(1)
+	for _, c := range cases {
+		pMinus1 := new(big.Int).Sub(c.p, one)
+		invalid := !c.p.ProbablyPrime(20) || !c.q.ProbablyPrime(20) ||
+			new(big.Int).Mod(pMinus1, c.q).Sign() != 0 ||
+			new(big.Int).Exp(c.g, c.q, c.p).Cmp(one) != 0 ||
+			c.y.Cmp(big.NewInt(2)) < 0 || c.y.Cmp(new(big.Int).Sub(pMinus1, one)) > 0 ||
+			new(big.Int).Exp(c.y, c.q, c.p).Cmp(one) != 0
+		if !invalid {
+			t.Errorf("The %s parameters are valid", c.name)
+		}
+		// the forgeries verify under a verifier checking nothing
+		forged := c.name == "composite P" || c.name == "composite Q" || c.name == "Y = 1" ||
+			c.name == "Y = P-1" || strings.HasPrefix(c.name, "Y of order")
+		z := new(big.Int).SetBytes(digest[:(c.q.BitLen()+7)/8])
+		if forged && !dsaLaxVerify(c.p, c.q, c.g, c.y, z, c.r, c.s) {
+			t.Errorf("The signature forged under the %s parameters does not verify", c.name)
+		}
+	}
+}
+
+func TestDsaParams(t *testing.T) {
+	// crypto/dsa leaves the validation of the parameters to its callers
+	withBuiltins(t, "dsa", "builtin:dsa", "builtin:dsa")
+	if err := testDsaParams(); err == nil {
+		t.Fatal("Expected the built-in program to accept invalid parameters")
+	}
+	if !hasFinding(Prog1, "accepted a signature under invalid parameters: composite P") ||
+		!hasFinding(Prog1, "signed under invalid parameters: composite P") {
+		t.Errorf("Expected findings on the composite P, got %v", Findings())
+	}
+}
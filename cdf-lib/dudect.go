@@ -4,7 +4,6 @@ package cdf
 
 import (
 	"fmt"
-	"log"
 	"math"
 	"time"
 )
@@ -89,7 +88,7 @@ func updateStatistics(execTimes []int64, classes []int) {
 //  its context values
 func tPush(ctx *tCtx, x float64, class int) {
 	if !(class == 0 || class == 1) {
-		log.Fatalln("Error, wrong class in tPush")
+		Fatalln("Error, wrong class in tPush")
 	}
 	ctx.n[class]++
 	// Welford method for computing online variance
@@ -1,41 +1,124 @@
 package cdf
 
 import (
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"log"
+	"math/big"
 	"strconv"
 	"strings"
-	"sync"
 )
 
 // TestEcdsa implements the cdf interface for ECDSA signature and verification scheme
 func TestEcdsa() error {
 	LogInfo.Print("testing ecdsa")
 
+	// the programs declaring several curves are given the one of the key
+	curve, ok := keyCurve()
+	if !ok {
+		return errors.New("the ECDSA key is not on a known curve")
+	}
+	LogInfo.Println("testing on the curve", curve.name)
+	selectCurve(curve.name)
+
+	// the tests are run with each hash supported by both programs
+	hashes := TestedHashes()
+	defer selectHash(Config.Hash)
+	selectHash(hashes[0])
+
+	// calibrating the timeouts on a short and a long message
+	for _, prog := range []string{Prog1, Prog2} {
+		calibrateTimeout(prog,
+			[]string{Config.EcdsaX, Config.EcdsaY, Config.EcdsaD, warmupMsg(Config.MinMsgLen)},
+			[]string{Config.EcdsaX, Config.EcdsaY, Config.EcdsaD, warmupMsg(Config.MaxMsgLen)})
+	}
+
 	failed := false
-	// Testing Message length
-	if err := testEcdsaMsgLen(); err != nil {
-		failed = true
-		LogError.Println("while testing messages lengths:", err)
-	} else {
-		LogSuccess.Println("message lengths tested without error.")
+	for _, hash := range hashes {
+		selectHash(hash)
+		if len(hashes) > 1 {
+			LogInfo.Println("testing with", hash)
+		}
+
+		// Testing Message length
+		if subTest("ecdsa.msgLen") {
+			if err := testEcdsaMsgLen(); err != nil {
+				failed = true
+				LogError.Println("while testing messages lengths:", err)
+			} else {
+				LogSuccess.Println("message lengths tested without error.")
+			}
+		}
+
+		// Testing hash length
+		if subTest("ecdsa.hashLen") && capable("ecdsa.hashLen", "the -h flag", prehashed, Prog1, Prog2) {
+			if err := testEcdsaHashLen(); err != nil {
+				failed = true
+				LogError.Println("while testing hash lengths:", err)
+			} else {
+				LogSuccess.Println("hash lengths tested without error.")
+			}
+		}
+
+		// Testing specific point
+		if subTest("ecdsa.points") {
+			if err := testEcdsaPoints(); err != nil {
+				failed = true
+				//LogError.Println("while testing specific edge cases:", err)
+			}
+		}
+	}
+
+	// Testing the parameters of the curve given explicitly to the verifiers
+	if subTest("ecdsa.explicit") {
+		if err := testEcdsaExplicit(); err != nil {
+			failed = true
+			LogError.Println("while testing explicit parameters:", err)
+		}
+	}
+
+	// Testing the verifiers validate the public keys
+	if subTest("ecdsa.publicKeys") {
+		if err := testEcdsaPublicKeys(); err != nil {
+			failed = true
+			LogError.Println("while testing invalid public keys:", err)
+		}
+	}
+
+	// Testing the ranges of r and s, and the high-S signatures
+	if subTest("ecdsa.ranges") {
+		if err := testEcdsaRanges(); err != nil {
+			failed = true
+			LogError.Println("while testing signature ranges:", err)
+		}
+	}
+
+	// Testing the boundary keys and nonces, and the leading zeros
+	if subTest("ecdsa.boundary") {
+		if err := testEcdsaBoundary(); err != nil {
+			failed = true
+			LogError.Println("while testing boundary values:", err)
+		}
 	}
 
-	// Testing hash length
-	if *TestHashes { // test only if the -h flag is supported
-		if err := testEcdsaHashLen(); err != nil {
+	// Testing the strictness of the DER verifiers
+	if subTest("ecdsa.der") {
+		if err := testEcdsaDER(); err != nil {
 			failed = true
-			LogError.Println("while testing hash lengths:", err)
-		} else {
-			LogSuccess.Println("hash lengths tested without error.")
+			LogError.Println("while testing DER signatures:", err)
 		}
 	}
 
-	// Testing specific point
-	if err := testEcdsaPoints(); err != nil {
-		failed = true
-		//LogError.Println("while testing specific edge cases:", err)
+	// Testing the signatures are randomised, unless as per RFC 6979
+	msg := randomHex(Config.MinMsgLen)
+	argsSign := []string{Config.EcdsaX, Config.EcdsaY, Config.EcdsaD, msg}
+	if subTest("ecdsa.properties") {
+		if err := testProperties(
+			propertyCheck{prog: Prog1, op: "signing", args: argsSign, random: !Config.Rfc6979},
+			propertyCheck{prog: Prog2, op: "signing", args: argsSign, random: !Config.Rfc6979}); err != nil {
+			failed = true
+			LogError.Println("while testing determinism:", err)
+		}
 	}
 
 	if failed {
@@ -72,48 +155,67 @@ func testEcdsaHashLen() error {
 	var mainErr MultiError
 	hasSame := false
 
+	// the hashes get longer than the order n, so that they are truncated
+	maxLen := Config.MaxMsgLen / 2
+	if curve, ok := keyCurve(); ok && curve.orderLen()+2 > maxLen {
+		maxLen = curve.orderLen() + 2
+	}
 	msg := randomHex(Config.MaxMsgLen)
+	if maxLen > Config.MaxMsgLen {
+		msg = randomHex(maxLen)
+	}
 
 	LogInfo.Println("testing different hash's lengths")
-	toTest := make(map[string]int)
 	TermPrepareFor(3)
 	// we should add a setting maybe to have the hash range to test?
-	temp := Config.MinMsgLen
-	for i := 1; i < Config.MaxMsgLen/2; i++ {
-		id := "ecdsa#buf#" + strconv.Itoa(i)
-		TermDisplay(3, "%d / %d \n", i+1, Config.MaxMsgLen/2)
-
-		Config.MinMsgLen = i * 2
-		argsP2 := []string{"-h", msg[:i*2], Config.EcdsaX, Config.EcdsaY}
-		argsP1 := append(argsP2, Config.EcdsaD)
-		LogToFile.Println("About to run testEcdsaConsistency for HashLen test")
-		if err := testEcdsaConsistency(msg[:i*2], argsP1, argsP2, 1); err != nil {
-			mainErr = append(mainErr, err)
-			continue
-		}
-		LogToFile.Println("Finished to run testEcdsaConsistency:", mainErr)
+	outs := make([]string, maxLen)
+	jobs := newJobGroup("ecdsa hash lengths", maxLen-1)
+	for i := 1; i < maxLen; i++ {
+		i := i
+		jobs.Go(func() error {
+			id := "ecdsa#buf#" + strconv.Itoa(i)
+			argsP2 := []string{"-h", msg[:i*2], Config.EcdsaX, Config.EcdsaY}
+			argsP1 := withArgs(argsP2, Config.EcdsaD)
+			LogToFile.Println("About to run testEcdsaConsistency for HashLen test")
+			if err := ecdsaConsistency(msg[:i*2], argsP1, argsP2, i*2, 1); err != nil {
+				return err
+			}
+			LogToFile.Println("Finished to run testEcdsaConsistency on job", id)
 
-		out, err := runProg(Prog1, id, append(argsP1, msg[:i*2]))
-		if err != nil {
-			mainErr = append(mainErr, err)
+			out, err := runProg(Prog1, id, withArgs(argsP1, msg[:i*2]))
+			outs[i] = out
+			return err
+		})
+	}
+	if err := jobs.Wait(); err != nil {
+		mainErr = append(mainErr, err.(MultiError)...)
+	}
+	// and a genuine digest, longer or shorter than the group order
+	if err := testPrehashed("ecdsa.hashLen", []string{Config.EcdsaX, Config.EcdsaY, Config.EcdsaD},
+		[]string{Config.EcdsaX, Config.EcdsaY}, msg[:Config.MinMsgLen*2]); err != nil {
+		mainErr = append(mainErr, err)
+	}
+
+	// Then we check if the tag is the same as a previous one, since it
+	//  should never be the case.
+	// Note that this is more useful in the deterministic ECDSA case than
+	//  in general.
+	toTest := make(map[string]int)
+	for i := 1; i < maxLen; i++ {
+		out := outs[i]
+		if out == "" {
 			continue
 		}
-
-		// Then we check if the tag is the same as a previous one, since it
-		//  should never be the case.
-		// Note that this is more useful in the deterministic ECDSA case than
-		//  in general.
 		if toTest[out] > 0 {
 			hasSame = true
 			mainErr = append(mainErr, fmt.Errorf("Same tag as with buff %d with len %d on job %s. ",
-				toTest[out], i, id))
+				toTest[out], i, "ecdsa#buf#"+strconv.Itoa(i)))
 			if first == 0 {
 				first = i
 			}
 		}
 		toTest[out] = i
 	}
-	Config.MinMsgLen = temp
 	if len(mainErr) > 0 {
 		if hasSame {
 			mainErr = append(mainErr, fmt.Errorf("Note that same tags are expected if you are using ECDSA deterministic as per RFC6979. If you are not, then this is a problem. First problem encountered with size %d", first))
@@ -126,156 +228,166 @@ func testEcdsaHashLen() error {
 // testEcdsaConsistency just tests the ECDSA signature on different message
 //  lengths for the given msg, starting from MinMsgLen and for at most maxIter
 //  iterations or reaches the value MaxMsgLen set in the Config.json file
-func testEcdsaConsistency(msg string, argsP1, argsP2 []string, maxIter int) (mainErr error) {
+func testEcdsaConsistency(msg string, argsP1, argsP2 []string, maxIter int) error {
+	return ecdsaConsistency(msg, argsP1, argsP2, Config.MinMsgLen, maxIter)
+}
+
+// ecdsaConsistency is testEcdsaConsistency starting from minLen instead of
+//  MinMsgLen, which testEcdsaHashLen raises for each of its digests: its jobs
+//  run concurrently, so they cannot modify the Config.
+func ecdsaConsistency(msg string, argsP1, argsP2 []string, minLen, maxIter int) (mainErr error) {
 	LogInfo.Println("testing ecdsa consistency")
 	nbIter := maxIter
-	if nbIter+Config.MinMsgLen >= Config.MaxMsgLen || maxIter <= 0 {
-		nbIter = (Config.MaxMsgLen-Config.MinMsgLen)/2 + 1
-	}
-	if len(msg)/2 < nbIter || len(msg) < Config.MinMsgLen {
-		log.Fatalln("The message provided is not big enough to be processed")
-	}
-
-	// Initializing a common, unbuffered, channel which gives tasks to
-	//  the worker goroutines.
-	msgs := make(chan string)
-	errs := make(chan error, nbIter)
-	// Spawn some worker goroutines
-	var wg sync.WaitGroup
-	for j := uint(0); j < Config.Concurrency; j++ {
-		wg.Add(1)
-		go func() {
-			for m := range msgs {
-				id := "ecdsa#" + strconv.Itoa(len(m))
-				// We cannot use argsP1, we have to create a copy,
-				//  to keep argsP1 unchanged
-				argsP1T := append(argsP1, m)
-
-				// We run the first program:
-				out1 := runOrExitOnErr(Prog1, id, argsP1T...)
-
-				out1Arr := strings.Split(out1, "\n")
-
-				//fmt.Println("\nGot:", out1)
-				// it is necessary to trim again after splitting to remove the CR
-				rOut := strings.TrimSpace(out1Arr[0])
-				sOut := strings.TrimSpace(out1Arr[1])
-
-				argsP2T := append(argsP2, rOut, sOut, m)
-				// we run the second program:
-				outStr2 := runOrExitOnErr(Prog2, id, argsP2T...)
-
-				if trueStr != outStr2 {
-					fmt.Print("\n")
-					LogWarning.Printf("verification failed on length %d", len(m))
-					fmt.Print("\n")
-					LogError.Println(strings.Join(append(
-						[]string{"failed to run on length ", strconv.Itoa(len(m)),
-							" ", Prog2}, argsP2T...), " "))
-					LogError.Println(append([]string{"After running:", Prog1},
-						argsP1T...))
-					LogWarning.Println(argsP2T[:len(argsP1T)-1])
-					TermPrepareFor(4)
-					errs <- fmt.Errorf("verification error on job %s and length %d", id, len(m))
-				}
-			}
-			wg.Done()
-		}()
+	if nbIter+minLen >= Config.MaxMsgLen || maxIter <= 0 {
+		nbIter = (Config.MaxMsgLen-minLen)/2 + 1
+	}
+	// the digests of testEcdsaHashLen may exceed MaxMsgLen on large curves
+	if nbIter < 1 {
+		nbIter = 1
+	}
+	if len(msg)/2 < nbIter || len(msg) < minLen {
+		Fatalln("The message provided is not big enough to be processed")
 	}
 
 	// There we could argue that the MinMsgLen should always be 1 byte.
 	// We ignore the Config.MsgIncrement since we are testing each byte-length
-	for i := Config.MinMsgLen; i < nbIter*2+Config.MinMsgLen; i += 2 {
-		TermPrintInline(1, "%d / %d", (i-Config.MinMsgLen)/2+1, nbIter)
-		// we populate our channel:
-		msgs <- msg[:i]
-	}
-	close(msgs)
-	// let us wait for our workers to finish
-	wg.Wait()
-
-	if len(errs) > 0 {
-		// Initializing the return value
-		var mainErr MultiError
-		firstErr := true
-		for len(errs) > 0 {
-			e := <-errs
-			if firstErr {
-				firstErr = false
-				// This is not guaranteed to be the 1st one, but almost
-				LogInfo.Println("First error:", e)
+	jobs := newJobGroup("ecdsa", nbIter)
+	for i := minLen; i < nbIter*2+minLen; i += 2 {
+		m := msg[:i]
+		jobs.Go(func() error {
+			id := "ecdsa#" + strconv.Itoa(len(m))
+			argsP1T := withArgs(argsP1, m)
+
+			// We run the first program:
+			out1, err := runOrClassify("ecdsa", Prog1, id, argsP1T...)
+			if err != nil {
+				return err
 			}
-			mainErr = append(mainErr, e)
-		}
-		TermPrepareFor(1)
-		return mainErr
-	}
-	TermPrepareFor(1)
-	return nil
-}
-
-func testEcdsaPoints() error {
-	TermPrepareFor(1)
-	var mainErr MultiError
-	// firstly we'll test both program against the 0,0 coordinate:
-	if err := testEcdsaZeroPoint(Prog1); err != nil {
-		//LogWarning.Println(err)
-		mainErr = append(mainErr,
-			fmt.Errorf("%s accepts the (0,0) coordinate and 0 as private integer:\n%v", Prog1, err))
-	}
 
-	if err := testEcdsaZeroPoint(Prog2); err != nil {
-		//LogWarning.Println(err)
-		mainErr = append(mainErr,
-			fmt.Errorf("%s accepts the (0,0) coordinate and 0 as private integer:\n%v", Prog2, err))
-	}
+			out1Arr := strings.Split(out1, "\n")
+			if len(out1Arr) < 2 {
+				return fmt.Errorf("%s did not output a signature on job %s: %s", Prog1, id, out1)
+			}
+			// it is necessary to trim again after splitting to remove the CR
+			rOut := strings.TrimSpace(out1Arr[0])
+			sOut := strings.TrimSpace(out1Arr[1])
+			recordSignature("ecdsa", Prog1, argsP1T, rOut, sOut)
+
+			argsP2T := withArgs(argsP2, rOut, sOut, m)
+			// we run the second program:
+			outStr2, err := runOrClassify("ecdsa", Prog2, id, argsP2T...)
+			if err != nil {
+				return err
+			}
+			// the cases run on a given hash cannot be exported, since the
+			// test vectors hash their message
+			exportable := argsP2[0] != "-h"
+			accepted := trueStr == outStr2
+			// the oracle checks the mismatches, and the agreements if enabled
+			note := ""
+			if exportable && (!accepted || Config.Oracle) {
+				v, ok := ecdsaVector(argsP2[0], argsP2[1], rOut, sOut, m, "", "")
+				note = oracleSignature(v, ok, Prog1, Prog2, accepted)
+			}
 
-	TermPrepareFor(1)
-	// next, we test the verification against the 0, s and the r, 0 signatures
-	if err := testEcdsaZeroSign(Prog1); err != nil {
-		mainErr = append(mainErr, err)
+			if !accepted {
+				fmt.Print("\n")
+				LogWarning.Printf("verification failed on length %d", len(m))
+				fmt.Print("\n")
+				LogError.Println(strings.Join(append(
+					[]string{"failed to run on length ", strconv.Itoa(len(m)),
+						" ", Prog2}, argsP2T...), " "))
+				LogError.Println(append([]string{"After running:", Prog1},
+					argsP1T...))
+				LogWarning.Println(argsP2T[:len(argsP1T)-1])
+				TermPrepareFor(4)
+				// we rerun the failing case to see whether it reproduces
+				class := classifyFailure(func() (bool, error) {
+					return rerunSignVerify(id, argsP1T, argsP2, m)
+				})
+				addFinding(Finding{Test: "ecdsa", Progs: []string{Prog1, Prog2},
+					Inputs: argsP1T, Message: "verification error", Class: class.String(), Oracle: note})
+				if note != "" {
+					LogWarning.Println(note)
+				}
+				if exportable {
+					addVector(ecdsaVector(argsP2[0], argsP2[1], rOut, sOut, m, "",
+						Prog2+" rejected the signature by "+Prog1, "Mismatch"))
+				}
+				return fmt.Errorf("verification error on job %s and length %d, %v", id, len(m), class)
+			}
+			if Config.Oracle && note != "" {
+				addFinding(Finding{Test: "ecdsa", Progs: []string{Prog1, Prog2},
+					Inputs: argsP1T, Message: "invalid signature accepted", Oracle: note})
+				addVector(ecdsaVector(argsP2[0], argsP2[1], rOut, sOut, m, "",
+					Prog2+" accepted the invalid signature by "+Prog1, "Mismatch"))
+				return fmt.Errorf("%s, on job %s and length %d", note, id, len(m))
+			}
+			if exportable {
+				addGeneratedVector(ecdsaVector(argsP2[0], argsP2[1], rOut, sOut, m, "",
+					"signature by "+Prog1, "Generated"))
+			}
+			return nil
+		})
 	}
 
-	if err := testEcdsaZeroSign(Prog2); err != nil {
-		mainErr = append(mainErr, err)
+	mainErr = jobs.Wait()
+	if mainErr != nil {
+		// This is not guaranteed to be the 1st one, but almost
+		LogInfo.Println("First error:", mainErr.(MultiError)[0])
 	}
-
 	TermPrepareFor(1)
+	return mainErr
+}
 
-	if *TestHashes {
-		if err := testEcdsaZeroHash(Prog1); err != nil {
-			mainErr = append(mainErr, err)
-		}
-
-		if err := testEcdsaZeroHash(Prog2); err != nil {
-			mainErr = append(mainErr, err)
-		}
-		TermPrepareFor(1)
+// testEcdsaPoints runs the edge cases tests against both programs, those are
+//  submitted to the scheduler.
+func testEcdsaPoints() error {
+	TermPrepareFor(1)
+	// we take the MinMsgLen since we don't need a big value, we just need any value
+	msg := randomHex(Config.MinMsgLen)
 
-		if err := testInfiniteLoop(Prog1); err != nil {
-			mainErr = append(mainErr, err)
+	// the degenerated hashes can only be given to the programs supporting -h
+	progs := []string{Prog1, Prog2}
+	withHash := make([]bool, len(progs))
+	total := 2 * len(progs)
+	for i, prog := range progs {
+		if withHash[i] = capable("ecdsa.points (00 hash)", "the -h flag", prehashed, prog); withHash[i] {
+			total += 3
 		}
-
-		if err := testInfiniteLoop(Prog2); err != nil {
-			mainErr = append(mainErr, err)
+	}
+	jobs := newJobGroup("ecdsa edge cases", total)
+	for i, prog := range progs {
+		prog := prog
+		// firstly we'll test both program against the 0,0 coordinate:
+		jobs.Go(func() error {
+			if err := testEcdsaZeroPoint(prog, msg); err != nil {
+				return fmt.Errorf("%s accepts the (0,0) coordinate and 0 as private integer:\n%v", prog, err)
+			}
+			return nil
+		})
+		// next, we test the verification against the 0, s and the r, 0 signatures
+		jobs.Go(func() error { return testEcdsaZeroSign(prog) })
+
+		if withHash[i] {
+			jobs.Go(func() error { return testEcdsaZeroHash(prog) })
+			jobs.Go(func() error { return testInfiniteLoop(prog) })
+			jobs.Go(func() error { return testEcdsaOrderDigests(prog) })
 		}
 	}
+	err := jobs.Wait()
 
 	TermPrepareFor(1)
-	if len(mainErr) > 0 {
-		return mainErr
-	}
-	return nil
+	return err
 }
 
 // testEcdsaZeroPoint is a simple trial to sign using the 0,0 coordinate as a key
 //  and the 0 integer as a private key. Note that the point (0,0) is never on a curve
 //  in short Weierstrass form with a non-zero b parameter.
-func testEcdsaZeroPoint(prog string) error {
+func testEcdsaZeroPoint(prog, msg string) error {
 	LogInfo.Printf("testing %s against the 0,0 coordinate.\n", prog)
 	// The point 0,0 shouldn't be accepted as a valid point, so let us try with it:
 	id := "ecdsa#pts#0-0_" + prog
-	msg := randomHex(Config.MinMsgLen)
 
 	argsP := []string{"00", "00", "00", msg}
 	out, err := runProg(prog, id, argsP)
@@ -285,6 +397,12 @@ func testEcdsaZeroPoint(prog string) error {
 		return nil
 	}
 	LogWarning.Println(prog, " signed using (0,0) and 0 as private key without error.")
+	addFinding(Finding{Test: "ecdsa.zeroPoint", Progs: []string{prog}, Inputs: argsP,
+		Message: "signed using (0,0) and 0 as private key"})
+	if r, s, ok := splitSignature(out); ok {
+		addVector(ecdsaVector("00", "00", r, s, msg, wycheInvalid,
+			"signature by "+prog+" using (0,0) as public key", "InvalidPublicKey"))
+	}
 	return fmt.Errorf("\tit returned:\n%s,\n\ton message %s", out, msg)
 }
 
@@ -302,14 +420,20 @@ func testEcdsaZeroSign(prog string) error {
 			argsP[2] = a
 			argsP[3] = b
 			out, err := runProg(prog, id, argsP)
+			if err == nil && out == trueStr {
+				addFinding(Finding{Test: "ecdsa.zeroSign", Progs: []string{prog},
+					Inputs: withArgs(argsP), Message: "validated an invalid signature"})
+				addVector(ecdsaVector(Config.EcdsaX, Config.EcdsaY, a, b, argsP[4], wycheInvalid,
+					prog+" accepted r="+a+", s="+b, "RangeCheck"))
+				return fmt.Errorf("%s validated the invalid signature:\nr=%s,\ns=%s", prog, a, b)
+			}
+			addGeneratedVector(ecdsaVector(Config.EcdsaX, Config.EcdsaY, a, b, argsP[4], wycheInvalid,
+				"r="+a+", s="+b, "RangeCheck"))
 			if err != nil {
 				LogToFile.Println("As expected, ", id, "failed:", out, "\nGot error:", err)
 				LogSuccess.Println(prog, "rejected r=", a, ", s=", b, " with an error.")
 				continue
 			}
-			if out == trueStr {
-				return fmt.Errorf("%s validated the invalid signature:\nr=%s,\ns=%s", prog, a, b)
-			}
 			LogInfo.Println(prog, "rejected r=", a, ", s=", b, " without error.")
 		}
 	}
@@ -350,7 +474,7 @@ func testInfiniteLoop(prog string) error {
 
 	argsP := []string{"-h", "00", Config.EcdsaX, Config.EcdsaY, "00", "DEADC0DE"}
 	out, err := runProg(prog, id, argsP)
-	if err != nil && strings.Contains(err.Error(), "STOP") {
+	if isHang(err) {
 		LogError.Println(prog, "failed and run into an infinite loop.")
 		return fmt.Errorf("%s runned into a degenerate infinite loop: %v", prog, err)
 	} else if err != nil {
@@ -362,3 +486,62 @@ func testInfiniteLoop(prog string) error {
 	LogWarning.Println(prog, "didn't run into an infinite loop, but did not fail when running:\n", prog, argsP)
 	return nil
 }
+
+// testEcdsaOrderDigests signs with -h digests parametrised by the curve: the
+// ones whose truncation to the bit length of n is n, n+1 or all ones, which
+// must be reduced modulo n, and p, to catch a reduction modulo p. On odd-sized
+// curves such as P-521, the truncation keeps the leftmost bits of the last
+// byte. The signatures are checked by cdf itself, since the other program may
+// share the bug.
+func testEcdsaOrderDigests(prog string) error {
+	curve, ok := keyCurve()
+	if !ok {
+		return nil
+	}
+	LogInfo.Printf("testing %s against the digests parametrised by the order of %s.\n", prog, curve.name)
+	ints, _ := parseHex(Config.EcdsaX, Config.EcdsaY)
+	one := big.NewInt(1)
+	cases := []struct {
+		name string
+		z    *big.Int
+	}{
+		{"n", curve.n},
+		{"n+1", new(big.Int).Add(curve.n, one)},
+		{"all ones", new(big.Int).Sub(new(big.Int).Lsh(one, uint(curve.n.BitLen())), one)},
+	}
+	if curve.p.BitLen() <= curve.n.BitLen() {
+		cases = append(cases, struct {
+			name string
+			z    *big.Int
+		}{"p", curve.p})
+	}
+
+	var mainErr MultiError
+	for _, c := range cases {
+		digest := curve.digestOf(c.z)
+		id := "ecdsa#digest#" + c.name + "_" + prog
+		argsP := []string{"-h", hex.EncodeToString(digest), Config.EcdsaX, Config.EcdsaY, Config.EcdsaD, "DEADC0DE"}
+		out, err := runProg(prog, id, argsP)
+		if err != nil {
+			LogToFile.Println("On", id, prog, "failed:", out, "\nGot error:", err)
+			LogInfo.Printf("%s refused to sign the digest truncated to %s on %s.\n", prog, c.name, curve.name)
+			continue
+		}
+		r, s, ok := splitSignature(out)
+		rs, parsed := parseHex(r, s)
+		if !ok || !parsed || !curve.verify(ints[0], ints[1], digest, rs[0], rs[1]) {
+			LogWarning.Printf("%s produced an invalid signature of the digest truncated to %s on %s.\n",
+				prog, c.name, curve.name)
+			addFinding(Finding{Test: "ecdsa.points", Progs: []string{prog}, Inputs: argsP,
+				Message: fmt.Sprintf("invalid signature of the digest truncated to %s on %s", c.name, curve.name)})
+			mainErr = append(mainErr, fmt.Errorf("%s produced an invalid signature of the digest truncated to %s on %s:\n%s",
+				prog, c.name, curve.name, out))
+			continue
+		}
+		LogSuccess.Printf("%s correctly signed the digest truncated to %s on %s.\n", prog, c.name, curve.name)
+	}
+	if len(mainErr) > 0 {
+		return mainErr
+	}
+	return nil
+}
@@ -17,6 +17,8 @@ import (
 func TestTestECDSA(t *testing.T) {
 	initForTesting("ECDSA")
 	Config.Timeout = 1
+	Config.Capabilities = map[string]Capabilities{Prog1: {}}
+	defer func() { Config.Capabilities = nil }()
 	t.Run("testEcdsaMsgLen", func(*testing.T) {
 		err := testEcdsaMsgLen()
 		if err != nil {
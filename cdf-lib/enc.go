@@ -3,10 +3,8 @@ package cdf
 import (
 	"errors"
 	"fmt"
-	"log"
 	mrand "math/rand"
 	"strconv"
-	"sync"
 	"time"
 )
 
@@ -15,6 +13,13 @@ import (
 func TestEnc() error {
 	LogInfo.Print("testing enc")
 
+	// calibrating the timeouts on a short and a long message
+	for _, prog := range []string{Prog1, Prog2} {
+		calibrateTimeout(prog,
+			[]string{warmupMsg(Config.MinKeyLen), warmupMsg(Config.MinMsgLen)},
+			[]string{warmupMsg(Config.MinKeyLen), warmupMsg(Config.MaxMsgLen)})
+	}
+
 	failed := false
 
 	// to warn if the used Config won't cover the whole range
@@ -34,18 +39,35 @@ func TestEnc() error {
 	msgAvgNibbles := 2 * ((Config.MaxMsgLen + Config.MinMsgLen) / 2)
 
 	// Let us call the message length test
-	err := testMessLen(key[:keyAvgNibbles], msg)
-	if err != nil {
-		failed = true
+	if subTest("enc.msgLen") {
+		if err := testMessLen(key[:keyAvgNibbles], msg); err != nil {
+			failed = true
+		}
 	}
 
 	// Let us call the key length test
-	err = testKeyLen(key, msg[:msgAvgNibbles])
-	if err != nil {
-		failed = true
+	if subTest("enc.keyLen") {
+		if err := testKeyLen(key, msg[:msgAvgNibbles]); err != nil {
+			failed = true
+		}
+	}
+
+	// Let us check both operations are deterministic, the decryption being
+	// checked on a ciphertext from Prog1
+	if subTest("enc.properties") {
+		checks := []propertyCheck{{prog: Prog1, op: "encrypting", args: []string{key[:keyAvgNibbles], msg}}}
+		if Config.PropertyRuns > 1 {
+			if cipher, err := runProg(Prog1, "property#cipher", []string{key[:keyAvgNibbles], msg}); err == nil {
+				checks = append(checks, propertyCheck{prog: Prog2, op: "decrypting", args: []string{key[:keyAvgNibbles], cipher}})
+			}
+		}
+		if err := testProperties(checks...); err != nil {
+			failed = true
+			LogError.Println("while testing determinism:", err)
+		}
 	}
 
-	if limit := *TestTimings; limit > 0 {
+	if limit := *TestTimings; limit > 0 && subTest("enc.timing") {
 		dudectTest(limit, Prog1, doOneComputationForEnc, prepareInutsForEnc)
 		dudectTest(limit, Prog2, doOneComputationForEnc, prepareInutsForEnc)
 	}
@@ -76,30 +98,24 @@ func testMessLen(key string, msg string) (mainErr error) {
 	return testProgs(key, chooseMsg, loopMessLen(msg))
 }
 
-// loopMessLen is the loop wich is to be used for the testProgs function in
+// loopMessLen returns the messages to be used by the testProgs function in
 //  the message length case
-func loopMessLen(msg string) func(chan string) {
-	return func(msgs chan string) {
-		TermPrepareFor(1)
-		for i := Config.MinMsgLen; i <= Config.MaxMsgLen; i += Config.IncrementMsg {
-			TermPrintInline(1, "%d / %d", i, Config.MaxMsgLen)
-			// get the first i bytes, ie first i*2 nibbles
-			msgs <- msg[:(i * 2)]
-		}
+func loopMessLen(msg string) (msgs []string) {
+	for i := Config.MinMsgLen; i <= Config.MaxMsgLen; i += Config.IncrementMsg {
+		// get the first i bytes, ie first i*2 nibbles
+		msgs = append(msgs, msg[:(i*2)])
 	}
+	return
 }
 
-// loopKeyLen is the loop wich is to be used for the testProgs function in
+// loopKeyLen returns the keys to be used by the testProgs function in
 //  the key length case
-func loopKeyLen(key string) func(chan string) {
-	return func(keys chan string) {
-		TermPrepareFor(1)
-		for i := Config.MinKeyLen; i <= Config.MaxKeyLen; i += Config.IncrementKey {
-			TermPrintInline(1, "%d / %d", i, Config.MaxKeyLen)
-			// get the first i bytes, ie first i*2 nibbles
-			keys <- key[:(i * 2)]
-		}
+func loopKeyLen(key string) (keys []string) {
+	for i := Config.MinKeyLen; i <= Config.MaxKeyLen; i += Config.IncrementKey {
+		// get the first i bytes, ie first i*2 nibbles
+		keys = append(keys, key[:(i*2)])
 	}
+	return
 }
 
 // chooseKey fixes the key and the message to the provided arguments
@@ -118,70 +134,57 @@ func chooseMsg(fixed, iterated string) (k string, m string) {
 
 // testProgs is the basic test in charge of checking the programs Prog1 and
 //  Prog2 are respectively encrypting and decrypting correctly with the key
-//  and msg arguments permuted as per chooseArgs, the loop function to provide
-//  the jobs must be provided. Concurrency is supported, as setted in config.json.
-func testProgs(fixed string, chooseArgs func(string, string) (string, string), loopOver func(chan string)) (mainErr error) {
-	nbIter := Config.MaxMsgLen
-	if Config.MaxKeyLen > nbIter {
-		nbIter = Config.MaxKeyLen
-	}
+//  and msg arguments permuted as per chooseArgs, for each of the iterated
+//  values. The jobs are submitted to the scheduler, which runs them
+//  concurrently as set in config.json.
+func testProgs(fixed string, chooseArgs func(string, string) (string, string), iterated []string) (mainErr error) {
+	TermPrepareFor(1)
+	jobs := newJobGroup("enc", len(iterated))
+	for _, it := range iterated {
+		// here we firstly permute the arguments to match our case
+		k, m := chooseArgs(fixed, it)
+		jobs.Go(func() error {
+			// we define a job id for logging purpose
+			id := "enc#" + strconv.Itoa(len(m)) + "#" + strconv.Itoa(len(k))
+			cipher, err := runOrClassify("enc", Prog1, id, k, m)
+			if err != nil {
+				return err
+			}
+			outStr2, err := runOrClassify("enc", Prog2, id, k, cipher)
+			if err != nil {
+				return err
+			}
 
-	// Initializing a common, unbuffered, channel which gives tasks to the worker goroutines
-	jobs := make(chan string)
-	errs := make(chan error, nbIter)
-
-	var wg sync.WaitGroup
-	// spawn some worker goroutines according to the Concurrency setting in Config.json
-	for j := uint(0); j < Config.Concurrency; j++ {
-		wg.Add(1) //to be sure to finish all jobs
-		go func() {
-			for j := range jobs {
-				// here we firstly permute the arguments to match our case
-				k, m := chooseArgs(fixed, j)
-				// we define a job id for logging purpose
-				id := "enc#" + strconv.Itoa(len(m)) + "#" + strconv.Itoa(len(k))
-				cipher := runOrExitOnErr(Prog1, id, k, m)
-				outStr2 := runOrExitOnErr(Prog2, id, k, cipher)
-
-				if m != outStr2 {
-					fmt.Print("\n")
-					LogWarning.Printf("decryption mismatch on job %s\nInputs :%s %s\n"+
-						"Outputs\t1: %s\n\t2: %s\n",
-						id, k, m,
-						cipher, outStr2)
-					errs <- fmt.Errorf("decryption mismatch on job %s", id)
-				}
+			if m != outStr2 {
+				fmt.Print("\n")
+				LogWarning.Printf("decryption mismatch on job %s\nInputs :%s %s\n"+
+					"Outputs\t1: %s\n\t2: %s\n",
+					id, k, m,
+					cipher, outStr2)
+				// we rerun the failing case to see whether it reproduces
+				class := classifyFailure(func() (bool, error) {
+					cipher, err := runProg(Prog1, id, []string{k, m})
+					if err != nil {
+						return true, err
+					}
+					recovered, err := runProg(Prog2, id, []string{k, cipher})
+					return m != recovered, err
+				})
+				addFinding(Finding{Test: "enc", Progs: []string{Prog1, Prog2},
+					Inputs: []string{k, m}, Message: "decryption mismatch", Class: class.String()})
+				return fmt.Errorf("decryption mismatch on job %s, %v", id, class)
 			}
-			wg.Done() // report the job as finished
-		}()
+			return nil
+		})
 	}
 
-	// we call the loop function to iterate over the right objects
-	loopOver(jobs)
-
-	//we close our channel since it's unbuffered
-	close(jobs)
-	// let us wait for our workers to finish their jobs
-	wg.Wait()
-
-	if len(errs) > 0 {
-		// Initializing the return value
-		var mainErr MultiError
-		firstErr := true
-		for len(errs) > 0 {
-			e := <-errs
-			if firstErr {
-				firstErr = false
-				TermPrepareFor(1)
-				// This is not guaranteed to be the 1st one, but almost
-				LogInfo.Println("First error:", e)
-			}
-			mainErr = append(mainErr, e)
-		}
+	mainErr = jobs.Wait()
+	if mainErr != nil {
+		TermPrepareFor(1)
+		LogInfo.Println("First error:", mainErr.(MultiError)[0])
 		TermPrepareFor(1)
-		return mainErr
 	}
-	return nil
+	return mainErr
 }
 
 func prepareInutsForEnc() (inputData []string, classes []int) {
@@ -212,7 +215,7 @@ func doOneComputationForEnc(prog string) func(data string) {
 		msg := data[Config.MaxKeyLen:]
 		_, err := runProg(prog, "dudectTest", []string{key, msg})
 		if err != nil {
-			log.Fatal(err)
+			Fatalln(err)
 		}
 	}
 }
@@ -3,6 +3,7 @@ package cdf
 import (
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -42,3 +43,26 @@ func testsForEnc(args []string) {
 	// output for testing:
 	fmt.Println(msg)
 }
+
+func TestTestProperties(t *testing.T) {
+	initForTesting("ENC")
+	Config.PropertyRuns = 3
+	findings.list = nil
+	defer func() { Config.PropertyRuns, findings.list = 0, nil }()
+
+	// our ENC helper simply echoes the message, so it is deterministic
+	err := testProperties(propertyCheck{prog: "prog", op: "encrypting", args: []string{"00", "0011"}})
+	if err != nil {
+		t.Error("Expected nil, got ", err)
+	}
+	err = testProperties(propertyCheck{prog: "prog", op: "encrypting", args: []string{"00", "0011"}, random: true})
+	if err == nil || !strings.Contains(err.Error(), "not randomised") {
+		t.Error("Expected a randomisation error, got ", err)
+	}
+	if f := Findings(); len(f) != 1 || f[0].Progs[0] != "prog" || !strings.Contains(f[0].Message, "when encrypting") {
+		t.Error("Expected a finding of the violation, got ", f)
+	}
+	if execCounter != 6 {
+		t.Error("Expected 6 executions, got ", execCounter)
+	}
+}
@@ -0,0 +1,199 @@
+package cdf
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// explicitFlag is the flag giving the ECDSA verifiers the domain parameters
+// of the curve instead of its name, followed by p, a, b, Gx, Gy, n and the
+// cofactor h in hex. It comes after -C, in place of -h.
+const explicitFlag = "-P"
+
+// explicitCase is a set of domain parameters given with -P to a verifier,
+// along with a public key and a signature cdf made valid under them. Only the
+// legitimate parameters of the curve are to be accepted: the other ones let an
+// attacker choose the key the signature verifies under.
+type explicitCase struct {
+	name   string
+	params *ecCurve
+	x, y   *big.Int
+	r, s   *big.Int
+	valid  bool
+}
+
+// explicitCases returns the legitimate parameters of curve, with a signature
+// by d of the digest, and the forged ones:
+//   - the generator substituted by d'^-1 Q, so that the genuine public key Q
+//     is d'G' for a d' cdf knows, as in CVE-2020-0601;
+//   - another b, which the ECDSA formulas do not use, so that the genuine
+//     signature still verifies while the points are not on the curve;
+//   - a composite order, twice n, modulo which cdf signs with d;
+//   - the singular curve y² = x³, whose group is the additive one of GF(p)
+//     where the discrete logarithm is a mere division.
+func explicitCases(curve *ecCurve, d *big.Int, digest []byte) ([]explicitCase, error) {
+	x, y := curve.baseMult(d)
+	generic := func() *ecCurve {
+		c := *curve
+		c.std = nil
+		return &c
+	}
+	var cases []explicitCase
+	add := func(name string, params *ecCurve, x, y, d *big.Int, valid bool) error {
+		r, s, err := params.sign(d, digest, rand.Reader)
+		if err != nil {
+			return fmt.Errorf("cannot sign with the %s parameters: %v", name, err)
+		}
+		cases = append(cases, explicitCase{name: name, params: params, x: x, y: y, r: r, s: s, valid: valid})
+		return nil
+	}
+	if err := add("legitimate", curve, x, y, d, true); err != nil {
+		return nil, err
+	}
+
+	// the forged keys must differ from the genuine one, which may have been
+	// generated from the seeded Prng
+	substituted := generic()
+	d2, err := cryptoScalar(curve.n)
+	if err != nil {
+		return nil, err
+	}
+	substituted.gx, substituted.gy = curve.scalarMult(x, y, new(big.Int).ModInverse(d2, curve.n))
+	if err := add("substituted generator", substituted, x, y, d2, false); err != nil {
+		return nil, err
+	}
+
+	otherB := generic()
+	otherB.b = new(big.Int).Add(curve.b, big.NewInt(1))
+	otherB.b.Mod(otherB.b, curve.p)
+	cases = append(cases, explicitCase{name: "other b", params: otherB, x: x, y: y,
+		r: cases[0].r, s: cases[0].s})
+
+	composite := generic()
+	composite.n = new(big.Int).Lsh(curve.n, 1)
+	if err := add("composite order", composite, x, y, d, false); err != nil {
+		return nil, err
+	}
+
+	one := big.NewInt(1)
+	singular := &ecCurve{name: "singular", p: curve.p, a: new(big.Int), b: new(big.Int),
+		gx: one, gy: one, n: curve.p, h: 1}
+	if d2, err = cryptoScalar(curve.p); err != nil {
+		return nil, err
+	}
+	x2, y2 := singular.baseMult(d2)
+	if err := add("singular curve", singular, x2, y2, d2, false); err != nil {
+		return nil, err
+	}
+	return cases, nil
+}
+
+// cryptoScalar returns a random integer in [1, n-1], drawn from crypto/rand
+func cryptoScalar(n *big.Int) (*big.Int, error) {
+	k, err := rand.Int(rand.Reader, new(big.Int).Sub(n, big.NewInt(1)))
+	if err != nil {
+		return nil, err
+	}
+	return k.Add(k, big.NewInt(1)), nil
+}
+
+// explicitArgs returns the -P flag giving the parameters of the curve
+func explicitArgs(c *ecCurve) []string {
+	args := []string{explicitFlag}
+	for _, i := range []*big.Int{c.p, c.a, c.b, c.gx, c.gy, c.n, big.NewInt(c.h)} {
+		args = append(args, hex.EncodeToString(padTo(i.Bytes(), 1)))
+	}
+	return args
+}
+
+// explicitCurve returns the known curve whose parameters are the ones given
+// with -P
+func explicitCurve(params []*big.Int) (*ecCurve, bool) {
+	if len(params) != 7 {
+		return nil, false
+	}
+	for _, c := range ecCurves {
+		a := new(big.Int).Mod(params[1], c.p)
+		if c.p.Cmp(params[0]) == 0 && c.a.Cmp(a) == 0 && c.b.Cmp(params[2]) == 0 &&
+			c.gx.Cmp(params[3]) == 0 && c.gy.Cmp(params[4]) == 0 && c.n.Cmp(params[5]) == 0 &&
+			params[6].Cmp(big.NewInt(c.h)) == 0 {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// explicitParams tells whether a program supports the -P flag
+func explicitParams(c Capabilities) bool {
+	return c.ExplicitParams
+}
+
+// testEcdsaExplicit gives the verifiers supporting -P the parameters of
+// explicitCases on a message signed by cdf: the legitimate ones must be
+// accepted and the forged ones rejected.
+func testEcdsaExplicit() error {
+	curve, ok := keyCurve()
+	if !ok {
+		return errors.New("the ECDSA key is not on a known curve")
+	}
+	var progs []string
+	for _, prog := range []string{Prog1, Prog2} {
+		if capable("ecdsa.explicit", "the -P flag", explicitParams, prog) {
+			progs = append(progs, prog)
+		}
+	}
+	if len(progs) == 0 {
+		return nil
+	}
+	msg := "DEADC0DE"
+	hashed, ok := digest(msg)
+	if !ok {
+		return fmt.Errorf("unsupported hash %s", hashName())
+	}
+	d, _ := parseHex(Config.EcdsaD)
+	cases, err := explicitCases(curve, d[0], hashed)
+	if err != nil {
+		return err
+	}
+	LogInfo.Printf("testing the explicit parameters of %s and forged ones.\n", curve.name)
+
+	jobs := newJobGroup("ecdsa explicit parameters", len(progs)*len(cases))
+	for _, prog := range progs {
+		prog := prog
+		for _, c := range cases {
+			c := c
+			jobs.Go(func() error {
+				size := c.params.byteLen()
+				args := withArgs(explicitArgs(c.params),
+					hex.EncodeToString(padTo(c.x.Bytes(), size)), hex.EncodeToString(padTo(c.y.Bytes(), size)),
+					hex.EncodeToString(padTo(c.r.Bytes(), c.params.orderLen())),
+					hex.EncodeToString(padTo(c.s.Bytes(), c.params.orderLen())), msg)
+				out, err := runProg(prog, "ecdsa#explicit#"+c.name+"_"+prog, args)
+				accepted := err == nil && out == trueStr
+				switch {
+				case c.valid && !accepted:
+					LogWarning.Printf("%s rejected the legitimate parameters of %s.\n", prog, curve.name)
+					addFinding(Finding{Test: "ecdsa.explicit", Progs: []string{prog}, Inputs: args,
+						Message: "rejected a valid signature under the legitimate parameters of " + curve.name})
+					return fmt.Errorf("%s rejected a valid signature under the legitimate parameters of %s: %s",
+						prog, curve.name, out)
+				case !c.valid && accepted:
+					LogError.Printf("%s accepted a signature under the %s parameters.\n", prog, c.name)
+					addFinding(Finding{Test: "ecdsa.explicit", Progs: []string{prog}, Inputs: args,
+						Message: fmt.Sprintf("accepted a signature under the %s parameters", c.name)})
+					return fmt.Errorf("%s accepted a signature forged under the %s parameters of %s",
+						prog, c.name, curve.name)
+				case c.valid:
+					LogSuccess.Printf("%s accepted the legitimate parameters of %s.\n", prog, curve.name)
+				default:
+					LogSuccess.Printf("%s rejected the %s parameters.\n", prog, c.name)
+				}
+				return nil
+			})
+		}
+	}
+	return jobs.Wait()
+}
@@ -0,0 +1,99 @@
+package cdf
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestExplicitCases(t *testing.T) {
+	initForTesting("ECDSA")
+	digest := sha256.Sum256([]byte{0xde, 0xad, 0xc0, 0xde})
+	for _, name := range []string{"secp256r1", "secp224k1", "brainpoolP256r1"} {
+		curve, _ := curveByName(name)
+		cases, err := explicitCases(curve, randomScalar(Prng, curve.n), digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cases) != 5 {
+			t.Fatalf("Expected 5 cases, got %d", len(cases))
+		}
+		for _, c := range cases {
+			// the forgeries are genuine signatures under their parameters,
+			// but the ones of another b whose points are not on the curve
+			valid := c.params.verify(c.x, c.y, digest[:], c.r, c.s)
+			if valid != (c.name != "other b") {
+				t.Errorf("%s: unexpected validity %v of the %s signature", name, valid, c.name)
+			}
+			if c.name == "substituted generator" && c.params.gx.Cmp(curve.gx) == 0 {
+				t.Errorf("%s: the generator was not substituted", name)
+			}
+			if _, known := explicitCurve(parseArgs(t, explicitArgs(c.params))); known != c.valid {
+				t.Errorf("%s: expected the %s parameters to be known: %v", name, c.name, c.valid)
+			}
+		}
+	}
+}
+
+func TestEcdsaExplicit(t *testing.T) {
+	// the built-in program only accepts the parameters of the named curves
+	withBuiltins(t, "ecdsa", "builtin:ecdsa-p256-sha256", "builtin:ecdsa-p256-sha256")
+	if err := testEcdsaExplicit(); err != nil {
+		t.Error(err)
+	}
+
+	// unless it declares not to support -P
+	Config.Capabilities = map[string]Capabilities{Prog1: {Prehashed: true}}
+	defer func() { Config.Capabilities = nil }()
+	ResetCapabilities()
+	skips.list = nil
+	defer func() { skips.list = nil }()
+	if err := testEcdsaExplicit(); err != nil || len(skips.list) != 1 || !strings.Contains(skips.list[0], "-P") {
+		t.Errorf("Expected the test to be skipped, got %v and %v", err, skips.list)
+	}
+}
+
+// laxExplicitEcdsa is builtin:ecdsa-p256-sha256 verifying the signatures
+// under any parameters given with -P, instead of the ones of known curves
+func laxExplicitEcdsa(args []string) (string, error) {
+	if len(args) != 13 || args[0] != explicitFlag {
+		return builtinEcdsa(args)
+	}
+	ints, err := builtinInts(args[1:12]...)
+	if err != nil {
+		return "", err
+	}
+	digest, err := builtinDigest(crypto.SHA256, args[12])
+	if err != nil {
+		return "", err
+	}
+	curve := &ecCurve{name: "explicit", p: ints[0], a: ints[1], b: ints[2], gx: ints[3], gy: ints[4],
+		n: ints[5], h: ints[6].Int64()}
+	return fmt.Sprint(curve.verify(ints[7], ints[8], digest, ints[9], ints[10])), nil
+}
+
+func TestEcdsaExplicitLax(t *testing.T) {
+	lax := registerBuiltin(t, "ecdsa-lax-explicit", "ecdsa-p256-sha256", laxExplicitEcdsa)
+	withBuiltins(t, "ecdsa", lax, "builtin:ecdsa-p256-sha256")
+	if err := testEcdsaExplicit(); err == nil {
+		t.Fatal("Expected the forged parameters to be accepted")
+	}
+	if !hasFinding(lax, "accepted a signature under the substituted generator parameters") {
+		t.Errorf("Expected a finding on the substituted generator, got %v", Findings())
+	}
+	if hasFinding("builtin:ecdsa-p256-sha256", "accepted a signature under the substituted generator parameters") {
+		t.Error("The built-in program accepted the substituted generator")
+	}
+}
+
+// parseArgs parses the hex integers following the flag
+func parseArgs(t *testing.T, args []string) []*big.Int {
+	ints, ok := parseHex(args[1:]...)
+	if !ok {
+		t.Fatalf("Invalid hex arguments %v", args)
+	}
+	return ints
+}
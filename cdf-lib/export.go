@@ -0,0 +1,342 @@
+package cdf
+
+import (
+	"crypto"
+	"crypto/dsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// testVector is a case run by cdf, written as a Wycheproof test case of the
+// given group so that it can be exported.
+type testVector struct {
+	group wycheproofGroup
+	test  wycheproofTest
+}
+
+// exportNotes describes the flags set on the exported test vectors
+var exportNotes = map[string]string{
+	"Mismatch":                "The tested programs disagreed on this case, the result is computed by cdf.",
+	"Generated":               "A case generated by cdf, on which the tested programs agreed.",
+	"RangeCheck":              "The signature contains integers out of the range [1, q-1], it must be rejected.",
+	"BerEncodedSignature":     "The signature is BER but not DER encoded, it must be rejected.",
+	"InvalidEncoding":         "The signature is not a valid encoding of r and s, it must be rejected.",
+	"InvalidPublicKey":        "The public key is not a valid point, the signature must be rejected.",
+	"InvalidDomainParameters": "The signature was produced with invalid domain parameters, it must be rejected.",
+	"InvalidPrivateKey":       "The signature was produced with an invalid private key, the result is computed by cdf.",
+	"LargeCiphertext":         "The ciphertext is not smaller than the modulus, it must be rejected.",
+}
+
+// vectors stores the test vectors recorded so far by the different tests
+var vectors = struct {
+	sync.Mutex
+	list []testVector
+}{}
+
+// addVector records a test vector exposing a finding, it is safe to call from
+// concurrent jobs
+func addVector(v testVector, ok bool) {
+	if !ok {
+		return
+	}
+	vectors.Lock()
+	vectors.list = append(vectors.list, v)
+	vectors.Unlock()
+}
+
+// addGeneratedVector records a generated case, which is only exported if all
+// the cases are to be exported
+func addGeneratedVector(v testVector, ok bool) {
+	if ExportAll != nil && *ExportAll {
+		addVector(v, ok)
+	}
+}
+
+// ExportVectors writes the recorded test vectors to file as a Wycheproof test
+// vectors file, the cases being grouped by type and key. It returns the
+// number of exported test cases.
+func ExportVectors(file string) (int, error) {
+	vectors.Lock()
+	list := append([]testVector(nil), vectors.list...)
+	vectors.Unlock()
+
+	// the jobs record their vectors in any order, so we sort them to get
+	// stable tcIds
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if ka, kb := a.group.id(), b.group.id(); ka != kb {
+			return ka < kb
+		}
+		if a.test.Comment != b.test.Comment {
+			return a.test.Comment < b.test.Comment
+		}
+		return a.test.Msg+a.test.Sig+a.test.Ct+a.test.Tag < b.test.Msg+b.test.Sig+b.test.Ct+b.test.Tag
+	})
+
+	out := wycheproofFile{
+		Algorithm: strings.ToUpper(Interf),
+		Header:    []string{"Test vectors exported by cdf from its findings."},
+		Notes:     make(map[string]string),
+	}
+	groups := make(map[string]int)
+	seen := make(map[string]bool)
+	for _, v := range list {
+		// the same case may have been run against both programs
+		key := v.group.id() + "|" + v.test.Comment + "|" + v.test.Key + "|" + v.test.Msg + "|" +
+			v.test.Sig + "|" + v.test.Ct + "|" + v.test.Tag
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		out.NumberOfTests++
+		v.test.TcID = out.NumberOfTests
+		if v.test.Flags == nil {
+			v.test.Flags = []string{}
+		}
+		for _, flag := range v.test.Flags {
+			out.Notes[flag] = exportNotes[flag]
+		}
+		id := v.group.id()
+		if _, ok := groups[id]; !ok {
+			groups[id] = len(out.TestGroups)
+			out.TestGroups = append(out.TestGroups, v.group)
+		}
+		g := &out.TestGroups[groups[id]]
+		g.Tests = append(g.Tests, v.test)
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return 0, err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		f.Close()
+		return 0, err
+	}
+	return out.NumberOfTests, f.Close()
+}
+
+// id identifies the group by its type and key material
+func (g *wycheproofGroup) id() string {
+	n, e, d := g.rsaKey()
+	return strings.Join([]string{g.Type, g.Sha, g.describeKey(), n, e, d}, "|")
+}
+
+// configHash returns the hash used by the tested programs
+func configHash() (crypto.Hash, bool) {
+	name := Config.Hash
+	if name == "" {
+		name = "SHA-256"
+	}
+	for _, h := range cavpHashes {
+		if strings.EqualFold(h.name, name) {
+			return h.hash, h.hash.Available()
+		}
+	}
+	return 0, false
+}
+
+// digest hashes the hex encoded message with the configured hash
+func digest(msg string) ([]byte, bool) {
+	h, ok := configHash()
+	m, err := hex.DecodeString(msg)
+	if !ok || err != nil {
+		return nil, false
+	}
+	hasher := h.New()
+	hasher.Write(m)
+	return hasher.Sum(nil), true
+}
+
+// parseHex converts the hex strings to integers, it does not exit on error
+// unlike fromBase16 since those may be outputs of the tested programs
+func parseHex(values ...string) ([]*big.Int, bool) {
+	ints := make([]*big.Int, len(values))
+	for i, v := range values {
+		var ok bool
+		if ints[i], ok = new(big.Int).SetString(v, 16); !ok {
+			return nil, false
+		}
+	}
+	return ints, true
+}
+
+// verdict converts the result of a verification to a Wycheproof result
+func verdict(valid bool) string {
+	if valid {
+		return wycheValid
+	}
+	return wycheInvalid
+}
+
+// derSignatureHex encodes r and s as a hex DER signature
+func derSignatureHex(r, s *big.Int) (string, bool) {
+	der, err := asn1.Marshal(derSignature{R: r, S: s})
+	return hex.EncodeToString(der), err == nil
+}
+
+// ecdsaVector builds an EcdsaVerify test vector for the signature (r, s) of
+// msg under the public key (x, y). If result is empty, it is computed by
+// verifying the signature.
+func ecdsaVector(x, y, r, s, msg, result, comment string, flags ...string) (testVector, bool) {
+	ints, ok := parseHex(x, y, r, s)
+	if !ok {
+		return testVector{}, false
+	}
+	sig, ok := derSignatureHex(ints[2], ints[3])
+	if !ok {
+		return testVector{}, false
+	}
+	curve, onCurve := curveOf(ints[0], ints[1])
+	name := ""
+	if onCurve {
+		name = curve.name
+	}
+	if result == "" {
+		hashed, ok := digest(msg)
+		if !ok || !onCurve {
+			return testVector{}, false
+		}
+		result = verdict(curve.verify(ints[0], ints[1], hashed, ints[2], ints[3]))
+	}
+	return testVector{
+		group: wycheproofGroup{Type: "EcdsaVerify", Sha: hashName(),
+			Key: &wycheproofKey{Type: "EcPublicKey", Curve: name, Wx: x, Wy: y}},
+		test: wycheproofTest{Comment: comment, Msg: msg, Sig: sig, Result: result, Flags: flags},
+	}, true
+}
+
+// dsaVector builds a DsaVerify test vector for the signature (r, s) of msg
+// under the given public key. If result is empty, it is computed by verifying
+// the signature.
+func dsaVector(p, q, g, y, r, s, msg, result, comment string, flags ...string) (testVector, bool) {
+	ints, ok := parseHex(p, q, g, y, r, s)
+	if !ok {
+		return testVector{}, false
+	}
+	sig, ok := derSignatureHex(ints[4], ints[5])
+	if !ok {
+		return testVector{}, false
+	}
+	if result == "" {
+		hashed, ok := digest(msg)
+		if !ok {
+			return testVector{}, false
+		}
+		pub := &dsa.PublicKey{Parameters: dsa.Parameters{P: ints[0], Q: ints[1], G: ints[2]}, Y: ints[3]}
+		// FIPS 186-3 uses the leftmost min(N, outlen) bits of the digest
+		if n := (pub.Q.BitLen() + 7) / 8; n < len(hashed) {
+			hashed = hashed[:n]
+		}
+		result = verdict(dsa.Verify(pub, hashed, ints[4], ints[5]))
+	}
+	return testVector{
+		group: wycheproofGroup{Type: "DsaVerify", Sha: hashName(),
+			Key: &wycheproofKey{Type: "DsaPublicKey", P: p, Q: q, G: g, Y: y}},
+		test: wycheproofTest{Comment: comment, Msg: msg, Sig: sig, Result: result, Flags: flags},
+	}, true
+}
+
+// rsaSignVector builds a RsassaPkcs1Verify test vector for the signature sig
+// of msg, its result is computed by verifying the signature.
+func rsaSignVector(n, e, sig, msg, comment string, flags ...string) (testVector, bool) {
+	ints, ok := parseHex(n, e, sig)
+	hashed, hashOk := digest(msg)
+	h, _ := configHash()
+	if !ok || !hashOk || !ints[1].IsInt64() {
+		return testVector{}, false
+	}
+	pub := &rsa.PublicKey{N: ints[0], E: int(ints[1].Int64())}
+	signature := padTo(ints[2].Bytes(), (ints[0].BitLen()+7)/8)
+	valid := rsa.VerifyPKCS1v15(pub, h, hashed, signature) == nil
+	return testVector{
+		group: wycheproofGroup{Type: "RsassaPkcs1Verify", Sha: hashName(), N: n, E: e},
+		test: wycheproofTest{Comment: comment, Msg: msg, Sig: hex.EncodeToString(signature),
+			Result: verdict(valid), Flags: flags},
+	}, true
+}
+
+// rsaOaepVector builds a RsaesOaepDecrypt test vector for the ciphertext ct,
+// which is expected to decrypt to msg unless result is set.
+func rsaOaepVector(n, e, d, ct, msg, result, comment string, flags ...string) (testVector, bool) {
+	ints, ok := parseHex(n, e, d, ct)
+	if !ok {
+		return testVector{}, false
+	}
+	if result == "" {
+		h, hashOk := configHash()
+		p, q, err := factorModulus(ints[0], ints[1], ints[2])
+		if !hashOk || err != nil || !ints[1].IsInt64() {
+			return testVector{}, false
+		}
+		priv := &rsa.PrivateKey{PublicKey: rsa.PublicKey{N: ints[0], E: int(ints[1].Int64())},
+			D: ints[2], Primes: []*big.Int{p, q}}
+		c := padTo(ints[3].Bytes(), (ints[0].BitLen()+7)/8)
+		plain, err := rsa.DecryptOAEP(h.New(), nil, priv, c, nil)
+		result = verdict(err == nil && hex.EncodeToString(plain) == strings.ToLower(msg))
+		if err != nil {
+			msg = ""
+		} else {
+			msg = hex.EncodeToString(plain)
+		}
+	}
+	return testVector{
+		group: wycheproofGroup{Type: "RsaesOaepDecrypt", Sha: hashName(), MgfSha: hashName(),
+			KeySize: ints[0].BitLen(), N: n, E: e, D: d},
+		test: wycheproofTest{Comment: comment, Msg: msg, Ct: ct, Result: result, Flags: flags},
+	}, true
+}
+
+// macVector builds a MacTest test vector for msg under key, with the tag
+// computed by cdf.
+func macVector(key, msg, comment string, flags ...string) (testVector, bool) {
+	h, ok := configHash()
+	k, errK := hex.DecodeString(key)
+	m, errM := hex.DecodeString(msg)
+	if !ok || errK != nil || errM != nil {
+		return testVector{}, false
+	}
+	mac := hmac.New(h.New, k)
+	mac.Write(m)
+	return testVector{
+		group: wycheproofGroup{Type: "MacTest", KeySize: 8 * len(k), TagSize: 8 * h.Size()},
+		test: wycheproofTest{Comment: comment, Key: key, Msg: msg,
+			Tag: hex.EncodeToString(mac.Sum(nil)), Result: wycheValid, Flags: flags},
+	}, true
+}
+
+// splitSignature returns the r and s values output by a signing program
+func splitSignature(out string) (r, s string, ok bool) {
+	parts := strings.Split(out, "\n")
+	if len(parts) < 2 {
+		return "", "", false
+	}
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), true
+}
+
+// padTo left pads the input with zeros to size bytes, unlike leftPad it does
+// not truncate longer inputs
+func padTo(input []byte, size int) []byte {
+	if len(input) >= size {
+		return input
+	}
+	return leftPad(input, size)
+}
+
+// hashName is the Wycheproof name of the configured hash
+func hashName() string {
+	if Config.Hash == "" {
+		return "SHA-256"
+	}
+	return strings.ToUpper(Config.Hash)
+}
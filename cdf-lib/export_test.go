@@ -0,0 +1,96 @@
+package cdf
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"path/filepath"
+	"testing"
+)
+
+func TestVectorResults(t *testing.T) {
+	Config.Hash = "SHA-256"
+	defer func() { Config.Hash = "" }()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := "434343"
+	hashed := sha256.Sum256([]byte("CCC"))
+	r, s, err := ecdsa.Sign(rand.Reader, key, hashed[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, y := key.X.Text(16), key.Y.Text(16)
+
+	v, ok := ecdsaVector(x, y, r.Text(16), s.Text(16), msg, "", "valid")
+	if !ok || v.test.Result != wycheValid || v.group.publicKey().Curve != "secp256r1" {
+		t.Errorf("Expected a valid P-256 vector, got %+v", v)
+	}
+	v, ok = ecdsaVector(x, y, r.Text(16), s.Text(16), "434344", "", "other message")
+	if !ok || v.test.Result != wycheInvalid {
+		t.Errorf("Expected an invalid vector, got %+v", v)
+	}
+	if _, ok = ecdsaVector(x, y, "zz", s.Text(16), msg, "", "garbage"); ok {
+		t.Error("Expected no vector for a garbage output")
+	}
+
+	// the HMAC-SHA256 test case 2 of RFC 4231
+	v, ok = macVector("4a656665", "7768617420646f2079612077616e7420666f72206e6f7468696e673f", "rfc4231")
+	if !ok || v.test.Tag != "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843" {
+		t.Errorf("Wrong tag %s", v.test.Tag)
+	}
+}
+
+func TestExportVectors(t *testing.T) {
+	Config.Hash = "SHA-256"
+	// the other tests may have recorded findings already
+	vectors.list = nil
+	defer func() {
+		Config.Hash = ""
+		vectors.list = nil
+	}()
+
+	for _, a := range []string{"00", "01"} {
+		// the same case recorded for both programs is exported once
+		for i := 0; i < 2; i++ {
+			addVector(ecdsaVector("0a", "0b", a, "01", "434343", wycheInvalid, "r="+a, "RangeCheck"))
+		}
+	}
+	addVector(macVector("00", "", "empty message", "Generated"))
+
+	file := filepath.Join(t.TempDir(), "vectors.json")
+	nb, err := ExportVectors(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nb != 3 {
+		t.Errorf("Expected 3 test vectors, got %d", nb)
+	}
+
+	exported, err := loadWycheproof(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exported.NumberOfTests != 3 || len(exported.TestGroups) != 2 {
+		t.Fatalf("Expected 3 tests in 2 groups, got %d in %d", exported.NumberOfTests, len(exported.TestGroups))
+	}
+	if _, ok := exported.Notes["RangeCheck"]; !ok {
+		t.Error("Missing the note of the RangeCheck flag")
+	}
+	tcID := 0
+	for i := range exported.TestGroups {
+		for _, test := range exported.TestGroups[i].Tests {
+			tcID++
+			if test.TcID != tcID {
+				t.Errorf("Expected tcId %d, got %d", tcID, test.TcID)
+			}
+			// the exported vectors can be run back by cdf
+			if _, err := wycheproofToCase(&exported.TestGroups[i], test); err != nil {
+				t.Errorf("tcId %d cannot be run: %v", test.TcID, err)
+			}
+		}
+	}
+}
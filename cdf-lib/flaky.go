@@ -0,0 +1,157 @@
+package cdf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// failureKind tells how a failure reproduces when rerun
+type failureKind int
+
+// The different kinds of failures: deterministic ones reproduce on every
+// rerun, typically logic bugs, intermittent ones only on some reruns,
+// typically memory corruption or RNG bugs, and environmental ones are due to
+// timeouts or resource exhaustion.
+const (
+	failDeterministic failureKind = iota
+	failIntermittent
+	failEnvironmental
+)
+
+// String implements the Stringer interface for failureKind
+func (k failureKind) String() string {
+	switch k {
+	case failDeterministic:
+		return "deterministic"
+	case failIntermittent:
+		return "intermittent"
+	case failEnvironmental:
+		return "environmental"
+	}
+	return "unknown"
+}
+
+// classification is the outcome of rerunning a failing case: how many of the
+// reruns reproduced the failure and how many failed for environmental reasons.
+type classification struct {
+	Kind       failureKind
+	Reproduced int
+	EnvErrors  int
+	Runs       int
+	// EnvFailure is set when the failure classified was itself a timeout or
+	// a resource error
+	EnvFailure bool
+}
+
+// String implements the Stringer interface for classification, the observed
+// rate includes the original failure.
+func (c classification) String() string {
+	switch c.Kind {
+	case failIntermittent:
+		return fmt.Sprintf("intermittent (observed rate %d/%d, %.0f%%)",
+			c.Reproduced+1, c.Runs+1, 100*float64(c.Reproduced+1)/float64(c.Runs+1))
+	case failEnvironmental:
+		if c.EnvFailure {
+			return fmt.Sprintf("environmental (a timeout or resource error, again on %d/%d reruns)",
+				c.EnvErrors, c.Runs)
+		}
+		return fmt.Sprintf("environmental (timeouts or resource errors on %d/%d reruns)",
+			c.EnvErrors, c.Runs)
+	}
+	return fmt.Sprintf("%s (reproduced on %d/%d reruns)", c.Kind, c.Reproduced, c.Runs)
+}
+
+// isEnvironmental tells whether the error returned by runProg is due to the
+// environment rather than to the tested program's logic: a timeout, or the
+// program being killed or failing because of exhausted resources.
+func isEnvironmental(err error) bool {
+	if err == nil {
+		return false
+	}
+	if isHang(err) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{"signal: killed", "resource temporarily unavailable",
+		"cannot allocate memory", "too many open files", "no space left on device"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// classifyFailure reruns a failing case Config.Reruns times to classify it.
+// The rerun function must run the case again and tell whether the failure
+// reproduced, the errors it returns count as reproductions unless they are
+// environmental. If reruns are disabled, the failure is considered
+// deterministic, as cdf used to assume.
+func classifyFailure(rerun func() (bool, error)) classification {
+	c := classification{Kind: failDeterministic, Runs: Config.Reruns}
+	if c.Runs <= 0 {
+		c.Runs = 0
+		return c
+	}
+	for i := 0; i < c.Runs; i++ {
+		failed, err := rerun()
+		switch {
+		case isEnvironmental(err):
+			c.EnvErrors++
+		case err != nil || failed:
+			c.Reproduced++
+		}
+	}
+
+	switch {
+	case c.Reproduced == c.Runs:
+		c.Kind = failDeterministic
+	case c.Reproduced == 0 && c.EnvErrors > 0:
+		c.Kind = failEnvironmental
+	default:
+		c.Kind = failIntermittent
+	}
+	return c
+}
+
+// classifyRunError classifies the error err returned by runProg when running
+// prog on args, by running it again as classifyFailure does. A timeout or a
+// resource error stays environmental unless the reruns reproduce the failure
+// otherwise, since a program may time out once in a while under load.
+func classifyRunError(err error, prog, id string, args []string) classification {
+	c := classifyFailure(func() (bool, error) {
+		_, err := runProg(prog, id, args)
+		return err != nil, err
+	})
+	if isEnvironmental(err) && c.Reproduced == 0 {
+		c.Kind, c.EnvFailure = failEnvironmental, true
+	}
+	return c
+}
+
+// rerunSignVerify reruns a dsa or ecdsa case, signing m using Prog1 with
+// argsP1 and verifying it using Prog2 with argsP2, and tells whether the
+// verification failed again.
+func rerunSignVerify(id string, argsP1, argsP2 []string, m string) (bool, error) {
+	out1, err := runProg(Prog1, id, argsP1)
+	if err != nil {
+		return true, err
+	}
+	out1Arr := strings.Split(out1, "\n")
+	if len(out1Arr) < 2 {
+		return true, nil
+	}
+	out2, err := runProg(Prog2, id, withArgs(argsP2,
+		strings.TrimSpace(out1Arr[0]), strings.TrimSpace(out1Arr[1]), m))
+	return out2 != trueStr, err
+}
+
+// rerunMatch reruns both programs on the same args, as in the xof and prf
+// interfaces, and tells whether their outputs mismatched again.
+func rerunMatch(id string, args []string) (bool, error) {
+	out1, err := runProg(Prog1, id, args)
+	if err != nil {
+		return true, err
+	}
+	out2, err := runProg(Prog2, id, args)
+	return out1 != out2, err
+}
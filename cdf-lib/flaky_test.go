@@ -0,0 +1,59 @@
+package cdf
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	initForTesting("ENC")
+	Config.Reruns = 4
+	defer func() { Config.Reruns = 0 }()
+
+	var count int
+	cases := []struct {
+		rerun    func() (bool, error)
+		expected failureKind
+	}{
+		{func() (bool, error) { return true, nil }, failDeterministic},
+		{func() (bool, error) { return false, errors.New("exit status 1") }, failDeterministic},
+		{func() (bool, error) { count++; return count%2 == 0, nil }, failIntermittent},
+		{func() (bool, error) { return false, nil }, failIntermittent},
+		{func() (bool, error) { return false, hangError{prog: "prog", timeout: time.Second} }, failEnvironmental},
+		{func() (bool, error) { return false, errors.New("signal: killed") }, failEnvironmental},
+	}
+	for i, c := range cases {
+		if class := classifyFailure(c.rerun); class.Kind != c.expected {
+			t.Errorf("case %d: expected %v, got %v", i, c.expected, class)
+		}
+	}
+
+	class := classifyFailure(func() (bool, error) { count++; return count%2 == 0, nil })
+	if !strings.Contains(class.String(), "3/5") {
+		t.Error("Expected an observed rate of 3/5, got", class)
+	}
+
+	// with reruns disabled, failures are assumed to be deterministic
+	Config.Reruns = -1
+	if class := classifyFailure(nil); class.Kind != failDeterministic || class.Runs != 0 {
+		t.Error("Expected a deterministic failure without reruns, got", class)
+	}
+}
+
+func TestClassifyRunError(t *testing.T) {
+	initForTesting("ENC")
+	Config.Reruns = 3
+	defer func() { Config.Reruns = 0 }()
+
+	// the built-in program answers on the reruns
+	args := []string{"00"}
+	class := classifyRunError(hangError{prog: "builtin:sha256", timeout: time.Second}, "builtin:sha256", "id", args)
+	if class.Kind != failEnvironmental || !class.EnvFailure {
+		t.Error("Expected a timeout not reproducing to be environmental, got", class)
+	}
+	if class := classifyRunError(errors.New("exit status 1"), "builtin:sha256", "id", args); class.Kind != failIntermittent {
+		t.Error("Expected an error not reproducing to be intermittent, got", class)
+	}
+}
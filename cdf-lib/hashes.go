@@ -0,0 +1,169 @@
+package cdf
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sync"
+)
+
+// hashFlag is the flag selecting the hash of the programs which declare
+// several ones, followed by its name. It comes before any other argument,
+// including -h.
+const hashFlag = "-H"
+
+// signatureHashes are the hashes the signature interfaces are tested with,
+// amongst the ones the programs declare
+var signatureHashes = []string{"SHA-1", "SHA-224", "SHA-256", "SHA-384", "SHA-512",
+	"SHA3-224", "SHA3-256", "SHA3-384", "SHA3-512"}
+
+// the interfaces whose tests are run with each of the hashes of the programs
+var hashAgile = map[string]bool{"dsa": true, "ecdsa": true, "rsasign": true}
+
+// selected are the hash and the curve currently selected, as given to the
+// programs, and the name of the curve
+var selected = struct {
+	sync.RWMutex
+	hash, curve map[string][]string
+	curveName   string
+}{}
+
+// TestedHashes returns the hashes Prog1 and Prog2 are tested with: the ones
+// of signatureHashes they both declare, the hash of Config first. A program
+// declaring no hash uses the one of Config, which is then the only one tested.
+func TestedHashes() []string {
+	candidates := []string{hashName()}
+	for _, name := range signatureHashes {
+		if name != hashName() {
+			candidates = append(candidates, name)
+		}
+	}
+	if !hashAgile[Interf] {
+		candidates = candidates[:1]
+	}
+	var hashes []string
+	for _, name := range candidates {
+		supported := true
+		for _, prog := range testedProgs() {
+			c := ProgramCapabilities(prog)
+			if len(c.Hashes) == 0 && name != hashName() || !c.SupportsHash(name) {
+				supported = false
+			}
+		}
+		if supported {
+			hashes = append(hashes, name)
+		}
+	}
+	return hashes
+}
+
+// selectHash sets the hash of Config, used by the oracle and the test
+// vectors, and passes it with -H to the programs declaring several hashes
+func selectHash(name string) {
+	args := make(map[string][]string)
+	for _, prog := range testedProgs() {
+		if len(ProgramCapabilities(prog).Hashes) > 1 {
+			args[prog] = []string{hashFlag, name}
+		}
+	}
+	selected.Lock()
+	Config.Hash = name
+	selected.hash = args
+	selected.Unlock()
+}
+
+// clearSelection forgets the hash and the curve selected for the programs
+func clearSelection() {
+	selected.Lock()
+	selected.hash, selected.curve, selected.curveName = nil, nil, ""
+	selected.Unlock()
+}
+
+// vectorBatch is the indices of the test vectors run with the same hash and
+// curve
+type vectorBatch struct {
+	hash, curve string
+	indices     []int
+}
+
+// vectorBatches splits n test vectors by the hash and the curve they are run
+// with, as given by paramsOf, keeping their order
+func vectorBatches(n int, paramsOf func(int) (hash, curve string)) []vectorBatch {
+	var batches []vectorBatch
+	byParams := make(map[[2]string]int)
+	for i := 0; i < n; i++ {
+		hash, curve := paramsOf(i)
+		b, ok := byParams[[2]string{hash, curve}]
+		if !ok {
+			b = len(batches)
+			byParams[[2]string{hash, curve}] = b
+			batches = append(batches, vectorBatch{hash: hash, curve: curve})
+		}
+		batches[b].indices = append(batches[b].indices, i)
+	}
+	return batches
+}
+
+// run runs the batch with its hash and curve selected, if any, and selects
+// the previous ones again afterwards
+func (b vectorBatch) run(run func()) {
+	selected.RLock()
+	hash, hashArgs := Config.Hash, selected.hash
+	curveArgs, curve := selected.curve, selected.curveName
+	selected.RUnlock()
+	if b.hash != "" {
+		selectHash(b.hash)
+	}
+	if b.curve != "" {
+		// the programs are given the curve by its name in cdf, whatever the
+		// alias of the test vectors
+		name := b.curve
+		if c, ok := curveByName(name); ok {
+			name = c.name
+		}
+		selectCurve(name)
+	}
+	run()
+	selected.Lock()
+	Config.Hash, selected.hash = hash, hashArgs
+	selected.curve, selected.curveName = curveArgs, curve
+	selected.Unlock()
+}
+
+// selectedArgs returns the arguments selecting the hash and the curve of
+// prog, if any
+func selectedArgs(prog string) []string {
+	selected.RLock()
+	defer selected.RUnlock()
+	return withArgs(selected.hash[prog], selected.curve[prog]...)
+}
+
+// testPrehashed signs with -h by Prog1 the genuine digest of msg, under the
+// selected hash, and verifies the message itself by Prog2: both must then
+// truncate the digest to the group order the same way, be it longer or
+// shorter. The key arguments are the ones preceding the signature.
+func testPrehashed(test string, keySign, keyVerify []string, msg string) error {
+	hashed, ok := digest(msg)
+	if !ok {
+		return nil
+	}
+	id := test + "#digest#" + hashName()
+	argsSign := withArgs(append([]string{"-h", hex.EncodeToString(hashed)}, keySign...), msg)
+	out, err := runProg(Prog1, id, argsSign)
+	if err != nil {
+		return fmt.Errorf("%s failed to sign the %s digest given with -h: %v", Prog1, hashName(), err)
+	}
+	r, s, ok := splitSignature(out)
+	if !ok {
+		return fmt.Errorf("%s did not output a signature of the %s digest: %s", Prog1, hashName(), out)
+	}
+	result, err := runProg(Prog2, id, withArgs(keyVerify, r, s, msg))
+	if err != nil || result != trueStr {
+		LogWarning.Printf("%s rejected the signature of the %s digest given with -h to %s\n",
+			Prog2, hashName(), Prog1)
+		addFinding(Finding{Test: test, Progs: []string{Prog1, Prog2}, Inputs: argsSign,
+			Message: fmt.Sprintf("signature of the %s digest given with -h rejected", hashName())})
+		return fmt.Errorf("%s rejected the signature of the %s digest given with -h to %s, on message %s",
+			Prog2, hashName(), Prog1, msg)
+	}
+	return nil
+}
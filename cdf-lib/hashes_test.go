@@ -0,0 +1,88 @@
+package cdf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTestedHashes(t *testing.T) {
+	initForTesting("RSA")
+	defer func() {
+		Config.Capabilities, Config.Hash = nil, ""
+		Prog1, Prog2, Interf = "", "", ""
+		ResetCapabilities()
+	}()
+	Config.Hash = "SHA-256"
+	Config.Capabilities = map[string]Capabilities{
+		"agile": {Hashes: []string{"SHA-384", "sha3-256"}},
+		"fixed": {Hashes: []string{"SHA-384"}},
+		"any":   {},
+	}
+
+	Prog1, Interf = "builtin:ecdsa-p256-sha256", "ecdsa"
+	tests := []struct {
+		prog2, hashes string
+	}{
+		{"agile", "SHA-384 SHA3-256"},
+		{"fixed", "SHA-384"},
+		{"any", "SHA-256"},
+		{"builtin:ecdsa-p256-sha256", "SHA-256 SHA-1 SHA-224 SHA-384 SHA-512 SHA3-224 SHA3-256 SHA3-384 SHA3-512"},
+	}
+	for _, test := range tests {
+		Prog2 = test.prog2
+		if hashes := strings.Join(TestedHashes(), " "); hashes != test.hashes {
+			t.Errorf("Expected %s to be tested with %s, got %s", test.prog2, test.hashes, hashes)
+		}
+	}
+
+	// only the programs declaring several hashes are given -H
+	Prog2 = "fixed"
+	selectHash("SHA-384")
+	if args := strings.Join(selectedArgs(Prog1), " "); args != "-H SHA-384" || len(selectedArgs(Prog2)) != 0 {
+		t.Errorf("Expected -H SHA-384 for %s only, got %q and %q", Prog1, args, selectedArgs(Prog2))
+	}
+	if Config.Hash != "SHA-384" {
+		t.Error("Expected the hash of Config to be selected, got", Config.Hash)
+	}
+
+	// the program declaring no hash uses the one of Config, SHA-256
+	Prog1, Prog2, Config.Hash = "fixed", "any", "SHA-256"
+	if err := NegotiateCapabilities(); err == nil {
+		t.Error("Expected the programs to have no hash in common")
+	}
+}
+
+func TestPrehashed(t *testing.T) {
+	initForTesting("RSA")
+	Config.Timeout = 10
+	defer func() {
+		Config.Hash = ""
+		Prog1, Prog2, Interf = "", "", ""
+		ResetCapabilities()
+	}()
+
+	// the built-in programs truncate the digests longer than the group order,
+	// and sign the messages with the selected hash as cdf's oracle does
+	Prog1, Prog2, Interf = "builtin:ecdsa-p256-sha256", "builtin:ecdsa-p256-sha256", "ecdsa"
+	for _, hash := range signatureHashes {
+		selectHash(hash)
+		if err := testPrehashed("ecdsa", []string{Config.EcdsaX, Config.EcdsaY, Config.EcdsaD},
+			[]string{Config.EcdsaX, Config.EcdsaY}, "434343"); err != nil {
+			t.Error(err)
+		}
+		out, err := runProg(Prog1, "test", []string{Config.EcdsaX, Config.EcdsaY, Config.EcdsaD, "434343"})
+		r, s, _ := splitSignature(out)
+		if v, ok := ecdsaVector(Config.EcdsaX, Config.EcdsaY, r, s, "434343", "", ""); err != nil || !ok || v.test.Result != wycheValid {
+			t.Errorf("Expected a valid %s signature, got %q (%v)", hash, out, err)
+		}
+	}
+
+	Prog1, Prog2, Interf = "builtin:dsa", "builtin:dsa", "dsa"
+	for _, hash := range []string{"SHA-1", "SHA-512"} {
+		selectHash(hash)
+		if err := testPrehashed("dsa", []string{Config.DsaP, Config.DsaQ, Config.DsaG, Config.DsaY, Config.DsaX},
+			[]string{Config.DsaP, Config.DsaQ, Config.DsaG, Config.DsaY}, "434343"); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package cdf
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// SubTest describes one of the tests run on an interface, its name is stable
+// so that it can be referred to from the command line or in reports.
+type SubTest struct {
+	Name string
+	Desc string
+}
+
+// Interface describes an interface CDF can test: the i/o expected from its
+// two programs, the sub-tests it runs and the function running them.
+type Interface struct {
+	Name     string
+	Prog1    string // the i/o of the first program
+	Prog2    string // the i/o of the second program
+	SubTests []SubTest
+	run      func() error
+}
+
+// Run runs the tests of the interface with the current Config, Prog1 and Prog2
+func (i Interface) Run() error {
+	return i.run()
+}
+
+// Interfaces lists the interfaces supported by CDF
+var Interfaces = []Interface{
+	{Name: "dsa", Prog1: "privkey msg -> sig", Prog2: "pubkey msg sig -> validity", run: TestDsa,
+		SubTests: []SubTest{
+			{"dsa.msgLen", "sign and verify messages of increasing lengths"},
+			{"dsa.hashLen", "sign and verify hashes of increasing lengths and genuine digests (-h)"},
+			{"dsa.cases", "zero and one parameters, zero signatures and hashes"},
+			{"dsa.params", "composite P or Q, Q not dividing P-1, G of wrong order, Y out of range or of small order"},
+			{"dsa.boundary", "private keys and nonces 1, 2, q-1 and q-2, leading zeros in keys and signatures"},
+			{"dsa.der", "DER signatures (-D): BER, padded, negative, trailing and mistagged encodings"},
+			{"dsa.properties", "signatures are randomised, unless as per RFC 6979"},
+			{"dsa.timing", "dudect timing leak tests (-t)"},
+		}},
+	{Name: "ecdsa", Prog1: "privkey msg -> sig", Prog2: "pubkey sig msg -> validity", run: TestEcdsa,
+		SubTests: []SubTest{
+			{"ecdsa.msgLen", "sign and verify messages of increasing lengths"},
+			{"ecdsa.hashLen", "sign and verify hashes of increasing lengths and genuine digests (-h)"},
+			{"ecdsa.points", "(0,0) public key, zero signatures and hashes"},
+			{"ecdsa.explicit", "explicit curve parameters (-P), legitimate and forged"},
+			{"ecdsa.publicKeys", "off-curve, twist, unreduced, infinity and small-order public keys"},
+			{"ecdsa.ranges", "r and s out of range or off by multiples of n, s = 1 and n-1 (-h), high-S"},
+			{"ecdsa.boundary", "private keys and nonces 1, 2, n-1 and n-2, leading zeros in keys and signatures"},
+			{"ecdsa.der", "DER signatures (-D): BER, padded, negative, trailing and mistagged encodings"},
+			{"ecdsa.properties", "signatures are randomised, unless as per RFC 6979"},
+		}},
+	{Name: "enc", Prog1: "key plaintext -> ciphertext", Prog2: "key ciphertext -> plaintext", run: TestEnc,
+		SubTests: []SubTest{
+			{"enc.msgLen", "encrypt and decrypt messages of increasing lengths"},
+			{"enc.keyLen", "encrypt and decrypt with keys of increasing lengths"},
+			{"enc.properties", "encryption and decryption are deterministic"},
+			{"enc.timing", "dudect timing leak tests (-t)"},
+		}},
+	{Name: "prf", Prog1: "key msg -> tag", Prog2: "key msg -> tag", run: TestPrf,
+		SubTests: []SubTest{
+			{"prf.msgLen", "compare the tags of messages of increasing lengths"},
+			{"prf.keyLen", "compare the tags with keys of increasing lengths"},
+			{"prf.padding", "keys padded with 00 give different tags"},
+			{"prf.properties", "tags are deterministic"},
+		}},
+	{Name: "rsaenc", Prog1: "pubkey plaintext -> ciphertext", Prog2: "privkey ciphertext -> plaintext", run: TestRSAenc,
+		SubTests: []SubTest{
+			{"rsaenc.msgLen", "encrypt and decrypt messages of increasing lengths"},
+			{"rsaenc.exponentLen", "public exponents of increasing lengths"},
+			{"rsaenc.maxExponent", "largest supported public exponent"},
+			{"rsaenc.largerMod", "messages larger than the modulus are rejected"},
+			{"rsaenc.smallD", "the private exponent resists Wiener's attack"},
+			{"rsaenc.properties", "encryption is randomised and decryption deterministic"},
+			{"rsaenc.timing", "dudect timing leak tests (-t)"},
+		}},
+	{Name: "rsasign", Prog1: "privkey msg -> sign", Prog2: "pubkey sign msg -> validity", run: TestRSAsign,
+		SubTests: []SubTest{
+			{"rsasign.msgLen", "sign and verify messages of increasing lengths"},
+		}},
+	{Name: "xof", Prog1: "message -> hash", Prog2: "message -> hash", run: TestXof,
+		SubTests: []SubTest{
+			{"xof.msgLen", "compare the hashes of messages of increasing lengths"},
+			{"xof.properties", "hashes are deterministic"},
+		}},
+}
+
+// LookupInterface returns the interface of the given name
+func LookupInterface(name string) (Interface, bool) {
+	for _, i := range Interfaces {
+		if i.Name == name {
+			return i, true
+		}
+	}
+	return Interface{}, false
+}
+
+// subTests holds the selection of the sub-tests to run, as well as the one
+// currently running, which the findings are attributed to
+var subTests = struct {
+	sync.Mutex
+	only, skip map[string]bool
+	current    string
+}{}
+
+// SelectSubTests restricts the sub-tests of interf to run to the ones listed
+// in only, if any, minus the ones listed in skip. The names must be the ones
+// of sub-tests of interf.
+func SelectSubTests(interf string, only, skip []string) error {
+	i, ok := LookupInterface(interf)
+	if !ok {
+		return fmt.Errorf("unknown interface %q", interf)
+	}
+	known := make(map[string]bool)
+	for _, t := range i.SubTests {
+		known[t.Name] = true
+	}
+	toSet := func(names []string) (map[string]bool, error) {
+		set := make(map[string]bool)
+		for _, name := range names {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			if !known[name] {
+				return nil, fmt.Errorf("%q is not a sub-test of %s, see cdf list", name, interf)
+			}
+			set[name] = true
+		}
+		return set, nil
+	}
+
+	onlySet, err := toSet(only)
+	if err != nil {
+		return err
+	}
+	skipSet, err := toSet(skip)
+	if err != nil {
+		return err
+	}
+	subTests.Lock()
+	subTests.only, subTests.skip = onlySet, skipSet
+	subTests.Unlock()
+	return nil
+}
+
+// subTest tells whether the named sub-test is selected, in which case the
+// findings are attributed to it until the next sub-test starts.
+func subTest(name string) bool {
+	subTests.Lock()
+	defer subTests.Unlock()
+	if subTests.skip[name] || (len(subTests.only) > 0 && !subTests.only[name]) {
+		LogInfo.Println("skipping", name)
+		return false
+	}
+	subTests.current = name
+	return true
+}
+
+// currentSubTest returns the name of the sub-test running
+func currentSubTest() string {
+	subTests.Lock()
+	defer subTests.Unlock()
+	return subTests.current
+}
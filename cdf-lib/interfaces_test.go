@@ -0,0 +1,33 @@
+package cdf
+
+import "testing"
+
+func TestSelectSubTests(t *testing.T) {
+	initForTesting("ECDSA")
+	defer SelectSubTests("ecdsa", nil, nil)
+
+	if err := SelectSubTests("ecdsa", []string{"rsaenc.maxExponent"}, nil); err == nil {
+		t.Error("Expected an error with a sub-test of another interface")
+	}
+	if err := SelectSubTests("ecdsa", []string{""}, []string{"ecdsa.hashLen"}); err != nil {
+		t.Fatal(err)
+	}
+	if subTest("ecdsa.hashLen") || !subTest("ecdsa.points") {
+		t.Error("Expected only ecdsa.hashLen to be skipped")
+	}
+	if err := SelectSubTests("ecdsa", []string{"ecdsa.msgLen", "ecdsa.points"}, []string{"ecdsa.points"}); err != nil {
+		t.Fatal(err)
+	}
+	if !subTest("ecdsa.msgLen") || subTest("ecdsa.points") || subTest("ecdsa.properties") {
+		t.Error("Expected only ecdsa.msgLen to be run")
+	}
+
+	// the findings are attributed to the running sub-test
+	findings.Lock()
+	findings.list = nil
+	findings.Unlock()
+	addFinding(Finding{Test: "ecdsa"})
+	if list := Findings(); list[0].SubTest != "ecdsa.msgLen" {
+		t.Errorf("Expected the finding to be attributed to ecdsa.msgLen, got %q", list[0].SubTest)
+	}
+}
@@ -0,0 +1,257 @@
+package cdf
+
+import (
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// oidDSA identifies DSA keys in PKCS#8 and SPKI structures
+var oidDSA = asn1.ObjectIdentifier{1, 2, 840, 10040, 4, 1}
+
+// dsaOpenSSLKey is the "DSA PRIVATE KEY" structure used by OpenSSL
+type dsaOpenSSLKey struct {
+	Version       int
+	P, Q, G, Y, X *big.Int
+}
+
+// pkcs8Key is the PKCS#8 PrivateKeyInfo structure
+type pkcs8Key struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+// dsaParameters are the Dss-Parms of a PKCS#8 DSA key
+type dsaParameters struct {
+	P, Q, G *big.Int
+}
+
+// LoadKeyFiles fills in the key fields of Config from the PEM or DER files
+// referenced by RsaKeyFile, DsaKeyFile and EcdsaKeyFile. Private keys can be
+// given as PKCS#1, PKCS#8, SEC1 or OpenSSL DSA structures. Public keys are
+// rejected, since the tests sign and decrypt with the key.
+func LoadKeyFiles() error {
+	files := []struct {
+		file string
+		kind string
+	}{{Config.RsaKeyFile, "rsa"}, {Config.DsaKeyFile, "dsa"}, {Config.EcdsaKeyFile, "ecdsa"}}
+
+	for _, f := range files {
+		if f.file == "" {
+			continue
+		}
+		data, err := os.ReadFile(f.file)
+		if err != nil {
+			return err
+		}
+		key, err := parseKey(data)
+		if err != nil {
+			return fmt.Errorf("%s: %v", f.file, err)
+		}
+		if err := setKey(f.kind, key); err != nil {
+			return fmt.Errorf("%s: %v", f.file, err)
+		}
+		LogInfo.Printf("loaded the %s key from %s\n", f.kind, f.file)
+	}
+	return nil
+}
+
+// parseKey parses a PEM or DER encoded key, trying the different structures
+// in turn.
+func parseKey(data []byte) (interface{}, error) {
+	der := data
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		// OpenSSL may write the curve or domain parameters before the key
+		if !strings.HasSuffix(block.Type, " PARAMETERS") {
+			der = block.Bytes
+			break
+		}
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := parseDSAPrivateKey(der); err == nil {
+		return key, nil
+	}
+	if _, err := x509.ParsePKIXPublicKey(der); err == nil {
+		return nil, errors.New("public key given, the tests need the private key")
+	}
+	if _, err := x509.ParsePKCS1PublicKey(der); err == nil {
+		return nil, errors.New("public key given, the tests need the private key")
+	}
+	return nil, errors.New("unsupported or invalid key encoding")
+}
+
+// parseDSAPrivateKey parses the OpenSSL and PKCS#8 DSA private keys, which
+// are not supported by crypto/x509.
+func parseDSAPrivateKey(der []byte) (*dsa.PrivateKey, error) {
+	var openssl dsaOpenSSLKey
+	if rest, err := asn1.Unmarshal(der, &openssl); err == nil && len(rest) == 0 {
+		return &dsa.PrivateKey{PublicKey: dsa.PublicKey{
+			Parameters: dsa.Parameters{P: openssl.P, Q: openssl.Q, G: openssl.G},
+			Y:          openssl.Y}, X: openssl.X}, nil
+	}
+
+	var info pkcs8Key
+	if rest, err := asn1.Unmarshal(der, &info); err != nil || len(rest) > 0 {
+		return nil, errors.New("not a DSA private key")
+	}
+	if !info.Algo.Algorithm.Equal(oidDSA) {
+		return nil, errors.New("not a DSA private key")
+	}
+	var params dsaParameters
+	if _, err := asn1.Unmarshal(info.Algo.Parameters.FullBytes, &params); err != nil {
+		return nil, err
+	}
+	x := new(big.Int)
+	if _, err := asn1.Unmarshal(info.PrivateKey, &x); err != nil {
+		return nil, err
+	}
+	// the public key is not part of the PKCS#8 structure
+	return &dsa.PrivateKey{PublicKey: dsa.PublicKey{
+		Parameters: dsa.Parameters{P: params.P, Q: params.Q, G: params.G},
+		Y:          new(big.Int).Exp(params.G, x, params.P)}, X: x}, nil
+}
+
+// setKey fills in the Config fields of the given kind of key, a public key
+// clearing the private fields
+func setKey(kind string, key interface{}) error {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if kind == "rsa" && len(k.Primes) == 2 {
+			setKey(kind, &k.PublicKey)
+			Config.RsaP, Config.RsaQ = k.Primes[0].Text(16), k.Primes[1].Text(16)
+			Config.RsaD = k.D.Text(16)
+			return nil
+		}
+		if kind == "rsa" {
+			return errors.New("multi-prime RSA keys are not supported")
+		}
+	case *rsa.PublicKey:
+		if kind == "rsa" {
+			Config.RsaN, Config.RsaE = k.N.Text(16), big.NewInt(int64(k.E)).Text(16)
+			Config.RsaP, Config.RsaQ, Config.RsaD = "", "", ""
+			return nil
+		}
+	case *dsa.PrivateKey:
+		if kind == "dsa" {
+			setKey(kind, &k.PublicKey)
+			Config.DsaX = k.X.Text(16)
+			return nil
+		}
+	case *dsa.PublicKey:
+		if kind == "dsa" {
+			Config.DsaP, Config.DsaQ, Config.DsaG = k.P.Text(16), k.Q.Text(16), k.G.Text(16)
+			Config.DsaY, Config.DsaX = k.Y.Text(16), ""
+			return nil
+		}
+	case *ecdsa.PrivateKey:
+		if kind == "ecdsa" {
+			setKey(kind, &k.PublicKey)
+			Config.EcdsaD = k.D.Text(16)
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		if kind == "ecdsa" {
+			Config.EcdsaX, Config.EcdsaY, Config.EcdsaD = k.X.Text(16), k.Y.Text(16), ""
+			return nil
+		}
+	}
+	return fmt.Errorf("expected a %s key, got a %T", kind, key)
+}
+
+// ValidateKeys checks that the key of Config the given interface relies on is
+// consistent, so that we do not report the failures of a wrong key as the
+// programs' ones.
+func ValidateKeys(interf string) error {
+	switch interf {
+	case "rsaenc", "rsasign":
+		return validateRSAKey()
+	case "dsa":
+		return validateDSAKey()
+	case "ecdsa":
+		return validateECDSAKey()
+	}
+	return nil
+}
+
+// validateRSAKey checks that N = PQ for primes P and Q and that ed = 1 mod λ(N)
+func validateRSAKey() error {
+	ints, ok := parseHex(Config.RsaP, Config.RsaQ, Config.RsaN, Config.RsaE, Config.RsaD)
+	if !ok {
+		return errors.New("the RSA key fields must all be set as hex strings")
+	}
+	p, q, n, e, d := ints[0], ints[1], ints[2], ints[3], ints[4]
+	one := big.NewInt(1)
+	if new(big.Int).Mul(p, q).Cmp(n) != 0 {
+		return errors.New("RSA key: N != P*Q")
+	}
+	if !p.ProbablyPrime(20) || !q.ProbablyPrime(20) {
+		return errors.New("RSA key: P and Q must be prime")
+	}
+	p1 := new(big.Int).Sub(p, one)
+	q1 := new(big.Int).Sub(q, one)
+	lambda := new(big.Int).Div(new(big.Int).Mul(p1, q1), new(big.Int).GCD(nil, nil, p1, q1))
+	if new(big.Int).Mod(new(big.Int).Mul(e, d), lambda).Cmp(one) != 0 {
+		return errors.New("RSA key: ed != 1 mod λ(N)")
+	}
+	return nil
+}
+
+// validateDSAKey checks that Q divides P-1, that G is of order Q and that
+// Y = G^X mod P
+func validateDSAKey() error {
+	ints, ok := parseHex(Config.DsaP, Config.DsaQ, Config.DsaG, Config.DsaY, Config.DsaX)
+	if !ok {
+		return errors.New("the DSA key fields must all be set as hex strings")
+	}
+	p, q, g, y, x := ints[0], ints[1], ints[2], ints[3], ints[4]
+	one := big.NewInt(1)
+	if !p.ProbablyPrime(20) || !q.ProbablyPrime(20) {
+		return errors.New("DSA key: P and Q must be prime")
+	}
+	if new(big.Int).Mod(new(big.Int).Sub(p, one), q).Sign() != 0 {
+		return errors.New("DSA key: Q does not divide P-1")
+	}
+	if g.Cmp(one) <= 0 || g.Cmp(p) >= 0 || new(big.Int).Exp(g, q, p).Cmp(one) != 0 {
+		return errors.New("DSA key: G is not of order Q")
+	}
+	if x.Sign() <= 0 || x.Cmp(q) >= 0 {
+		return errors.New("DSA key: X is not in [1, Q-1]")
+	}
+	if new(big.Int).Exp(g, x, p).Cmp(y) != 0 {
+		return errors.New("DSA key: Y != G^X mod P")
+	}
+	return nil
+}
+
+// validateECDSAKey checks that the public key is a point of a known curve and
+// that it is the one of the private key, and so are the keys per curve
+func validateECDSAKey() error {
+	if _, err := (EcdsaKey{Config.EcdsaX, Config.EcdsaY, Config.EcdsaD}).validate(); err != nil {
+		return err
+	}
+	return checkCurves()
+}
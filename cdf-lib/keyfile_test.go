@@ -0,0 +1,133 @@
+package cdf
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseKey(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec1, _ := x509.MarshalECPrivateKey(ecKey)
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(ecKey)
+	spki, _ := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+
+	p, q, g, y, x := generateDSAKey(r, 512, 160)
+	dsaDER, _ := asn1.Marshal(dsaOpenSSLKey{P: p, Q: q, G: g, Y: y, X: x})
+
+	cases := []struct {
+		name string
+		data []byte
+		kind string
+	}{
+		{"sec1", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1}), "ecdsa"},
+		{"params+sec1", append(pem.EncodeToMemory(&pem.Block{Type: "EC PARAMETERS", Bytes: []byte{6, 0}}),
+			pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1})...), "ecdsa"},
+		{"pkcs8 der", pkcs8, "ecdsa"},
+		{"openssl dsa", pem.EncodeToMemory(&pem.Block{Type: "DSA PRIVATE KEY", Bytes: dsaDER}), "dsa"},
+	}
+	for _, c := range cases {
+		key, err := parseKey(c.data)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if err := setKey(c.kind, key); err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		}
+		if err := setKey("rsa", key); err == nil {
+			t.Errorf("%s: expected an error when loading as an RSA key", c.name)
+		}
+	}
+	if Config.DsaX != x.Text(16) || Config.DsaY != y.Text(16) {
+		t.Error("Expected the DSA key to be set in Config")
+	}
+	if _, err := parseKey([]byte("not a key")); err == nil {
+		t.Error("Expected an error with an invalid key")
+	}
+	// the tests need the private key
+	if _, err := parseKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: spki})); err == nil {
+		t.Error("Expected an error with a public key")
+	}
+}
+
+func TestLoadKeyFiles(t *testing.T) {
+	initForTesting("ECDSA")
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.New(rand.NewSource(2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(ecKey)
+	file := filepath.Join(t.TempDir(), "ec.pem")
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	Config.EcdsaKeyFile = file
+	defer func() { Config.EcdsaKeyFile = "" }()
+	if err := LoadKeyFiles(); err != nil {
+		t.Fatal(err)
+	}
+	if Config.EcdsaD != ecKey.D.Text(16) || Config.EcdsaX != ecKey.X.Text(16) {
+		t.Error("Expected the key of the file to be set in Config")
+	}
+	if err := ValidateKeys("ecdsa"); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	Config.EcdsaKeyFile = filepath.Join(t.TempDir(), "missing.pem")
+	if err := LoadKeyFiles(); err == nil {
+		t.Error("Expected an error with a missing file")
+	}
+}
+
+func TestValidateKeys(t *testing.T) {
+	initForTesting("RSA")
+	for _, interf := range []string{"rsaenc", "ecdsa", "enc"} {
+		if err := ValidateKeys(interf); err != nil {
+			t.Errorf("%s: unexpected error: %v", interf, err)
+		}
+	}
+
+	p, q, g, y, x := generateDSAKey(rand.New(rand.NewSource(1)), 512, 160)
+	Config.DsaP, Config.DsaQ, Config.DsaG = p.Text(16), q.Text(16), g.Text(16)
+	Config.DsaY, Config.DsaX = y.Text(16), x.Text(16)
+	if err := ValidateKeys("dsa"); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	// inconsistent keys must be rejected
+	broken := []struct {
+		interf string
+		field  *string
+		value  string
+	}{
+		{"rsasign", &Config.RsaN, new(big.Int).Add(fromBase16(Config.RsaN), big.NewInt(2)).Text(16)},
+		{"rsaenc", &Config.RsaD, "3"},
+		{"rsaenc", &Config.RsaE, ""},
+		{"dsa", &Config.DsaY, new(big.Int).Add(y, big.NewInt(1)).Text(16)},
+		{"dsa", &Config.DsaG, "1"},
+		{"dsa", &Config.DsaX, "0"},
+		{"ecdsa", &Config.EcdsaY, "1"},
+		{"ecdsa", &Config.EcdsaD, "2"},
+	}
+	for _, b := range broken {
+		saved := *b.field
+		*b.field = b.value
+		if err := ValidateKeys(b.interf); err == nil {
+			t.Errorf("%s: expected an error with the value %s", b.interf, b.value)
+		}
+		*b.field = saved
+	}
+}
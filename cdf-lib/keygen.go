@@ -0,0 +1,222 @@
+package cdf
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+)
+
+// DsaKeySize is a pair of DSA domain parameters sizes, L being the bit length
+// of the prime P and N the one of the subgroup order Q.
+type DsaKeySize struct {
+	L int `json:"l"`
+	N int `json:"n"`
+}
+
+// TestKey is a key the interface tests are run with, Use sets it in Config.
+type TestKey struct {
+	Name string
+	use  func()
+}
+
+// Use sets the key in Config, so that the following tests run with it
+func (k TestKey) Use() {
+	if k.use != nil {
+		k.use()
+	}
+}
+
+// TestKeys returns the keys the given interface is to be tested with: the one
+// set in config.json followed by the ones generated with the sizes set in
+// config.json, unless the programs do not support their size. Those are
+// generated with a Prng seeded with Config.Seed, so that a run can be
+// reproduced. The ECDSA keys are the ones of each tested curve, see
+// ecdsaTestKeys, and the interfaces without keys get a single empty key.
+func TestKeys(interf string) []TestKey {
+	// we do not use the shared Prng, so that the tests draw the same values
+	// whatever the number of generated keys
+	r := rand.New(rand.NewSource(Config.Seed))
+	keys := []TestKey{{Name: "config.json"}}
+
+	switch interf {
+	case "rsaenc", "rsasign":
+		for _, bits := range Config.RsaKeySizes {
+			if bits < 128 {
+				Fatalln("invalid RSA key size:", bits)
+			}
+			if !keySizeSupported(fmt.Sprintf("rsa-%d", bits), bits) {
+				continue
+			}
+			LogInfo.Printf("generating a %d-bit RSA key\n", bits)
+			p, q, n, e, d := generateRSAKey(r, bits)
+			keys = append(keys, TestKey{Name: fmt.Sprintf("rsa-%d", bits), use: func() {
+				Config.RsaP, Config.RsaQ, Config.RsaN = p.Text(16), q.Text(16), n.Text(16)
+				Config.RsaE, Config.RsaD = e.Text(16), d.Text(16)
+			}})
+		}
+	case "dsa":
+		for _, size := range Config.DsaKeySizes {
+			if size.N < 2 || size.N >= size.L {
+				Fatalln(fmt.Sprintf("invalid DSA key size (%d, %d)", size.L, size.N))
+			}
+			if !keySizeSupported(fmt.Sprintf("dsa-%d-%d", size.L, size.N), size.L) {
+				continue
+			}
+			LogInfo.Printf("generating a (%d, %d) DSA key\n", size.L, size.N)
+			p, q, g, y, x := generateDSAKey(r, size.L, size.N)
+			keys = append(keys, TestKey{Name: fmt.Sprintf("dsa-%d-%d", size.L, size.N), use: func() {
+				Config.DsaP, Config.DsaQ, Config.DsaG = p.Text(16), q.Text(16), g.Text(16)
+				Config.DsaY, Config.DsaX = y.Text(16), x.Text(16)
+			}})
+		}
+	case "ecdsa":
+		keys = ecdsaTestKeys(r)
+	}
+	return keys
+}
+
+// ecdsaTestKeys returns the ECDSA keys to test, on each curve of Config.Curves
+// or else on the one of the key of config.json: the key of config.json or of
+// EcdsaCurveKeys on this curve if any, else a generated one, followed by
+// EcdsaKeys generated ones. The curves the programs do not support are
+// skipped.
+func ecdsaTestKeys(r *rand.Rand) []TestKey {
+	configured := make(map[string]TestKey)
+	for name, k := range Config.EcdsaCurveKeys {
+		configured[curveName(name)] = k.testKey("config.json " + name)
+	}
+	names := Config.Curves
+	if curve, ok := keyCurve(); ok {
+		configured[curveName(curve.name)] = EcdsaKey{Config.EcdsaX, Config.EcdsaY, Config.EcdsaD}.testKey("config.json")
+		if len(names) == 0 {
+			names = []string{curve.name}
+		}
+	}
+
+	var keys []TestKey
+	for _, name := range names {
+		curve, ok := curveByName(name)
+		if !ok {
+			Fatalln("unknown curve:", name)
+		}
+		if !curveSupported(curve.name) {
+			continue
+		}
+		if key, ok := configured[curveName(curve.name)]; ok {
+			keys = append(keys, key)
+		} else {
+			LogInfo.Println("generating an ECDSA key on", curve.name)
+			keys = append(keys, generatedEcdsaKey(r, curve, "ecdsa-"+curve.name))
+		}
+		for i := 0; i < Config.EcdsaKeys; i++ {
+			keys = append(keys, generatedEcdsaKey(r, curve, fmt.Sprintf("ecdsa-%s-%d", curve.name, i+1)))
+		}
+	}
+	return keys
+}
+
+// generatedEcdsaKey generates a key on the curve, to be tested with the name
+func generatedEcdsaKey(r *rand.Rand, curve *ecCurve, name string) TestKey {
+	x, y, d := generateECDSAKey(r, curve)
+	return EcdsaKey{x.Text(16), y.Text(16), d.Text(16)}.testKey(name)
+}
+
+// testKey returns the key to be tested with the given name
+func (k EcdsaKey) testKey(name string) TestKey {
+	return TestKey{Name: name, use: func() {
+		Config.EcdsaX, Config.EcdsaY, Config.EcdsaD = k.X, k.Y, k.D
+	}}
+}
+
+// keySizeSupported tells whether both programs support keys of the given
+// size, recording the tests with the named key as skipped otherwise
+func keySizeSupported(name string, bits int) bool {
+	return capable("key "+name, fmt.Sprintf("%d-bit keys", bits),
+		func(c Capabilities) bool { return c.SupportsKeySize(bits) }, Prog1, Prog2)
+}
+
+// randomPrime returns a random prime of exactly bits bits, whose two most
+// significant bits are set so that the product of two such primes has the sum
+// of their bit lengths.
+func randomPrime(r *rand.Rand, bits int) *big.Int {
+	max := new(big.Int).Lsh(big.NewInt(1), uint(bits))
+	for {
+		p := new(big.Int).Rand(r, max)
+		p.SetBit(p, bits-1, 1)
+		p.SetBit(p, bits-2, 1)
+		p.SetBit(p, 0, 1)
+		if p.ProbablyPrime(20) {
+			return p
+		}
+	}
+}
+
+// randomScalar returns a random integer in [1, n-1]
+func randomScalar(r *rand.Rand, n *big.Int) *big.Int {
+	k := new(big.Int).Rand(r, new(big.Int).Sub(n, big.NewInt(1)))
+	return k.Add(k, big.NewInt(1))
+}
+
+// generateRSAKey generates a bits-bit RSA key with the public exponent 65537,
+// the modulus may have an odd bit length. The primes are such that p > q.
+func generateRSAKey(r *rand.Rand, bits int) (p, q, n, e, d *big.Int) {
+	one := big.NewInt(1)
+	e = big.NewInt(65537)
+	for {
+		p = randomPrime(r, (bits+1)/2)
+		q = randomPrime(r, bits/2)
+		if p.Cmp(q) == 0 {
+			continue
+		}
+		if p.Cmp(q) < 0 {
+			p, q = q, p
+		}
+		n = new(big.Int).Mul(p, q)
+		// d is the inverse of e modulo λ(n) = lcm(p-1, q-1)
+		p1 := new(big.Int).Sub(p, one)
+		q1 := new(big.Int).Sub(q, one)
+		gcd := new(big.Int).GCD(nil, nil, p1, q1)
+		lambda := new(big.Int).Div(new(big.Int).Mul(p1, q1), gcd)
+		if d = new(big.Int).ModInverse(e, lambda); d != nil && n.BitLen() == bits {
+			return
+		}
+	}
+}
+
+// generateDSAKey generates DSA domain parameters with a L-bit prime P and a
+// N-bit prime Q dividing P-1, as well as a key pair.
+func generateDSAKey(r *rand.Rand, L, N int) (p, q, g, y, x *big.Int) {
+	one := big.NewInt(1)
+	max := new(big.Int).Lsh(one, uint(L))
+	for {
+		q = randomPrime(r, N)
+		twoQ := new(big.Int).Lsh(q, 1)
+		// we look for P = k*2Q + 1, as in FIPS 186-4 A.1.1.2
+		for i := 0; i < 4*L; i++ {
+			p = new(big.Int).Rand(r, max)
+			p.SetBit(p, L-1, 1)
+			p.Sub(p, new(big.Int).Mod(p, twoQ))
+			p.Add(p, one)
+			if p.BitLen() == L && p.ProbablyPrime(20) {
+				// G = H^((P-1)/Q) mod P for the first H giving G > 1
+				exp := new(big.Int).Div(new(big.Int).Sub(p, one), q)
+				for h := int64(2); ; h++ {
+					g = new(big.Int).Exp(big.NewInt(h), exp, p)
+					if g.Cmp(one) > 0 {
+						break
+					}
+				}
+				x = randomScalar(r, q)
+				y = new(big.Int).Exp(g, x, p)
+				return
+			}
+		}
+	}
+}
+
+// generateECDSAKey generates an ECDSA key pair on the given curve
+func generateECDSAKey(r *rand.Rand, curve *ecCurve) (x, y, d *big.Int) {
+	d = randomScalar(r, curve.n)
+	x, y = curve.baseMult(d)
+	return
+}
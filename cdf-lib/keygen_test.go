@@ -0,0 +1,73 @@
+package cdf
+
+import (
+	"crypto/elliptic"
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+func TestGenerateRSAKey(t *testing.T) {
+	one := big.NewInt(1)
+	for _, bits := range []int{512, 521, 1023} {
+		p, q, n, e, d := generateRSAKey(rand.New(rand.NewSource(1)), bits)
+		if n.BitLen() != bits {
+			t.Errorf("Expected a %d-bit modulus, got %d bits", bits, n.BitLen())
+		}
+		if p.Cmp(q) <= 0 || new(big.Int).Mul(p, q).Cmp(n) != 0 {
+			t.Error("Expected n = pq with p > q")
+		}
+		// ed = 1 mod p-1 and q-1
+		ed := new(big.Int).Mul(e, d)
+		for _, prime := range []*big.Int{p, q} {
+			if new(big.Int).Mod(ed, new(big.Int).Sub(prime, one)).Cmp(one) != 0 {
+				t.Errorf("Inconsistent exponents for a %d-bit key", bits)
+			}
+		}
+		// the generation is reproducible
+		_, _, n2, _, _ := generateRSAKey(rand.New(rand.NewSource(1)), bits)
+		if n.Cmp(n2) != 0 {
+			t.Error("Expected the same key from the same seed")
+		}
+	}
+}
+
+func TestGenerateDSAKey(t *testing.T) {
+	p, q, g, y, x := generateDSAKey(rand.New(rand.NewSource(1)), 512, 160)
+	if p.BitLen() != 512 || q.BitLen() != 160 {
+		t.Fatalf("Wrong sizes %d, %d", p.BitLen(), q.BitLen())
+	}
+	if !p.ProbablyPrime(20) || !q.ProbablyPrime(20) {
+		t.Error("P and Q should be prime")
+	}
+	if new(big.Int).Mod(new(big.Int).Sub(p, big.NewInt(1)), q).Sign() != 0 {
+		t.Error("Q should divide P-1")
+	}
+	if new(big.Int).Exp(g, q, p).Cmp(big.NewInt(1)) != 0 || g.Cmp(big.NewInt(1)) <= 0 {
+		t.Error("G should be of order Q")
+	}
+	if new(big.Int).Exp(g, x, p).Cmp(y) != 0 || x.Sign() <= 0 || x.Cmp(q) >= 0 {
+		t.Error("Inconsistent key pair")
+	}
+}
+
+func TestTestKeys(t *testing.T) {
+	initForTesting("ECDSA")
+	Config.EcdsaKeys = 2
+	defer func() { Config.EcdsaKeys = 0 }()
+
+	keys := TestKeys("ecdsa")
+	if len(keys) != 3 {
+		t.Fatalf("Expected the configured key and 2 generated ones, got %d", len(keys))
+	}
+	keys[2].Use()
+	x, y := fromBase16(Config.EcdsaX), fromBase16(Config.EcdsaY)
+	d := fromBase16(Config.EcdsaD)
+	if ex, ey := elliptic.P256().ScalarBaseMult(d.Bytes()); ex.Cmp(x) != 0 || ey.Cmp(y) != 0 {
+		t.Error("The generated public key does not match the private one")
+	}
+
+	if keys := TestKeys("xof"); len(keys) != 1 {
+		t.Errorf("Expected a single key for xof, got %d", len(keys))
+	}
+}
@@ -0,0 +1,156 @@
+package cdf
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+// severityCritical is the severity of the findings breaking the private key
+const severityCritical = "critical"
+
+// signedMessage is a signature output by a program, with what is needed to
+// recover the private key from two of them sharing r
+type signedMessage struct {
+	args  []string // the arguments of the signing
+	r, s  *big.Int
+	z     *big.Int // the digest, truncated as the interface does
+	n     *big.Int // the group order
+	priv  *big.Int // the private key the signature was made with
+	rs    [2]string
+	label string // the message, or the digest given with -h
+}
+
+// signedMessages collects the signatures of the consistency tests, by
+// program, public key and r, to detect the reuse of nonces
+var signedMessages = struct {
+	sync.Mutex
+	byR      map[string][]signedMessage
+	reported map[string]bool
+}{}
+
+// parseSigning returns the signedMessage of the signature (r, s) output by a
+// dsa or ecdsa program on args, if they are the ones of a signing, along with
+// the public key it was made under
+func parseSigning(interf string, args []string, r, s string) (signedMessage, string, bool) {
+	sm := signedMessage{args: args, rs: [2]string{r, s}}
+	var hashed []byte
+	if len(args) > 2 && args[0] == "-h" {
+		var err error
+		if hashed, err = hex.DecodeString(args[1]); err != nil {
+			return sm, "", false
+		}
+		sm.label = "digest " + args[1]
+		args = args[2:]
+	}
+	if len(args) == 0 {
+		return sm, "", false
+	}
+	msg := args[len(args)-1]
+	if hashed == nil {
+		var ok bool
+		if hashed, ok = digest(msg); !ok {
+			return sm, "", false
+		}
+		sm.label = "message " + msg
+	}
+	sig, ok := parseHex(r, s)
+	if !ok {
+		return sm, "", false
+	}
+	sm.r, sm.s = sig[0], sig[1]
+	switch {
+	case interf == "ecdsa" && len(args) == 4:
+		key, ok := parseHex(args[:3]...)
+		if !ok {
+			return sm, "", false
+		}
+		curve, ok := curveOf(key[0], key[1])
+		if !ok {
+			return sm, "", false
+		}
+		sm.n, sm.priv, sm.z = curve.n, key[2], curve.hashToInt(hashed)
+	case interf == "dsa" && len(args) == 6:
+		key, ok := parseHex(args[:5]...)
+		if !ok || key[1].Sign() <= 0 {
+			return sm, "", false
+		}
+		// the digest is truncated to the byte length of Q, as per FIPS 186-4
+		if size := (key[1].BitLen() + 7) / 8; len(hashed) > size {
+			hashed = hashed[:size]
+		}
+		sm.n, sm.priv, sm.z = key[1], key[4], new(big.Int).SetBytes(hashed)
+	default:
+		return sm, "", false
+	}
+	if sm.r.Sign() <= 0 || sm.r.Cmp(sm.n) >= 0 {
+		return sm, "", false
+	}
+	return sm, strings.Join(args[:len(args)-2], " "), true
+}
+
+// recoverKey recovers the nonce and the private key from two signatures of
+// different digests sharing r: k = (z1 - z2) / (s1 - s2), or (s1 + s2) since
+// the nonces k and -k give the same r in ECDSA, and x = (s1 k - z1) / r. It
+// returns the candidate matching the private key of the first signature.
+func recoverKey(a, b signedMessage) (k, x *big.Int, ok bool) {
+	n := a.n
+	for _, sign := range []int64{1, -1} {
+		ds := new(big.Int).Mul(b.s, big.NewInt(sign))
+		ds.Sub(a.s, ds).Mod(ds, n)
+		dz := new(big.Int).Sub(a.z, b.z)
+		dz.Mod(dz, n)
+		inv := new(big.Int).ModInverse(ds, n)
+		rInv := new(big.Int).ModInverse(a.r, n)
+		if inv == nil || rInv == nil {
+			continue
+		}
+		k = dz.Mul(dz, inv).Mod(dz, n)
+		x = new(big.Int).Mul(a.s, k)
+		x.Sub(x, a.z).Mul(x, rInv).Mod(x, n)
+		if x.Cmp(new(big.Int).Mod(a.priv, n)) == 0 {
+			return k, x, true
+		}
+	}
+	return nil, nil, false
+}
+
+// recordSignature collects the signature (r, s) output by prog on args, and
+// checks it against the ones collected so far: two signatures of different
+// digests sharing r reveal a reused nonce, from which cdf recovers the
+// private key. Recovering the one of Config is a critical finding.
+func recordSignature(interf, prog string, args []string, r, s string) {
+	sm, pub, ok := parseSigning(interf, args, r, s)
+	if !ok {
+		return
+	}
+	id := strings.Join([]string{interf, prog, pub, sm.r.Text(16)}, "#")
+	signedMessages.Lock()
+	defer signedMessages.Unlock()
+	if signedMessages.byR == nil {
+		signedMessages.byR = make(map[string][]signedMessage)
+		signedMessages.reported = make(map[string]bool)
+	}
+	for _, other := range signedMessages.byR[id] {
+		if other.z.Cmp(sm.z) == 0 || signedMessages.reported[id] {
+			continue
+		}
+		signedMessages.reported[id] = true
+		sigs := fmt.Sprintf("(r, s) = (%s, %s) of the %s and (%s, %s) of the %s",
+			other.rs[0], other.rs[1], other.label, sm.rs[0], sm.rs[1], sm.label)
+		k, x, recovered := recoverKey(other, sm)
+		if !recovered {
+			LogError.Printf("%s reused a nonce: the signatures %s share r.\n", prog, sigs)
+			addFinding(Finding{Test: interf, Progs: []string{prog}, Inputs: other.args,
+				Message: "reused a nonce, the signatures " + sigs + " sharing r"})
+			continue
+		}
+		LogError.Printf("%s reused the nonce %x: cdf recovered the private key %x from the signatures %s.\n",
+			prog, k, x, sigs)
+		addFinding(Finding{Test: interf, Progs: []string{prog}, Inputs: other.args, Severity: severityCritical,
+			Message: fmt.Sprintf("reused the nonce %x, revealing the private key %x: signatures %s", k, x, sigs)})
+	}
+	signedMessages.byR[id] = append(signedMessages.byR[id], sm)
+}
@@ -0,0 +1,108 @@
+package cdf
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func resetSignedMessages() {
+	signedMessages.Lock()
+	signedMessages.byR, signedMessages.reported = nil, nil
+	signedMessages.Unlock()
+	findings.Lock()
+	findings.list = nil
+	findings.Unlock()
+}
+
+// criticalFindings returns the critical findings revealing the private key
+func criticalFindings(t *testing.T, key *big.Int) int {
+	count := 0
+	for _, f := range Findings() {
+		if f.Severity != severityCritical {
+			continue
+		}
+		count++
+		if !strings.Contains(f.Message, fmt.Sprintf("private key %x", key)) {
+			t.Errorf("Unexpected finding %v", f)
+		}
+	}
+	return count
+}
+
+func TestEcdsaNonceReuse(t *testing.T) {
+	initForTesting("ECDSA")
+	defer resetSignedMessages()
+	key, _ := parseHex(Config.EcdsaX, Config.EcdsaY, Config.EcdsaD)
+	curve, ok := curveOf(key[0], key[1])
+	if !ok {
+		t.Fatal("The key of Config is on no known curve")
+	}
+	k := randomScalar(Prng, curve.n)
+	sign := func(prog, msg string, k *big.Int) {
+		hashed, _ := digest(msg)
+		r, s, ok := curve.signWithNonce(key[2], k, hashed)
+		if !ok {
+			t.Fatal("Cannot sign with the nonce")
+		}
+		recordSignature("ecdsa", prog, []string{Config.EcdsaX, Config.EcdsaY, Config.EcdsaD, msg},
+			r.Text(16), s.Text(16))
+	}
+
+	for _, negated := range []bool{false, true} {
+		resetSignedMessages()
+		k2 := k
+		if negated {
+			k2 = new(big.Int).Sub(curve.n, k)
+		}
+		// signing the same message twice is deterministic signing
+		sign("prog1", "DEADC0DE", k)
+		sign("prog1", "DEADC0DE", k)
+		sign("prog2", "DEADC0DEDE", k2)
+		if len(Findings()) != 0 {
+			t.Fatalf("Expected no finding, got %v", Findings())
+		}
+		sign("prog1", "DEADC0DEDE", k2)
+		sign("prog1", "DEADC0DEDEAD", k)
+		if n := criticalFindings(t, key[2]); n != 1 || len(Findings()) != 1 {
+			t.Errorf("Expected a critical finding, got %v", Findings())
+		}
+	}
+}
+
+func TestDsaNonceReuse(t *testing.T) {
+	initForTesting("DSA")
+	defer resetSignedMessages()
+	resetSignedMessages()
+	priv := configDsaKey()
+	k := randomScalar(Prng, priv.Q)
+	args := []string{Config.DsaP, Config.DsaQ, Config.DsaG, Config.DsaY, Config.DsaX}
+	for _, msg := range []string{"DEADC0DE", "DEADC0DEDE"} {
+		hashed, _ := digest(msg)
+		r, s, ok := dsaSignWithNonce(priv, k, hashed)
+		if !ok {
+			t.Fatal("Cannot sign with the nonce")
+		}
+		recordSignature("dsa", "prog", withArgs(args, msg), hex.EncodeToString(r.Bytes()), hex.EncodeToString(s.Bytes()))
+	}
+	if n := criticalFindings(t, priv.X); n != 1 {
+		t.Errorf("Expected a critical finding, got %v", Findings())
+	}
+
+	// with another private key given, r is shared but the key not recovered
+	resetSignedMessages()
+	for i, msg := range []string{"DEADC0DE", "DEADC0DEDE"} {
+		hashed, _ := digest(msg)
+		r, s, _ := dsaSignWithNonce(priv, k, hashed)
+		x := Config.DsaX
+		if i == 0 {
+			x = "01"
+		}
+		recordSignature("dsa", "prog", withArgs(args[:4], x, msg), r.Text(16), s.Text(16))
+	}
+	if list := Findings(); len(list) != 1 || list[0].Severity != "" {
+		t.Errorf("Expected a finding on the shared r, got %v", list)
+	}
+}
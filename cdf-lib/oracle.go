@@ -0,0 +1,84 @@
+package cdf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The oracle is cdf itself: it has the key material, so it can check the
+// programs' outputs with Go's crypto and the configured hash, using the test
+// vector builders with an empty result. The mismatches between the programs
+// are then annotated with the one disagreeing with it. If Config.Oracle is
+// set, the cases on which both programs agree are checked as well.
+
+// oracleName is the name of the oracle in the annotations
+func oracleName() string {
+	return fmt.Sprintf("cdf's oracle (%s)", hashName())
+}
+
+// oracleSignature tells which of signer and verifier disagree with the
+// oracle's verdict on a signature produced by signer, which verifier accepted
+// or not. The verdict is the one of the test vector v of the signature, built
+// with an empty result. It returns an empty string if both agree with it or
+// if the verdict is unknown.
+func oracleSignature(v testVector, ok bool, signer, verifier string, accepted bool) string {
+	valid := v.test.Result == wycheValid
+	switch {
+	case !ok:
+		return ""
+	case valid && !accepted:
+		return fmt.Sprintf("%s disagrees with %s: it rejected a valid signature", verifier, oracleName())
+	case !valid && accepted:
+		return fmt.Sprintf("%s and %s disagree with %s: the signature is invalid, yet accepted",
+			signer, verifier, oracleName())
+	case !valid:
+		return fmt.Sprintf("%s disagrees with %s: it produced an invalid signature", signer, oracleName())
+	}
+	return ""
+}
+
+// oracleDecryption tells which of encrypter and decrypter disagree with the
+// oracle, given whether decrypter recovered the message. The test vector v of
+// the ciphertext, built with an empty result, tells whether it decrypts to
+// the message according to the oracle.
+func oracleDecryption(v testVector, ok bool, encrypter, decrypter string, recovered bool) string {
+	valid := v.test.Result == wycheValid
+	switch {
+	case !ok:
+		return ""
+	case valid && !recovered:
+		return fmt.Sprintf("%s disagrees with %s: it failed to decrypt a valid ciphertext", decrypter, oracleName())
+	case !valid && recovered:
+		return fmt.Sprintf("%s and %s disagree with %s: the ciphertext is invalid, yet decrypted",
+			encrypter, decrypter, oracleName())
+	case !valid:
+		return fmt.Sprintf("%s disagrees with %s: its ciphertext does not decrypt to the message",
+			encrypter, oracleName())
+	}
+	return ""
+}
+
+// oracleTag tells which of the programs output a tag disagreeing with the
+// one computed by the oracle, the programs may output truncated tags. It
+// returns an empty string if all agree with it or if it cannot be computed.
+func oracleTag(key, msg string, progs, outs []string) string {
+	v, ok := macVector(key, msg, "")
+	if !ok {
+		return ""
+	}
+	var wrong []string
+	for i, out := range outs {
+		if out == "" || !strings.HasPrefix(v.test.Tag, out) {
+			wrong = append(wrong, progs[i])
+		}
+	}
+	if len(wrong) == 0 {
+		return ""
+	}
+	verb := "disagrees"
+	if len(wrong) > 1 {
+		verb = "disagree"
+	}
+	return fmt.Sprintf("%s %s with %s, which computed the tag %s",
+		strings.Join(wrong, " and "), verb, oracleName(), v.test.Tag)
+}
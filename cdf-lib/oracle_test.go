@@ -0,0 +1,61 @@
+package cdf
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"strings"
+	"testing"
+)
+
+func TestOracle(t *testing.T) {
+	Config.Hash = "SHA-256"
+	defer func() { Config.Hash = "" }()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashed := sha256.Sum256([]byte("CCC"))
+	r, s, err := ecdsa.Sign(rand.Reader, key, hashed[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, y := key.X.Text(16), key.Y.Text(16)
+
+	valid, ok := ecdsaVector(x, y, r.Text(16), s.Text(16), "434343", "", "")
+	if note := oracleSignature(valid, ok, "signer", "verifier", true); note != "" {
+		t.Errorf("Expected no note on an accepted valid signature, got %q", note)
+	}
+	if note := oracleSignature(valid, ok, "signer", "verifier", false); !strings.HasPrefix(note, "verifier disagrees") {
+		t.Errorf("Expected the verifier to be blamed, got %q", note)
+	}
+	tampered, ok := ecdsaVector(x, y, r.Text(16), s.Text(16), "434344", "", "")
+	if note := oracleSignature(tampered, ok, "signer", "verifier", false); !strings.HasPrefix(note, "signer disagrees") {
+		t.Errorf("Expected the signer to be blamed, got %q", note)
+	}
+	if note := oracleSignature(tampered, ok, "signer", "verifier", true); !strings.HasPrefix(note, "signer and verifier") {
+		t.Errorf("Expected both programs to be blamed, got %q", note)
+	}
+	if note := oracleSignature(testVector{}, false, "signer", "verifier", false); note != "" {
+		t.Errorf("Expected no note on an unknown verdict, got %q", note)
+	}
+
+	invalid := testVector{test: wycheproofTest{Result: wycheInvalid}}
+	if note := oracleDecryption(invalid, true, "enc", "dec", false); !strings.HasPrefix(note, "enc disagrees") {
+		t.Errorf("Expected the encrypter to be blamed, got %q", note)
+	}
+
+	// the HMAC-SHA256 test case 2 of RFC 4231, with a truncated tag
+	key2, msg := "4a656665", "7768617420646f2079612077616e7420666f72206e6f7468696e673f"
+	if note := oracleTag(key2, msg, []string{"a", "b"}, []string{"5bdcc146", "5bdcc146bf60754e"}); note != "" {
+		t.Errorf("Expected no note on correct tags, got %q", note)
+	}
+	if note := oracleTag(key2, msg, []string{"a", "b"}, []string{"5bdcc146", "00"}); !strings.HasPrefix(note, "b disagrees") {
+		t.Errorf("Expected b to be blamed, got %q", note)
+	}
+	if note := oracleTag(key2, msg, []string{"a", "b"}, []string{"00", "01"}); !strings.HasPrefix(note, "a and b disagree") {
+		t.Errorf("Expected both programs to be blamed, got %q", note)
+	}
+}
@@ -10,6 +10,13 @@ import (
 func TestPrf() error {
 	LogInfo.Print("testing prf")
 
+	// calibrating the timeouts on a short and a long message
+	for _, prog := range []string{Prog1, Prog2} {
+		calibrateTimeout(prog,
+			[]string{warmupMsg(Config.MinKeyLen), warmupMsg(Config.MinMsgLen)},
+			[]string{warmupMsg(Config.MaxKeyLen), warmupMsg(Config.MaxMsgLen)})
+	}
+
 	failed := false
 
 	// Let us fetch random keys and messages nibbles:
@@ -24,44 +31,57 @@ func TestPrf() error {
 	// msg length to use in key test
 	msgAvgNibbles := 2 * ((Config.MaxMsgLen - Config.MinMsgLen) / 2)
 
-	LogInfo.Println("testing message lengths")
-	TermPrepareFor(1)
-
-	currKey := key[:keyAvgNibbles]
-	failedTmp := false
-	// note that we ignore the incrementMsg parameter, since the *2 is hardcoded here.
-	for i := Config.MinMsgLen; i <= Config.MaxMsgLen; i++ {
-		currMsg := msg[:(i * 2)]
-		TermPrintInline(1, "%d / %d", i, Config.MaxMsgLen)
+	if subTest("prf.msgLen") {
+		LogInfo.Println("testing message lengths")
+		TermPrepareFor(1)
 
-		failedTmp = failedTmp || runPrf(currKey, currMsg, tags, i)
-	}
-	if !failedTmp {
-		LogSuccess.Println("message length: okay")
+		currKey := key[:keyAvgNibbles]
+		var pairs []prfPair
+		// note that we ignore the incrementMsg parameter, since the *2 is hardcoded here.
+		for i := Config.MinMsgLen; i <= Config.MaxMsgLen; i++ {
+			pairs = append(pairs, prfPair{key: currKey, msg: msg[:(i * 2)], index: i})
+		}
+		failedTmp := runPrfPairs("prf message lengths", pairs, tags)
+		if !failedTmp {
+			LogSuccess.Println("message length: okay")
+		}
+		failed = failed || failedTmp
+		fmt.Print("\n")
 	}
-	fmt.Print("\n")
-	LogInfo.Println("testing key lengths")
-	TermPrepareFor(1)
 
-	// reset tags list
-	tags = make(map[string]int)
+	if subTest("prf.keyLen") {
+		LogInfo.Println("testing key lengths")
+		TermPrepareFor(1)
 
-	currMsg := msg[:msgAvgNibbles]
-	for i := Config.MinKeyLen; i <= Config.MaxKeyLen; i++ {
-		TermPrintInline(1, "%d / %d", i, Config.MaxKeyLen)
+		// reset tags list
+		tags = make(map[string]int)
 
-		currKey := key[:(i * 2)]
-		failed = failed || runPrf(currKey, currMsg, tags, i)
-	}
-	if !failedTmp {
-		LogSuccess.Println("key length: okay")
+		currMsg := msg[:msgAvgNibbles]
+		var pairs []prfPair
+		for i := Config.MinKeyLen; i <= Config.MaxKeyLen; i++ {
+			pairs = append(pairs, prfPair{key: key[:(i * 2)], msg: currMsg, index: i})
+		}
+		failedTmp := runPrfPairs("prf key lengths", pairs, tags)
+		if !failedTmp {
+			LogSuccess.Println("key length: okay")
+		}
+		failed = failed || failedTmp
+		TermPrepareFor(1)
 	}
-	TermPrepareFor(1)
 
-	if nil != prfPaddingTests() {
+	if subTest("prf.padding") && nil != prfPaddingTests() {
 		failed = true
 	}
 
+	if subTest("prf.properties") {
+		if err := testProperties(
+			propertyCheck{prog: Prog1, op: "computing", args: []string{key[:2*Config.MinKeyLen], msg}},
+			propertyCheck{prog: Prog2, op: "computing", args: []string{key[:2*Config.MinKeyLen], msg}}); err != nil {
+			failed = true
+			LogError.Println("while testing determinism:", err)
+		}
+	}
+
 	if failed {
 		fmt.Print("\n")
 		return errors.New("one of more tests failed")
@@ -72,17 +92,91 @@ func TestPrf() error {
 	return nil
 }
 
+// prfPair is a key and message pair on which to run both programs, the index
+// identifies it when reporting duplicate tags.
+type prfPair struct {
+	key   string
+	msg   string
+	index int
+}
+
+// runPrfPairs submits both programs' runs on all the provided pairs to the
+// scheduler, and then checks their outputs in order. It returns whether any
+// check failed.
+func runPrfPairs(name string, pairs []prfPair, tags map[string]int) bool {
+	outs1 := make([]string, len(pairs))
+	outs2 := make([]string, len(pairs))
+	ran := make([]bool, len(pairs))
+	jobs := newJobGroup(name, len(pairs))
+	for i, p := range pairs {
+		i, p := i, p
+		jobs.Go(func() (err error) {
+			// get the first i bytes, ie first i*2 nibbles, since the interface is assuming
+			// hexadecimal in/outputs
+			id := fmt.Sprintf("prf#%d#%d", len(p.key), len(p.msg))
+			if outs1[i], err = runOrClassify("prf", Prog1, id, p.key, p.msg); err != nil {
+				return err
+			}
+			if outs2[i], err = runOrClassify("prf", Prog2, id, p.key, p.msg); err != nil {
+				return err
+			}
+			ran[i] = true
+			return nil
+		})
+	}
+	failed := false
+	if err := jobs.Wait(); err != nil {
+		LogWarning.Println(err)
+		failed = true
+	}
+
+	for i, p := range pairs {
+		// the pairs on which a program failed are already reported
+		if !ran[i] {
+			continue
+		}
+		failed = checkPrf(outs1[i], outs2[i], tags, p.index) || failed
+		// the oracle checks the mismatches, and the agreements if enabled
+		note := ""
+		if outs1[i] != outs2[i] || Config.Oracle {
+			note = oracleTag(p.key, p.msg, []string{Prog1, Prog2}, []string{outs1[i], outs2[i]})
+		}
+		if outs1[i] != outs2[i] {
+			// we rerun the failing case to see whether it reproduces
+			id := fmt.Sprintf("prf#%d#%d", len(p.key), len(p.msg))
+			class := classifyFailure(func() (bool, error) {
+				return rerunMatch(id, []string{p.key, p.msg})
+			})
+			LogWarning.Printf("mismatch on length %d is %v", p.index, class)
+			addFinding(Finding{Test: "prf", Progs: []string{Prog1, Prog2},
+				Inputs: []string{p.key, p.msg}, Message: "tag mismatch", Class: class.String(), Oracle: note})
+			if note != "" {
+				LogWarning.Println(note)
+			}
+			addVector(macVector(p.key, p.msg, Prog1+" and "+Prog2+" disagreed on the tag", "Mismatch"))
+		} else if note != "" {
+			LogWarning.Println(note)
+			failed = true
+			addFinding(Finding{Test: "prf", Progs: []string{Prog1, Prog2},
+				Inputs: []string{p.key, p.msg}, Message: "wrong tag", Oracle: note})
+			addVector(macVector(p.key, p.msg, Prog1+" and "+Prog2+" agreed on a wrong tag", "Mismatch"))
+		} else {
+			addGeneratedVector(macVector(p.key, p.msg, "tag by "+Prog1, "Generated"))
+		}
+	}
+	return failed
+}
+
 // runPrf is a helper method which perform the actual test of the two provided
-// programs. If checks both programs' output for cohension and verify the generated
-// tags for duplicates.
+// programs on a single key and message pair.
 func runPrf(currKey, currMsg string, tags map[string]int, index int) bool {
-	failed := false
-	// get the first i bytes, ie first i*2 nibbles, since the interface is assuming
-	// hexadecimal in/outputs
-	id := fmt.Sprintf("prf#%d#%d", len(currKey), len(currMsg))
-	outStr1 := runOrExitOnErr(Prog1, id, currKey, currMsg)
-	outStr2 := runOrExitOnErr(Prog2, id, currKey, currMsg)
+	return runPrfPairs("prf", []prfPair{{key: currKey, msg: currMsg, index: index}}, tags)
+}
 
+// checkPrf checks both programs' output for cohesion and verify the generated
+// tags for duplicates.
+func checkPrf(outStr1, outStr2 string, tags map[string]int, index int) bool {
+	failed := false
 	if previous, ok := tags[outStr1]; ok {
 		fmt.Print("\n")
 		LogWarning.Printf("same tag for %d and %d\n", previous, index)
@@ -115,7 +209,7 @@ func prfPaddingTests() error {
 	currKey := randomHex(Config.MinKeyLen)
 	failed := runPrf(currKey, currMsg, tags, 0)
 	if failed {
-		LogError.Fatalln("Something went really wrong")
+		Fatalln("Something went really wrong")
 	}
 	currKey = currKey + "00"
 	failed = runPrf(currKey, currMsg, tags, 1)
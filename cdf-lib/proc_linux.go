@@ -0,0 +1,25 @@
+package cdf
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcGroup makes the program run in its own process group, so that the
+// whole tree it spawns (e.g. a JVM started by a wrapper script) can be torn
+// down at once. Pdeathsig also ensures the direct child dies with cdf.
+func setProcGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid:   true,
+		Pdeathsig: syscall.SIGKILL,
+	}
+}
+
+// killProcGroup kills every process in the process group of the started cmd.
+func killProcGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	// a negative pid targets the whole process group
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
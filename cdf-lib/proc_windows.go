@@ -0,0 +1,29 @@
+package cdf
+
+import (
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// setProcGroup makes the program run in its own process group, so that the
+// whole tree it spawns can be torn down at once.
+func setProcGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP,
+	}
+}
+
+// killProcGroup kills the started cmd and all its descendants, Windows having
+// no process group signals we rely on taskkill's tree mode for this.
+func killProcGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	kill := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid))
+	if err := kill.Run(); err != nil {
+		// fallback on killing at least the direct child
+		return cmd.Process.Kill()
+	}
+	return nil
+}
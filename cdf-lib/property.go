@@ -0,0 +1,88 @@
+package cdf
+
+import "fmt"
+
+// propertyCheck describes an operation of a program whose outputs are
+// compared over repeated runs on the same input.
+type propertyCheck struct {
+	prog   string
+	op     string
+	args   []string
+	random bool // whether the outputs must differ instead of matching
+}
+
+// testProperties runs each provided check Config.PropertyRuns times on the
+// same input. Deterministic primitives (xof, prf, enc, RFC 6979 signatures)
+// must always produce the same output, while randomised ones (OAEP
+// encryption, plain ECDSA and DSA signatures) must never repeat one. This
+// catches bugs which only show up once in a while, such as an implementation
+// returning random bytes from time to time. Each violation is a finding of
+// the properties sub-test. It is disabled if PropertyRuns is lower than 2.
+func testProperties(checks ...propertyCheck) error {
+	runs := Config.PropertyRuns
+	if runs < 2 || len(checks) == 0 {
+		return nil
+	}
+	TermPrepareFor(1)
+	LogInfo.Println("testing determinism properties over", runs, "runs")
+	test := "properties"
+	if Interf != "" {
+		test = Interf + "." + test
+	}
+
+	outs := make([][]string, len(checks))
+	jobs := newJobGroup("properties", len(checks)*runs)
+	for i, c := range checks {
+		outs[i] = make([]string, runs)
+		for r := 0; r < runs; r++ {
+			i, c, r := i, c, r
+			jobs.Go(func() error {
+				id := fmt.Sprintf("property#%s#%d", c.op, r)
+				out, err := runProg(c.prog, id, c.args)
+				if err != nil {
+					return fmt.Errorf("%s failed on run %d when %s: %v", c.prog, r, c.op, err)
+				}
+				outs[i][r] = out
+				return nil
+			})
+		}
+	}
+
+	var mainErr MultiError
+	if err := jobs.Wait(); err != nil {
+		mainErr = append(mainErr, err.(MultiError)...)
+	}
+
+	for i, c := range checks {
+		distinct := make(map[string]bool)
+		nbOut := 0
+		for _, out := range outs[i] {
+			if out != "" {
+				distinct[out] = true
+				nbOut++
+			}
+		}
+		var err error
+		switch {
+		case !c.random && len(distinct) > 1:
+			LogWarning.Printf("%s is not deterministic when %s, on input:\n%v\n", c.prog, c.op, c.args)
+			err = fmt.Errorf("%s is not deterministic when %s: got %d distinct outputs over %d runs",
+				c.prog, c.op, len(distinct), nbOut)
+		case c.random && len(distinct) < nbOut:
+			LogWarning.Printf("%s repeated an output when %s, on input:\n%v\n", c.prog, c.op, c.args)
+			err = fmt.Errorf("%s is not randomised when %s: got only %d distinct outputs over %d runs",
+				c.prog, c.op, len(distinct), nbOut)
+		}
+		if err != nil {
+			addFinding(Finding{Test: test, Progs: []string{c.prog}, Inputs: c.args, Message: err.Error()})
+			mainErr = append(mainErr, err)
+		}
+	}
+
+	TermPrepareFor(1)
+	if len(mainErr) > 0 {
+		return mainErr
+	}
+	LogSuccess.Println("determinism properties tested without error.")
+	return nil
+}
@@ -0,0 +1,228 @@
+package cdf
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// invalidKey is a public key the verifiers must reject, given as hex strings
+// which may not be canonical, along with a signature cdf forged for it
+type invalidKey struct {
+	name string
+	x, y string
+	r, s *big.Int
+}
+
+// signDivisible signs the digest with the private key d, which may be zero,
+// drawing the nonce k until m divides u2 = r/s mod n. The signature (r, s)
+// then verifies under dG + T for any point T whose order divides m, as
+// u1G + u2(dG + T) = kG: a verifier not checking the key accepts it, T being
+// the point at infinity for m = 1.
+func (c *ecCurve) signDivisible(d *big.Int, digest []byte, m int64) (r, s *big.Int, err error) {
+	z := c.hashToInt(digest)
+	for i := 0; i < 1000; i++ {
+		k, err := cryptoScalar(c.n)
+		if err != nil {
+			return nil, nil, err
+		}
+		rx, _ := c.baseMult(k)
+		r = rx.Mod(rx, c.n)
+		s = new(big.Int).Mul(r, d)
+		s.Add(s, z).Mul(s, k.ModInverse(k, c.n)).Mod(s, c.n)
+		if r.Sign() == 0 || s.Sign() == 0 {
+			continue
+		}
+		u2 := new(big.Int).ModInverse(s, c.n)
+		u2.Mul(u2, r).Mod(u2, c.n)
+		if u2.Mod(u2, big.NewInt(m)).Sign() == 0 {
+			return r, s, nil
+		}
+	}
+	return nil, nil, errors.New("cannot forge a signature for a key of order " + fmt.Sprint(m))
+}
+
+// smallOrderPoints returns points of the orders dividing the cofactor, by
+// order: the multiples nP of the points P of small x are of such orders, and
+// are searched until one of order h is found
+func (c *ecCurve) smallOrderPoints() map[int64][2]*big.Int {
+	points := make(map[int64][2]*big.Int)
+	for x := big.NewInt(1); x.Int64() < 100 && c.h > 1 && points[c.h][0] == nil; x.Add(x, big.NewInt(1)) {
+		y := new(big.Int).ModSqrt(c.rhs(x), c.p)
+		if y == nil {
+			continue
+		}
+		// nP is of order dividing h, then halved by doubling it
+		tx, ty := c.scalarMult(x, y, c.n)
+		for tx != nil {
+			order := int64(1)
+			for ox, oy := tx, ty; ox != nil; ox, oy = c.add(ox, oy, tx, ty) {
+				order++
+			}
+			points[order] = [2]*big.Int{tx, ty}
+			tx, ty = c.add(tx, ty, tx, ty)
+		}
+	}
+	return points
+}
+
+// rhs returns x³ + ax + b mod p
+func (c *ecCurve) rhs(x *big.Int) *big.Int {
+	v := new(big.Int).Mul(x, x)
+	v.Add(v, c.a).Mul(v, x).Add(v, c.b)
+	return v.Mod(v, c.p)
+}
+
+// twistPoint returns a point (x, y) whose abscissa is the one of a point of
+// the quadratic twist, with x³ + ax + b not a square, the ordinate being such
+// that (x, y) is of order 3 on the curve y² = x³ + ax + b' it lies on. Since
+// the ECDSA formulas do not use b, it is of order 3 for a verifier checking
+// neither the curve equation nor the ordinate. b' is such that x is a root of
+// the 3-division polynomial 3x⁴ + 6ax² + 12b'x - a².
+func (c *ecCurve) twistPoint(from *big.Int) (*big.Int, *big.Int, bool) {
+	for x, i := new(big.Int).Add(from, big.NewInt(1)), 0; i < 1000; x, i = x.Add(x, big.NewInt(1)), i+1 {
+		x.Mod(x, c.p)
+		if x.Sign() == 0 || big.Jacobi(c.rhs(x), c.p) != -1 {
+			continue
+		}
+		// b' = (a² - 3x⁴ - 6ax²) / 12x
+		x2 := new(big.Int).Mul(x, x)
+		x4 := new(big.Int).Mul(x2, x2)
+		bPrime := new(big.Int).Mul(c.a, c.a)
+		bPrime.Sub(bPrime, x4.Mul(x4, big.NewInt(3)))
+		bPrime.Sub(bPrime, x2.Mul(x2, c.a).Mul(x2, big.NewInt(6)))
+		inv := new(big.Int).ModInverse(new(big.Int).Mul(x, big.NewInt(12)), c.p)
+		if inv == nil {
+			continue
+		}
+		bPrime.Mul(bPrime, inv).Mod(bPrime, c.p)
+		other := *c
+		other.b = bPrime
+		if y := new(big.Int).ModSqrt(other.rhs(x), c.p); y != nil && y.Sign() != 0 {
+			return new(big.Int).Set(x), y, true
+		}
+	}
+	return nil, nil, false
+}
+
+// invalidKeys returns the invalid public keys derived from the key (x, y, d)
+// of curve, with the signatures of the digest cdf forges for them:
+//   - the point (x, 0), off the curve, of order 2 on the curve it lies on;
+//   - a point of the quadratic twist, see twistPoint;
+//   - the coordinates of the key plus p, which must not be reduced;
+//   - the point at infinity, as (0, 0) and as coordinates equal to p;
+//   - the points of small order on the curves with a cofactor, and the key
+//     plus such a point, which is on the curve but not in the subgroup.
+func invalidKeys(curve *ecCurve, x, y, d *big.Int, digest []byte) ([]invalidKey, error) {
+	size := curve.byteLen()
+	coord := func(i *big.Int) string { return hex.EncodeToString(padTo(i.Bytes(), size)) }
+	var keys []invalidKey
+	add := func(name string, kx, ky string, d *big.Int, m int64) error {
+		r, s, err := curve.signDivisible(d, digest, m)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		keys = append(keys, invalidKey{name: name, x: kx, y: ky, r: r, s: s})
+		return nil
+	}
+	zero, p := new(big.Int), curve.p
+
+	if err := add("off-curve point of order 2", coord(x), coord(zero), zero, 2); err != nil {
+		return nil, err
+	}
+	if tx, ty, ok := curve.twistPoint(x); ok {
+		if err := add("point of the twist", coord(tx), coord(ty), zero, 3); err != nil {
+			return nil, err
+		}
+	}
+	if err := add("x + p", coord(new(big.Int).Add(x, p)), coord(y), d, 1); err != nil {
+		return nil, err
+	}
+	if err := add("y + p", coord(x), coord(new(big.Int).Add(y, p)), d, 1); err != nil {
+		return nil, err
+	}
+	for _, inf := range []struct{ name, x, y string }{
+		{"infinity as 00 00", "00", "00"},
+		{"infinity as zero coordinates", coord(zero), coord(zero)},
+		{"infinity as (p, 0)", coord(p), coord(zero)},
+		{"infinity as (p, p)", coord(p), coord(p)},
+	} {
+		if err := add(inf.name, inf.x, inf.y, zero, 1); err != nil {
+			return nil, err
+		}
+	}
+	small := curve.smallOrderPoints()
+	for _, order := range []int64{2, 4, 8} {
+		t, ok := small[order]
+		if !ok {
+			continue
+		}
+		if err := add(fmt.Sprintf("point of order %d", order), coord(t[0]), coord(t[1]), zero, order); err != nil {
+			return nil, err
+		}
+		qx, qy := curve.add(x, y, t[0], t[1])
+		if err := add(fmt.Sprintf("key plus a point of order %d", order), coord(qx), coord(qy), d, order); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// testEcdsaPublicKeys gives the verifiers the invalidKeys of the key of
+// Config, with the signatures cdf forged for them, which must be rejected
+func testEcdsaPublicKeys() error {
+	curve, ok := keyCurve()
+	if !ok {
+		return errors.New("the ECDSA key is not on a known curve")
+	}
+	msg := "DEADC0DE"
+	hashed, ok := digest(msg)
+	if !ok {
+		return fmt.Errorf("unsupported hash %s", hashName())
+	}
+	ints, _ := parseHex(Config.EcdsaX, Config.EcdsaY, Config.EcdsaD)
+	keys, err := invalidKeys(curve, ints[0], ints[1], ints[2], hashed)
+	if err != nil {
+		return err
+	}
+	LogInfo.Printf("testing %d invalid public keys on %s.\n", len(keys), curve.name)
+
+	jobs := newJobGroup("ecdsa public keys", 2)
+	for _, prog := range []string{Prog1, Prog2} {
+		prog := prog
+		jobs.Go(func() error {
+			var accepted []string
+			for _, k := range keys {
+				r := hex.EncodeToString(padTo(k.r.Bytes(), curve.orderLen()))
+				s := hex.EncodeToString(padTo(k.s.Bytes(), curve.orderLen()))
+				argsP := []string{k.x, k.y, r, s, msg}
+				out, err := runProg(prog, "ecdsa#pubkey#"+k.name+"_"+prog, argsP)
+				v, vok := ecdsaVector(k.x, k.y, r, s, msg, wycheInvalid,
+					"signature forged for the invalid public key: "+k.name, "InvalidPublicKey")
+				if vok {
+					v.group.Key.Curve = curve.name
+				}
+				if err != nil || out != trueStr {
+					LogToFile.Println("As expected,", prog, "rejected the", k.name, "key:", out, err)
+					addGeneratedVector(v, vok)
+					continue
+				}
+				LogError.Printf("%s accepted a signature under the invalid public key: %s.\n", prog, k.name)
+				addFinding(Finding{Test: "ecdsa.publicKeys", Progs: []string{prog}, Inputs: argsP,
+					Message: "accepted a signature under the invalid public key: " + k.name})
+				v.test.Comment = prog + " accepted the " + v.test.Comment
+				addVector(v, vok)
+				accepted = append(accepted, k.name)
+			}
+			if len(accepted) > 0 {
+				return fmt.Errorf("%s accepted signatures forged under invalid public keys: %s",
+					prog, strings.Join(accepted, ", "))
+			}
+			LogSuccess.Printf("%s rejected the %d invalid public keys.\n", prog, len(keys))
+			return nil
+		})
+	}
+	return jobs.Wait()
+}
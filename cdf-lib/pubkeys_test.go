@@ -0,0 +1,97 @@
+package cdf
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+func TestInvalidKeys(t *testing.T) {
+	initForTesting("ECDSA")
+	digest := sha256.Sum256([]byte{0xde, 0xad, 0xc0, 0xde})
+	for _, name := range []string{"secp256r1", "secp521r1", "brainpoolP256r1", "wei25519"} {
+		curve, _ := curveByName(name)
+		x, y, d := generateECDSAKey(rand.New(rand.NewSource(1)), curve)
+		keys, err := invalidKeys(curve, x, y, d, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		// wei25519 has points of order 2, 4 and 8
+		if expected := map[bool]int{false: 8, true: 14}[curve.h > 1]; len(keys) != expected {
+			t.Errorf("%s: expected %d invalid keys, got %d", name, expected, len(keys))
+		}
+		for _, k := range keys {
+			ints, _ := parseHex(k.x, k.y)
+			if curve.onCurve(ints[0], ints[1]) && curve.inSubgroup(ints[0], ints[1]) {
+				t.Errorf("%s: the %s key is valid", name, k.name)
+			}
+			if curve.verify(ints[0], ints[1], digest[:], k.r, k.s) {
+				t.Errorf("%s: the signature for the %s key verifies", name, k.name)
+			}
+			kx, ky := ints[0].Mod(ints[0], curve.p), ints[1].Mod(ints[1], curve.p)
+			// but it does under a verifier computing on the curve the key
+			// lies on, without checking it, or ignoring the key at infinity
+			lax := *curve
+			lax.std, lax.h = nil, 1
+			valid := false
+			if kx.Sign() == 0 && ky.Sign() == 0 {
+				w := new(big.Int).ModInverse(k.s, curve.n)
+				rx, _ := curve.baseMult(w.Mul(w, curve.hashToInt(digest[:])))
+				valid = rx.Mod(rx, curve.n).Cmp(k.r) == 0
+			} else {
+				lax.b = new(big.Int).Mul(ky, ky)
+				lax.b.Sub(lax.b, curve.rhs(kx)).Add(lax.b, curve.b).Mod(lax.b, curve.p)
+				valid = lax.verify(kx, ky, digest[:], k.r, k.s)
+			}
+			if !valid {
+				t.Errorf("%s: the signature forged for the %s key is not valid", name, k.name)
+			}
+		}
+	}
+}
+
+func TestEcdsaPublicKeys(t *testing.T) {
+	withBuiltins(t, "ecdsa", "builtin:ecdsa-p256-sha256", "builtin:ecdsa-p256-sha256")
+	if err := testEcdsaPublicKeys(); err != nil {
+		t.Error(err)
+	}
+}
+
+// laxKeyEcdsa is builtin:ecdsa-p256-sha256 verifying the signatures on the
+// curve the public key lies on, without checking it
+func laxKeyEcdsa(args []string) (string, error) {
+	if len(args) != 5 {
+		return builtinEcdsa(args)
+	}
+	ints, err := builtinInts(args[:4]...)
+	if err != nil {
+		return "", err
+	}
+	digest, err := builtinDigest(crypto.SHA256, args[4])
+	if err != nil {
+		return "", err
+	}
+	curve, _ := curveByName("secp256r1")
+	lax := *curve
+	lax.std, lax.h = nil, 1
+	x, y := ints[0].Mod(ints[0], curve.p), ints[1].Mod(ints[1], curve.p)
+	lax.b = new(big.Int).Mul(y, y)
+	lax.b.Sub(lax.b, curve.rhs(x)).Add(lax.b, curve.b).Mod(lax.b, curve.p)
+	return fmt.Sprint(lax.verify(x, y, digest, ints[2], ints[3])), nil
+}
+
+func TestEcdsaPublicKeysLax(t *testing.T) {
+	lax := registerBuiltin(t, "ecdsa-lax-key", "ecdsa-p256-sha256", laxKeyEcdsa)
+	withBuiltins(t, "ecdsa", lax, "builtin:ecdsa-p256-sha256")
+	if err := testEcdsaPublicKeys(); err == nil {
+		t.Fatal("Expected the invalid public keys to be accepted")
+	}
+	for _, name := range []string{"off-curve point of order 2", "x + p", "y + p"} {
+		if !hasFinding(lax, "accepted a signature under the invalid public key: "+name) {
+			t.Errorf("Expected a finding on the %s key, got %v", name, Findings())
+		}
+	}
+}
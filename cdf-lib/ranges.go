@@ -0,0 +1,218 @@
+package cdf
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+)
+
+// rangeCase is a signature of the key of Config, whose r or s is replaced by
+// a value the verifiers must reject, being out of [1, n-1] or not the one of
+// the genuine signature, possibly modulo n
+type rangeCase struct {
+	name string
+	r, s *big.Int
+}
+
+// rangeCases returns the genuine signature (r, s) with r or s replaced by n,
+// n+1, p and 2^bitlen(n), which are out of range, by themselves plus n or 2n,
+// which only a verifier reducing them modulo n would accept, and r by n-1.
+func rangeCases(curve *ecCurve, r, s *big.Int) []rangeCase {
+	one := big.NewInt(1)
+	values := []struct {
+		name string
+		v    *big.Int
+	}{
+		{"n", curve.n},
+		{"n+1", new(big.Int).Add(curve.n, one)},
+		{"p", curve.p},
+		{"2^bitlen(n)", new(big.Int).Lsh(one, uint(curve.n.BitLen()))},
+	}
+	var cases []rangeCase
+	for _, v := range values {
+		cases = append(cases, rangeCase{"r = " + v.name, v.v, s}, rangeCase{"s = " + v.name, r, v.v})
+	}
+	plusN := func(v *big.Int, k int64) *big.Int {
+		return new(big.Int).Add(v, new(big.Int).Mul(curve.n, big.NewInt(k)))
+	}
+	return append(cases,
+		rangeCase{"r + n", plusN(r, 1), s},
+		rangeCase{"r + 2n", plusN(r, 2), s},
+		rangeCase{"s + n", r, plusN(s, 1)},
+		rangeCase{"r = n-1", new(big.Int).Sub(curve.n, one), s})
+}
+
+// signWithS returns a signature (r, s) with the given s, valid for the digest
+// it returns: with r = x(kG) mod n, the digest z is then s k - r d mod n.
+func (c *ecCurve) signWithS(d, s *big.Int) (r *big.Int, digest []byte, err error) {
+	k, err := cryptoScalar(c.n)
+	if err != nil {
+		return nil, nil, err
+	}
+	rx, _ := c.baseMult(k)
+	r = rx.Mod(rx, c.n)
+	z := new(big.Int).Mul(s, k)
+	z.Sub(z, new(big.Int).Mul(r, d)).Mod(z, c.n)
+	return r, c.digestOf(z), nil
+}
+
+// highS tells whether s is in the upper half of [1, n-1], the signature
+// (r, s) having then the malleable low-S twin (r, n-s)
+func (c *ecCurve) highS(s *big.Int) bool {
+	return s.Cmp(new(big.Int).Rsh(c.n, 1)) > 0
+}
+
+// sigPolicy is what a program does with the high-S signatures
+type sigPolicy struct {
+	acceptsHighS, outputsHighS bool
+}
+
+// testEcdsaRanges gives the verifiers the rangeCases of a signature by cdf,
+// which must be rejected, and the signatures with s = 1 and s = n-1, which
+// must be accepted, the latter needing -h. It then checks whether each
+// program accepts and outputs high-S signatures: only a signer outputting
+// some while the other program rejects them is a finding, ECDSA allowing
+// both (r, s) and (r, n-s).
+func testEcdsaRanges() error {
+	curve, ok := keyCurve()
+	if !ok {
+		return errors.New("the ECDSA key is not on a known curve")
+	}
+	msg := "DEADC0DE"
+	hashed, ok := digest(msg)
+	if !ok {
+		return fmt.Errorf("unsupported hash %s", hashName())
+	}
+	ints, _ := parseHex(Config.EcdsaD)
+	d := ints[0]
+	r, s, err := curve.sign(d, hashed, rand.Reader)
+	if err != nil {
+		return err
+	}
+	if curve.highS(s) {
+		s.Sub(curve.n, s)
+	}
+	cases := rangeCases(curve, r, s)
+
+	progs := []string{Prog1, Prog2}
+	withHash := make([]bool, len(progs))
+	for i, prog := range progs {
+		withHash[i] = capable("ecdsa.ranges (s = 1 and n-1)", "the -h flag", prehashed, prog)
+	}
+	LogInfo.Printf("testing the ranges of r and s and the high-S signatures on %s.\n", curve.name)
+	hexInt := func(i *big.Int) string { return hex.EncodeToString(padTo(i.Bytes(), curve.orderLen())) }
+	verify := func(prog, id string, args []string) bool {
+		out, err := runProg(prog, "ecdsa#range#"+id+"_"+prog, args)
+		return err == nil && out == trueStr
+	}
+
+	var policies sync.Map
+	jobs := newJobGroup("ecdsa signature ranges", len(progs))
+	for i, prog := range progs {
+		prog, withHash := prog, withHash[i]
+		jobs.Go(func() error {
+			var mainErr MultiError
+			for _, c := range cases {
+				argsP := []string{Config.EcdsaX, Config.EcdsaY, hexInt(c.r), hexInt(c.s), msg}
+				v, vok := ecdsaVector(Config.EcdsaX, Config.EcdsaY, hexInt(c.r), hexInt(c.s), msg, wycheInvalid,
+					"signature with "+c.name, "RangeCheck")
+				if !verify(prog, c.name, argsP) {
+					addGeneratedVector(v, vok)
+					continue
+				}
+				LogError.Printf("%s accepted a signature with %s.\n", prog, c.name)
+				addFinding(Finding{Test: "ecdsa.ranges", Progs: []string{prog}, Inputs: argsP,
+					Message: "accepted a signature with " + c.name})
+				v.test.Comment = prog + " accepted a " + v.test.Comment
+				addVector(v, vok)
+				mainErr = append(mainErr, fmt.Errorf("%s accepted a signature with %s", prog, c.name))
+			}
+
+			// the boundary values of s are valid, for the digests cdf picks
+			boundaries := []struct {
+				name string
+				s    *big.Int
+			}{{"s = 1", big.NewInt(1)}, {"s = n-1", new(big.Int).Sub(curve.n, big.NewInt(1))}}
+			for _, b := range boundaries {
+				if !withHash {
+					break
+				}
+				name, sv := b.name, b.s
+				rv, z, err := curve.signWithS(d, sv)
+				if err != nil {
+					return err
+				}
+				argsP := []string{"-h", hex.EncodeToString(z), Config.EcdsaX, Config.EcdsaY, hexInt(rv), hexInt(sv), msg}
+				if !verify(prog, name, argsP) {
+					LogError.Printf("%s rejected a valid signature with %s.\n", prog, name)
+					addFinding(Finding{Test: "ecdsa.ranges", Progs: []string{prog}, Inputs: argsP,
+						Message: "rejected a valid signature with " + name})
+					mainErr = append(mainErr, fmt.Errorf("%s rejected a valid signature with %s", prog, name))
+				}
+			}
+
+			// the low-S signature must be accepted, the high-S one may not be
+			argsP := []string{Config.EcdsaX, Config.EcdsaY, hexInt(r), hexInt(s), msg}
+			if !verify(prog, "low-S", argsP) {
+				LogError.Printf("%s rejected a valid low-S signature.\n", prog)
+				addFinding(Finding{Test: "ecdsa.ranges", Progs: []string{prog}, Inputs: argsP,
+					Message: "rejected a valid low-S signature"})
+				mainErr = append(mainErr, fmt.Errorf("%s rejected a valid low-S signature", prog))
+			}
+			var policy sigPolicy
+			policy.acceptsHighS = verify(prog, "high-S",
+				[]string{Config.EcdsaX, Config.EcdsaY, hexInt(r), hexInt(new(big.Int).Sub(curve.n, s)), msg})
+			for j := 0; j < 16 && !policy.outputsHighS; j++ {
+				out, err := runProg(prog, "ecdsa#range#sign_"+prog, []string{Config.EcdsaX, Config.EcdsaY, Config.EcdsaD, msg})
+				_, sOut, ok := splitSignature(out)
+				sig, parsed := parseHex(sOut)
+				if err == nil && ok && parsed {
+					policy.outputsHighS = curve.highS(sig[0])
+				}
+			}
+			accepts, outputs := "rejects", "outputs only low-S ones"
+			if policy.acceptsHighS {
+				accepts = "accepts"
+			}
+			if policy.outputsHighS {
+				outputs = "outputs some"
+			}
+			LogInfo.Printf("%s %s high-S signatures and %s.\n", prog, accepts, outputs)
+			policies.Store(prog, policy)
+			if len(mainErr) > 0 {
+				return mainErr
+			}
+			LogSuccess.Printf("%s checks the ranges of r and s.\n", prog)
+			return nil
+		})
+	}
+	err = jobs.Wait()
+	var mainErr MultiError
+	if err != nil {
+		mainErr = append(mainErr, err.(MultiError)...)
+	}
+
+	// a signer outputting high-S signatures the other program rejects
+	for i, signer := range progs {
+		verifier := progs[1-i]
+		sp, ok1 := policies.Load(signer)
+		vp, ok2 := policies.Load(verifier)
+		if !ok1 || !ok2 || !sp.(sigPolicy).outputsHighS || vp.(sigPolicy).acceptsHighS {
+			continue
+		}
+		LogWarning.Printf("%s outputs high-S signatures, which %s rejects.\n", signer, verifier)
+		addFinding(Finding{Test: "ecdsa.ranges", Progs: []string{signer, verifier},
+			Message: "high-S signatures output by the former are rejected by the latter"})
+		mainErr = append(mainErr, fmt.Errorf("%s outputs high-S signatures, which %s rejects", signer, verifier))
+		if signer == verifier {
+			break
+		}
+	}
+	if len(mainErr) > 0 {
+		return mainErr
+	}
+	return nil
+}
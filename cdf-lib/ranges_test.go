@@ -0,0 +1,75 @@
+package cdf
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+func TestRangeCases(t *testing.T) {
+	initForTesting("ECDSA")
+	digest := sha256.Sum256([]byte{0xde, 0xad, 0xc0, 0xde})
+	for _, name := range []string{"secp256r1", "secp224k1", "wei25519"} {
+		curve, _ := curveByName(name)
+		d := randomScalar(Prng, curve.n)
+		x, y := curve.baseMult(d)
+		r, s, err := curve.sign(d, digest[:], rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range rangeCases(curve, r, s) {
+			if curve.verify(x, y, digest[:], c.r, c.s) {
+				t.Errorf("%s: the signature with %s verifies", name, c.name)
+			}
+		}
+		// the low-S and high-S signatures are both valid
+		if !curve.verify(x, y, digest[:], r, s.Sub(curve.n, s)) {
+			t.Errorf("%s: the malleated signature does not verify", name)
+		}
+		for _, sv := range []int64{1, -1} {
+			s := big.NewInt(sv)
+			s.Mod(s, curve.n)
+			rv, z, err := curve.signWithS(d, s)
+			if err != nil || !curve.verify(x, y, z, rv, s) {
+				t.Errorf("%s: the signature with s = %x does not verify for %s", name, s, hex.EncodeToString(z))
+			}
+		}
+	}
+}
+
+func TestEcdsaRanges(t *testing.T) {
+	withBuiltins(t, "ecdsa", "builtin:ecdsa-p256-sha256", "builtin:ecdsa-p256-sha256")
+	if err := testEcdsaRanges(); err != nil {
+		t.Error(err)
+	}
+}
+
+// reducingEcdsa is builtin:ecdsa-p256-sha256 reducing r and s modulo n
+// instead of checking their range
+func reducingEcdsa(args []string) (string, error) {
+	if len(args) != 5 {
+		return builtinEcdsa(args)
+	}
+	ints, err := builtinInts(args[2:4]...)
+	if err != nil {
+		return "", err
+	}
+	curve, _ := curveByName("secp256r1")
+	r, s := ints[0].Mod(ints[0], curve.n), ints[1].Mod(ints[1], curve.n)
+	return builtinEcdsa(withArgs(args[:2], hex.EncodeToString(r.Bytes()), hex.EncodeToString(s.Bytes()), args[4]))
+}
+
+func TestEcdsaRangesReducing(t *testing.T) {
+	reducing := registerBuiltin(t, "ecdsa-reducing", "ecdsa-p256-sha256", reducingEcdsa)
+	withBuiltins(t, "ecdsa", reducing, "builtin:ecdsa-p256-sha256")
+	if err := testEcdsaRanges(); err == nil {
+		t.Fatal("Expected the out of range signatures to be accepted")
+	}
+	for _, name := range []string{"r + n", "s + n"} {
+		if !hasFinding(reducing, "accepted a signature with "+name) {
+			t.Errorf("Expected a finding on the signature with %s, got %v", name, Findings())
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package cdf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Finding is a failure exposed by a test, along with the inputs leading to it,
+// its classification and the programs disagreeing with cdf's own verdict, to
+// be reported at the end of the run.
+type Finding struct {
+	Test    string   `json:"test"`
+	Progs   []string `json:"progs"`
+	Inputs  []string `json:"inputs"`
+	Message string   `json:"message"`
+	Class   string   `json:"class,omitempty"`
+	SubTest string   `json:"subTest,omitempty"`
+	Oracle  string   `json:"oracle,omitempty"`
+	// Severity is "critical" for the findings breaking the private key
+	Severity string `json:"severity,omitempty"`
+	// Interf, Hash and Curve are the interface, hash and curve the finding
+	// was made with, and DER whether the signatures of its first program were
+	// DER encoded, so that the replay gives the program the same flags
+	Interf string `json:"interf,omitempty"`
+	Hash   string `json:"hash,omitempty"`
+	Curve  string `json:"curve,omitempty"`
+	DER    bool   `json:"der,omitempty"`
+}
+
+// findings stores the findings reported so far by the different tests
+var findings = struct {
+	sync.Mutex
+	list []Finding
+}{}
+
+// addFinding records a finding, it is safe to call from concurrent jobs. The
+// finding is attributed to the sub-test running, and made with the interface,
+// hash, curve and signature encoding in use unless set.
+func addFinding(f Finding) {
+	if f.SubTest == "" {
+		f.SubTest = currentSubTest()
+	}
+	if f.Interf == "" {
+		f.Interf = Interf
+	}
+	if f.Hash == "" && hashed[f.Interf] {
+		f.Hash = hashName()
+	}
+	if f.Curve == "" && f.Interf == "ecdsa" {
+		f.Curve = selectedCurve()
+	}
+	if len(f.Progs) > 0 {
+		f.DER = f.DER || usesDER(f.Progs[0])
+	}
+	findings.Lock()
+	findings.list = append(findings.list, f)
+	findings.Unlock()
+}
+
+// skips stores the tests skipped since a program lacks a capability, once
+var skips = struct {
+	sync.Mutex
+	list []string
+}{}
+
+// addSkip records a test skipped for the given reason
+func addSkip(test, reason string) {
+	skip := test + ": " + reason
+	skips.Lock()
+	defer skips.Unlock()
+	for _, s := range skips.list {
+		if s == skip {
+			return
+		}
+	}
+	skips.list = append(skips.list, skip)
+}
+
+// Findings returns a copy of all the findings reported so far
+func Findings() []Finding {
+	findings.Lock()
+	defer findings.Unlock()
+	return append([]Finding(nil), findings.list...)
+}
+
+// PrintReport displays the summary of the findings of the run, and the
+// tests skipped for lack of capabilities
+func PrintReport() {
+	skips.Lock()
+	for _, s := range skips.list {
+		LogInfo.Println("skipped", s)
+	}
+	skips.Unlock()
+	list := Findings()
+	if len(list) == 0 {
+		return
+	}
+	LogInfo.Printf("report: %d finding(s)\n", len(list))
+	for i, f := range list {
+		class := ""
+		if f.Class != "" {
+			class = " [" + f.Class + "]"
+		}
+		test := f.Test
+		if f.SubTest != "" && f.SubTest != f.Test {
+			test += " (" + f.SubTest + ")"
+		}
+		severity := ""
+		if f.Severity != "" {
+			severity = strings.ToUpper(f.Severity) + " "
+		}
+		LogInfo.Printf("#%d %s%s: %s%s\n\tprograms: %s\n\tinputs: %s\n", i+1, severity, test,
+			f.Message, class, strings.Join(f.Progs, ", "), strings.Join(f.Inputs, " "))
+		if f.Oracle != "" {
+			LogInfo.Printf("\toracle: %s\n", f.Oracle)
+		}
+	}
+	fmt.Print("\n")
+}
+
+// SaveFindings writes the findings reported so far to a JSON file, so that
+// they can be replayed later on.
+func SaveFindings(file string) (int, error) {
+	list := Findings()
+	if list == nil {
+		list = []Finding{}
+	}
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	return len(list), os.WriteFile(file, append(data, '\n'), 0644)
+}
+
+// LoadFindings reads findings saved with SaveFindings
+func LoadFindings(file string) ([]Finding, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var list []Finding
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return list, nil
+}
+
+// ReplayFinding runs again the first program of a finding on its recorded
+// inputs, or prog instead if set, e.g. to check whether a fixed build still
+// fails, and displays its output.
+func ReplayFinding(f Finding, prog string) error {
+	if prog == "" {
+		if len(f.Progs) == 0 {
+			return errors.New("no program recorded for this finding")
+		}
+		prog = f.Progs[0]
+	}
+	out, err := replay(f, prog)
+	if err != nil {
+		LogWarning.Printf("it failed with %v, returning:\n%s\n", err, out)
+		return err
+	}
+	LogSuccess.Printf("it returned:\n%s\n", out)
+	return nil
+}
+
+// replay runs prog on the inputs of the finding, as Prog1 of its interface:
+// it is given the hash and the curve of the finding, and its signatures as
+// DER ones if they were.
+func replay(f Finding, prog string) (string, error) {
+	Interf, Prog1, Prog2 = f.Interf, prog, ""
+	clearSelection()
+	if f.Hash != "" {
+		selectHash(f.Hash)
+	}
+	if f.Curve != "" {
+		selectCurve(f.Curve)
+	}
+	args := f.Inputs
+	if f.DER {
+		args = derArgs(args)
+	}
+	LogInfo.Printf("replaying %s: %s\n\t%s %s\n", f.Test, f.Message, prog,
+		strings.Join(withArgs(selectedArgs(prog), args...), " "))
+	out, err := execProg(prog, "replay#"+f.Test, args)
+	if f.DER && err == nil {
+		out = derOutput(out)
+	}
+	return strings.ToLower(strings.TrimSpace(out)), err
+}
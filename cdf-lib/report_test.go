@@ -0,0 +1,58 @@
+package cdf
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSaveFindings(t *testing.T) {
+	findings.Lock()
+	findings.list = nil
+	findings.Unlock()
+	addFinding(Finding{Test: "xof", Progs: []string{"a", "b"}, Inputs: []string{"00"},
+		Message: "hash mismatch", Class: "deterministic (reproduced on 5/5 reruns)"})
+	addFinding(Finding{Test: "ecdsa.zeroPoint", Progs: []string{"a"}, Inputs: []string{"00", "00", "00", "ab"}})
+
+	file := filepath.Join(t.TempDir(), "findings.json")
+	nb, err := SaveFindings(file)
+	if err != nil || nb != 2 {
+		t.Fatalf("Expected 2 findings to be saved, got %d, %v", nb, err)
+	}
+	list, err := LoadFindings(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(list, Findings()) {
+		t.Errorf("Expected the saved findings, got %v", list)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	initForTesting("ECDSA")
+	defer func() {
+		Interf, Prog1, Prog2, Config.Hash = "", "", "", ""
+		clearSelection()
+	}()
+	curve, _ := curveByName("secp384r1")
+	d := randomScalar(Prng, curve.n)
+	x, y := curve.baseMult(d)
+	msg := "deadc0de"
+	Config.Hash = "SHA-384"
+	hashed, _ := digest(msg)
+	r, s, _ := curve.signWithNonce(d, randomScalar(Prng, curve.n), hashed)
+	Config.Hash = ""
+
+	// the signature only verifies with the hash, the curve and the DER
+	// encoding of the finding
+	f := Finding{Test: "ecdsa", Progs: []string{"builtin:ecdsa-p256-sha256-der"},
+		Inputs: []string{x.Text(16), y.Text(16), r.Text(16), s.Text(16), msg},
+		Interf: "ecdsa", Hash: "SHA-384", Curve: "secp384r1", DER: true}
+	if out, err := replay(f, f.Progs[0]); err != nil || out != trueStr {
+		t.Errorf("Expected the signature to verify, got %s (%v)", out, err)
+	}
+	f.Hash = "SHA-256"
+	if out, err := replay(f, f.Progs[0]); err == nil && out == trueStr {
+		t.Error("Expected the signature not to verify with SHA-256")
+	}
+}
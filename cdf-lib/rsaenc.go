@@ -7,12 +7,10 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"log"
 	"math/big"
 	mrand "math/rand"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 )
 
@@ -26,62 +24,105 @@ import (
 func TestRSAenc() error {
 	LogInfo.Print("testing rsaenc")
 
+	// calibrating the timeouts, the decryption one on a ciphertext from Prog1
+	warmup := warmupMsg(Config.MinMsgLen)
+	calibrateTimeout(Prog1, []string{Config.RsaN, Config.RsaE, warmup})
+	if cipher, err := runProg(Prog1, "warmup#cipher", []string{Config.RsaN, Config.RsaE, warmup}); err == nil {
+		calibrateTimeout(Prog2, []string{Config.RsaP, Config.RsaQ, Config.RsaE, Config.RsaD, cipher})
+	}
+
 	failed := false
 
 	// Generate random hexadecimal data to try and encrypt those (the tested
 	// program are supposed to unhexlify this data to obtain Config.MaxMsgLen bytes)
 	msg := randomHex(Config.MaxMsgLen)
-	LogInfo.Println("testing different message's lengths")
-
-	if err := testRSAencConsistency(msg, Config.RsaN, Config.RsaE, Config.RsaD,
-		Config.RsaP, Config.RsaQ, Config.MaxMsgLen); err != nil {
-		failed = true
-		LogError.Println("while testing messages lengths:", err)
-	} else {
-		LogSuccess.Println("message's lengths test okay")
+
+	if subTest("rsaenc.msgLen") {
+		LogInfo.Println("testing different message's lengths")
+		if err := testRSAencConsistency(msg, Config.RsaN, Config.RsaE, Config.RsaD,
+			Config.RsaP, Config.RsaQ, Config.MaxMsgLen); err != nil {
+			failed = true
+			LogError.Println("while testing messages lengths:", err)
+		} else {
+			LogSuccess.Println("message's lengths test okay")
+		}
 	}
 
-	if err := testRSAencPubExponentLen(msg); err != nil {
-		failed = true
-		LogError.Println("while testing exponent lengths:", err)
-	} else {
-		LogSuccess.Println("exponent's lengths test okay")
+	if subTest("rsaenc.exponentLen") {
+		if err := testRSAencPubExponentLen(msg); err != nil {
+			failed = true
+			LogError.Println("while testing exponent lengths:", err)
+		} else {
+			LogSuccess.Println("exponent's lengths test okay")
+		}
 	}
 
-	if err := testRSAencPubMaxExponentLen(msg); err != nil {
-		failed = true
-		LogError.Println("while testing max exponent support:", err)
-	} else {
-		LogSuccess.Println("max exponent's lengths test okay")
+	if subTest("rsaenc.maxExponent") {
+		if err := testRSAencPubMaxExponentLen(msg); err != nil {
+			failed = true
+			LogError.Println("while testing max exponent support:", err)
+		} else {
+			LogSuccess.Println("max exponent's lengths test okay")
+		}
 	}
 
-	if err := testRSAencLargerMod(Prog1); err != nil {
-		failed = true
-		LogError.Println("while testing bigger than modulus support:\n", err)
-	} else {
-		LogSuccess.Println("larger than modulus test okay for", Prog1)
+	// the larger than modulus tests are submitted for both programs at once
+	largeMsg := randomHex((fromBase16(Config.RsaN).BitLen()+7)/8 + 8)
+	if subTest("rsaenc.largerMod") {
+		largeErrs := make([]error, 2)
+		jobs := newJobGroup("larger than modulus", 2)
+		for i, prog := range []string{Prog1, Prog2} {
+			i, prog := i, prog
+			jobs.Go(func() error {
+				largeErrs[i] = testRSAencLargerMod(prog, largeMsg)
+				return largeErrs[i]
+			})
+		}
+		jobs.Wait()
+		for i, prog := range []string{Prog1, Prog2} {
+			if largeErrs[i] != nil {
+				failed = true
+				LogError.Println("while testing bigger than modulus support:\n", largeErrs[i])
+			} else {
+				LogSuccess.Println("larger than modulus test okay for", prog)
+			}
+		}
 	}
-	if err := testRSAencLargerMod(Prog2); err != nil {
-		failed = true
-		LogError.Println("while testing bigger than modulus support:\n", err)
-	} else {
-		LogSuccess.Println("larger than modulus test okay for", Prog2)
+
+	if subTest("rsaenc.smallD") {
+		if err := testRSAsmallD(); err != nil {
+			failed = true
+			LogError.Println("while testing D against Wiener's attack:\n", err)
+		} else {
+			LogSuccess.Println("private exponent vs Wiener's attack: okay")
+		}
 	}
 
-	if err := testRSAsmallD(); err != nil {
-		failed = true
-		LogError.Println("while testing D against Wiener's attack:\n", err)
-	} else {
-		LogSuccess.Println("private exponent vs Wiener's attack: okay")
+	// The encryption must be randomised, while the decryption, checked on a
+	// ciphertext from Prog1, is deterministic
+	if subTest("rsaenc.properties") {
+		propMsg := msg[:2*Config.MinMsgLen]
+		checks := []propertyCheck{{prog: Prog1, op: "encrypting", random: true,
+			args: []string{Config.RsaN, Config.RsaE, propMsg}}}
+		if Config.PropertyRuns > 1 {
+			if cipher, err := runProg(Prog1, "property#cipher", []string{Config.RsaN, Config.RsaE, propMsg}); err == nil {
+				checks = append(checks, propertyCheck{prog: Prog2, op: "decrypting",
+					args: []string{Config.RsaP, Config.RsaQ, Config.RsaE, Config.RsaD, cipher}})
+			}
+		}
+		if err := testProperties(checks...); err != nil {
+			failed = true
+			LogError.Println("while testing determinism:", err)
+		}
 	}
 
-	if limit := *TestTimings; limit > 0 {
+	if limit := *TestTimings; limit > 0 && subTest("rsaenc.timing") {
 		TermPrepareFor(1)
 		LogInfo.Println("Starting timing tests, those may take hours depending on the max number of iterations set.")
 		dudectTest(limit, Prog1, doOneComputationForRsa, prepareInputsForRsa)
 		dudectTest(limit, Prog2, doOneComputationForRsa, prepareInputsForRsa)
 		for i := 0; i <= 9; i++ {
-			if i == 7 && len(Config.RsaN) != 2048 {
+			if i == 7 && fromBase16(Config.RsaN).BitLen() != 1024 {
 				LogInfo.Println("Specific tests for keys with a modulus of 1024 bits were skipped.")
 				break
 			}
@@ -101,7 +142,7 @@ func TestRSAenc() error {
 // associated private exponent D, given n and phi(n)
 func generateExponents(bitlen int) (finE, finD string) {
 	if bitlen == 1 {
-		LogError.Fatalln("There are no prime of bit length 1")
+		Fatalln("There are no prime of bit length 1")
 	}
 	// We initialize our variables
 	start := new(big.Int)
@@ -188,7 +229,7 @@ func testRSAencPubExponentLen(msg string) error {
 	TermPrepareFor(1)
 	LogInfo.Println("testing exponent lengths")
 
-	var N, e, d, P, Q string
+	var N, P, Q string
 	N = Config.RsaN
 	P = Config.RsaP
 	Q = Config.RsaQ
@@ -196,18 +237,25 @@ func testRSAencPubExponentLen(msg string) error {
 	// Starting from 2 since there are no prime of bit length 1, while 3 is
 	// a prime a bit length 2
 	TermPrepareFor(3)
+	// the exponents are generated beforehand, since they rely on the Prng
+	jobs := newJobGroup("exponent lengths", Config.MaxKeyLen-1)
 	for i := 2; i <= Config.MaxKeyLen; i++ {
-		TermDisplay(3, "trying with public exponent of bit-length %d / %d",
-			i, Config.MaxKeyLen)
-		e, d = generateExponents(i)
-		// note we are doing only 3 tests on msg of size 1,2 and 3 :
-		erc := testRSAencConsistency(msg, N, e, d, P, Q, 3)
-		if erc != nil {
-			LogWarning.Printf("problem with bit-length %d:\n%s\n",
-				i, erc.Error())
-			TermPrepareFor(4)
-			errs = append(errs, fmt.Errorf("exponents test failed on  bit-length %d", i))
-		}
+		i := i
+		e, d := generateExponents(i)
+		jobs.Go(func() error {
+			// note we are doing only 3 tests on msg of size 1,2 and 3 :
+			erc := testRSAencConsistency(msg, N, e, d, P, Q, 3)
+			if erc != nil {
+				LogWarning.Printf("problem with bit-length %d:\n%s\n",
+					i, erc.Error())
+				TermPrepareFor(4)
+				return fmt.Errorf("exponents test failed on  bit-length %d", i)
+			}
+			return nil
+		})
+	}
+	if err := jobs.Wait(); err != nil {
+		errs = err.(MultiError)
 	}
 	LogInfo.Println("exponent test finished")
 	if len(errs) > 0 {
@@ -228,98 +276,116 @@ func testRSAencConsistency(msg, N, e, d, P, Q string, iter int) error {
 	if maxIter > iter*incrementMsg {
 		maxIter = iter * incrementMsg
 	}
+	// the messages must fit in the modulus, which depends on the key size
+	if max := 2 * oaepMaxMsgLen(fromBase16(N)); maxIter > max {
+		maxIter = max
+	}
 
-	// Initializing a common, unbuffered channel which gives tasks to
-	// the worker goroutines
-	msgs := make(chan string)
-	errs := make(chan error, maxIter)
-	// spawn some worker goroutines
-	var wg sync.WaitGroup
-	for j := uint(0); j < Config.Concurrency; j++ {
-		wg.Add(1)
-		go func() {
-			for m := range msgs { // using range has to be closed later
-				runID := fmt.Sprintf("rsaenc#%d#%d", iter, len(m))
-
-				args := []string{N, e, m}
-				// get the message m from channel msgs and encrypt it
-				cipher, errc := runProg(Prog1, strconv.Itoa(len(m)), args)
-				if errc != nil {
-					// Errors which are "expected" should be marked with FAIL
-					//  in the tested program
-					if strings.Contains(cipher, "fail") {
-						errs <- fmt.Errorf("FAIL: %v", errc)
-						LogToFile.Println("Skipping the rest of job", runID)
-						continue
-					} else {
-						// other errors are not expected by the tested program
-						//  and we stop there
-						fmt.Println("\nUnexpected error on", Prog1)
-						fmt.Println("Got output", cipher)
-						log.Fatalln(errc)
-					}
+	// Let us now submit the messages to be processed:
+	var msgs []string
+	for i := Config.MinMsgLen * 2; i <= maxIter; i += incrementMsg {
+		msgs = append(msgs, msg[:i])
+	}
+	jobs := newJobGroup("rsaenc", len(msgs))
+	for _, m := range msgs {
+		m := m
+		jobs.Go(func() error {
+			runID := fmt.Sprintf("rsaenc#%d#%d", iter, len(m))
+
+			args := []string{N, e, m}
+			// encrypt the message m
+			cipher, errc := runProg(Prog1, strconv.Itoa(len(m)), args)
+			if errc != nil {
+				// Errors which are "expected" should be marked with FAIL
+				//  in the tested program
+				if strings.Contains(cipher, "fail") {
+					LogToFile.Println("Skipping the rest of job", runID)
+					return fmt.Errorf("FAIL: %v", errc)
 				}
+				// other errors are not expected by the tested program
+				//  and we rerun it to classify them
+				fmt.Println("\nUnexpected error on", Prog1)
+				fmt.Println("Got output", cipher)
+				return reportRunError("rsaenc", Prog1, strconv.Itoa(len(m)), args, errc)
+			}
 
-				recovered, errc := runProg(Prog2, runID,
-					[]string{P, Q, e, d, cipher})
-				if errc != nil {
-					// Errors which are "expected" should be marked with FAIL
-					if strings.Contains(recovered, "fail") {
-						errs <- fmt.Errorf("FAIL: %v", errc)
-						LogToFile.Printf("failed to run Prog2 on job#%s", runID)
-						continue
-					} else { // other errors are not expected and we stop there
-						LogError.Printf("failed to run %s on run %s\nerror: %v",
-							Prog2, runID, errc)
-						LogInfo.Println("after running:", Prog1, args)
-						log.Fatalln(errc)
-					}
-					fmt.Print("\n")
+			args2 := []string{P, Q, e, d, cipher}
+			recovered, errc := runProg(Prog2, runID, args2)
+			if errc != nil {
+				// Errors which are "expected" should be marked with FAIL
+				if strings.Contains(recovered, "fail") {
+					LogToFile.Printf("failed to run Prog2 on job#%s", runID)
+					return fmt.Errorf("FAIL: %v", errc)
 				}
+				// other errors are not expected and we rerun it to
+				//  classify them
+				LogInfo.Println("after running:", Prog1, args)
+				return reportRunError("rsaenc", Prog2, runID, args2, errc)
+			}
 
-				// If the message we fed to the Prog1 does not match the
-				//  recovered plaintext from Prog2, an error must have occurred:
-				if m != recovered {
-					errs <- fmt.Errorf("decryption mismatch on length %d", len(m)/2)
-					LogToFile.Printf("decryption mismatch on inputs : %s \n"+
-						"Got outputs\t1: %s\n\t2: %s",
-						m, cipher, recovered)
-				}
+			// the oracle checks the mismatches, and the agreements if enabled
+			note := ""
+			if m != recovered || Config.Oracle {
+				v, ok := rsaOaepVector(N, e, d, cipher, m, "", "")
+				note = oracleDecryption(v, ok, Prog1, Prog2, m == recovered)
 			}
-			wg.Done()
-		}()
-	}
 
-	// Let us now fill our channel with the messages to be processed:
-	for i := Config.MinMsgLen * 2; i <= maxIter; i += incrementMsg {
-		TermPrintInline(1, "%d / %d", i/incrementMsg, maxIter/incrementMsg)
-		msgs <- msg[:i]
+			// If the message we fed to the Prog1 does not match the
+			//  recovered plaintext from Prog2, an error must have occurred:
+			if m != recovered {
+				LogToFile.Printf("decryption mismatch on inputs : %s \n"+
+					"Got outputs\t1: %s\n\t2: %s",
+					m, cipher, recovered)
+				// we rerun the failing case to see whether it reproduces
+				class := classifyFailure(func() (bool, error) {
+					cipher, err := runProg(Prog1, runID, args)
+					if err != nil {
+						return true, err
+					}
+					recovered, err := runProg(Prog2, runID, []string{P, Q, e, d, cipher})
+					return m != recovered, err
+				})
+				addFinding(Finding{Test: "rsaenc", Progs: []string{Prog1, Prog2},
+					Inputs: args, Message: "decryption mismatch", Class: class.String(), Oracle: note})
+				if note != "" {
+					LogWarning.Println(note)
+				}
+				addVector(rsaOaepVector(N, e, d, cipher, m, "",
+					Prog2+" failed to decrypt the ciphertext by "+Prog1, "Mismatch"))
+				return fmt.Errorf("decryption mismatch on length %d, %v", len(m)/2, class)
+			}
+			if Config.Oracle && note != "" {
+				addFinding(Finding{Test: "rsaenc", Progs: []string{Prog1, Prog2},
+					Inputs: args, Message: "invalid ciphertext decrypted", Oracle: note})
+				addVector(rsaOaepVector(N, e, d, cipher, m, "",
+					Prog2+" decrypted the invalid ciphertext by "+Prog1, "Mismatch"))
+				return fmt.Errorf("%s, on length %d", note, len(m)/2)
+			}
+			addGeneratedVector(rsaOaepVector(N, e, d, cipher, m, "",
+				"ciphertext by "+Prog1, "Generated"))
+			return nil
+		})
 	}
 
+	// let us wait for our jobs to finish
+	err := jobs.Wait()
 	fmt.Print("\n")
-	// We have to close the channel to inform the receiver that there are
-	//  no more messages coming.
-	close(msgs)
-	// let us wait for our workers to finish
-	wg.Wait()
-
-	if len(errs) > 0 {
-		// Initializing the return value
-		var mainErr MultiError
-		firstErr := true
-		for len(errs) > 0 {
-			e := <-errs
-			if firstErr {
-				firstErr = false
-				// This is not guaranteed to be the 1st one, but almost
-				LogInfo.Println("First error:", e)
-			}
-			mainErr = append(mainErr, e)
-		}
+	if err != nil {
+		// This is not guaranteed to be the 1st one, but almost
+		LogInfo.Println("First error:", err.(MultiError)[0])
 		TermPrepareFor(1)
-		return mainErr
 	}
-	return nil
+	return err
+}
+
+// oaepMaxMsgLen returns the maximal length in bytes of the messages OAEP can
+// encrypt with the modulus N and the configured hash.
+func oaepMaxMsgLen(N *big.Int) int {
+	hLen := 32
+	if h, ok := configHash(); ok {
+		hLen = h.Size()
+	}
+	return (N.BitLen()+7)/8 - 2*hLen - 2
 }
 
 // testRSAencPubMaxExponentLen will test the maximal size of the exponent
@@ -330,7 +396,7 @@ func testRSAencPubMaxExponentLen(msg string) (mainErr error) {
 	LogInfo.Println("testing max exponent lengths")
 	failed := false
 
-	var N, e, d, P, Q string
+	var N, P, Q string
 	N = Config.RsaN
 	P = Config.RsaP
 	Q = Config.RsaQ
@@ -344,16 +410,30 @@ func testRSAencPubMaxExponentLen(msg string) (mainErr error) {
 	TermPrepareFor(3)
 	// the range is currently hard-coded, ideally it should be generated using
 	// some kind of dichotomic-search like process with an upper limit
-	for iter, i := range [...]int{29, 30, 31, 32, 62, 63, 64, 126, 127, 128} {
-		e, d = generateExponents(i)
-		TermDisplay(3, "trying with public exponent of bit-length %d/%d", i, 128)
-		erc := testRSAencConsistency(msg, N, e, d, P, Q, 1)
-		if erc != nil {
+	bitLens := [...]int{29, 30, 31, 32, 62, 63, 64, 126, 127, 128}
+	failures := make([]bool, len(bitLens))
+	jobs := newJobGroup("max exponent lengths", len(bitLens))
+	for iter, i := range bitLens {
+		iter, i := iter, i
+		// the exponents are generated beforehand, since they rely on the Prng
+		e, d := generateExponents(i)
+		jobs.Go(func() error {
+			if erc := testRSAencConsistency(msg, N, e, d, P, Q, 1); erc != nil {
+				failures[iter] = true
+				return fmt.Errorf("problem with bit-length %d", i)
+			}
+			return nil
+		})
+	}
+	if err := jobs.Wait(); err != nil {
+		errs = err.(MultiError)
+	}
+	for iter, i := range bitLens {
+		if failures[iter] {
 			failed = true
 			if maxExp == 0 {
 				maxExp = i
 			}
-			errs = append(errs, fmt.Errorf("problem with bit-length %d", i))
 			fTests++
 		}
 		nTests = iter + 1
@@ -371,12 +451,12 @@ func testRSAencPubMaxExponentLen(msg string) (mainErr error) {
 }
 
 // testRSAencLargerMod tests the provided program against messages larger than
-// the used modulus, it does so by computing the size of the modulus and
-// generating a bigger message, before tring it and expecting an error. If no
-// error is thrown, then it'll return an error, otherwise it returns nil.
+// the used modulus, the caller generates the msg bigger than the modulus and
+// we try it, expecting an error. If no error is thrown, then it'll return an
+// error, otherwise it returns nil.
 // (TODO:We may argue later whether the throwned error should be outputed or not.
 // It is sowieso logged by the runProg function.)
-func testRSAencLargerMod(prog string) error {
+func testRSAencLargerMod(prog, msg string) error {
 	TermPrepareFor(1)
 	LogInfo.Println("testing larger than modulus against", prog)
 	id := "rsaenc#large_" + prog
@@ -384,13 +464,20 @@ func testRSAencLargerMod(prog string) error {
 	var N, e string
 	N = Config.RsaN
 	e = Config.RsaE
-	msg := randomHex((fromBase16(N).BitLen()+7)/8 + 8)
 
 	argsP := []string{N, e, msg}
 	_, err := runProg(prog, id, argsP)
 	if err == nil {
+		addFinding(Finding{Test: "rsaenc.largerMod", Progs: []string{prog}, Inputs: argsP,
+			Message: "accepted a message larger than the modulus"})
+		// this cannot be expressed as an encryption test vector, so we export
+		// the matching decryption one
+		addVector(rsaOaepVector(N, e, Config.RsaD, msg, "", wycheInvalid,
+			prog+" accepted to encrypt this integer larger than the modulus", "LargeCiphertext"))
 		return fmt.Errorf("%s accepted a message larged than the modulus", prog)
 	}
+	addGeneratedVector(rsaOaepVector(N, e, Config.RsaD, msg, "", wycheInvalid,
+		"integer larger than the modulus", "LargeCiphertext"))
 	return nil
 }
 
@@ -437,7 +524,7 @@ func prepareInputsForRsa() (inputData []string, classes []int) {
 	upperB := new(big.Int).Sub(N, lowerB)
 	ee, err := strconv.ParseInt(Config.RsaE, 16, 8)
 	if err != nil {
-		log.Fatal(err)
+		Fatalln(err)
 	}
 	pubK := &rsa.PublicKey{N: N, E: int(ee)}
 	for i := 0; i < numberMeasurements; i++ {
@@ -472,16 +559,16 @@ func prepareInputsForSpecialRsa(special int) func() ([]string, []int) {
 
 		// we initialize the key and the big integers we need :
 		N := fromBase16(Config.RsaN)
-		ee, err := strconv.ParseInt(Config.RsaE, 16, 8)
+		ee, err := strconv.ParseInt(Config.RsaE, 16, 32)
 		if err != nil {
-			log.Fatal(err)
+			Fatalln(err)
 		}
 		pubK := &rsa.PublicKey{N: N, E: int(ee)}
 		// we craft the cipher, since we know the key:
 		// we encrypt to be sure of its size and format when decrypted: it'll be ee
 		data0, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pubK, []byte("Test"), []byte(""))
 		if err != nil {
-			log.Fatal(err)
+			Fatalln(err)
 		}
 		var data []byte
 
@@ -533,7 +620,7 @@ func prepareInputsForSpecialRsa(special int) func() ([]string, []int) {
 			data = new(big.Int).Div(num, denom).Bytes()
 			data = leftPad(data, k)
 		default:
-			log.Fatalln("An unexpected index was provided to the special case RSA input preparation function")
+			Fatalln("An unexpected index was provided to the special case RSA input preparation function")
 		}
 		for i := 0; i < numberMeasurements; i++ {
 			classes[i] = rn.Intn(2)
@@ -3,10 +3,8 @@ package cdf
 import (
 	"errors"
 	"fmt"
-	"log"
 	"strconv"
 	"strings"
-	"sync"
 )
 
 // TestRSAsign implements the cdf interface for RSA based signature schemes.
@@ -21,19 +19,39 @@ import (
 func TestRSAsign() error {
 	LogInfo.Print("testing rsasign")
 
+	// the tests are run with each hash supported by both programs
+	hashes := TestedHashes()
+	defer selectHash(Config.Hash)
+	selectHash(hashes[0])
+
+	// calibrating the timeouts, the verification one on a signature from Prog1
+	warmup := warmupMsg(Config.MinMsgLen)
+	calibrateTimeout(Prog1, []string{Config.RsaP, Config.RsaQ, Config.RsaE, Config.RsaD, warmup})
+	if signature, err := runProg(Prog1, "warmup#sign", []string{Config.RsaP, Config.RsaQ, Config.RsaE, Config.RsaD, warmup}); err == nil {
+		calibrateTimeout(Prog2, []string{Config.RsaN, Config.RsaE, signature, warmup})
+	}
+
 	failed := false
 
 	// Generate random hexadecimal data to try and sign those (the tested
 	// program are supposed to unhexlify this data to obtain bytes)
 	msg := randomHex(Config.MaxMsgLen)
-	LogInfo.Println("testing different message's lengths")
-
-	if err := testRsaSignConsistency(msg, Config.RsaN, Config.RsaE, Config.RsaD,
-		Config.RsaP, Config.RsaQ, Config.MaxMsgLen); err != nil {
-		failed = true
-		LogError.Println("while testing messages lengths:", err)
-	} else {
-		LogSuccess.Println("message's lengths test okay")
+
+	for _, hash := range hashes {
+		selectHash(hash)
+		if len(hashes) > 1 {
+			LogInfo.Println("testing with", hash)
+		}
+		if subTest("rsasign.msgLen") {
+			LogInfo.Println("testing different message's lengths")
+			if err := testRsaSignConsistency(msg, Config.RsaN, Config.RsaE, Config.RsaD,
+				Config.RsaP, Config.RsaQ, Config.MaxMsgLen); err != nil {
+				failed = true
+				LogError.Println("while testing messages lengths:", err)
+			} else {
+				LogSuccess.Println("message's lengths test okay")
+			}
+		}
 	}
 
 	if failed {
@@ -49,89 +67,101 @@ func TestRSAsign() error {
 func testRsaSignConsistency(msg, N, e, d, P, Q string, iter int) error {
 	LogInfo.Println("testing consistency:")
 
-	var errs MultiError
-
-	// Initializing a common, unbuffered channel which gives tasks to
-	// the worker goroutines
-	msgs := make(chan string)
-	// spawn some worker goroutines
-	var wg sync.WaitGroup
-	for j := uint(0); j < Config.Concurrency; j++ {
-		wg.Add(1)
-		go func() {
-			for m := range msgs { // using range has to be closed later
-				runID := fmt.Sprintf("rsasign#%d#%d", iter, len(m))
-
-				args := []string{P, Q, e, d, m}
-				// get the message m from channel msgs and sign it
-				signature, errc := runProg(Prog1, strconv.Itoa(len(m)), args)
-				if errc != nil {
-					// Errors which are "expected" should be marked with FAIL
-					// in the tested program
-					if strings.Contains(signature, "fail") {
-						errs = append(errs, fmt.Errorf("FAIL: %v", errc))
-						LogToFile.Println("Skipping the rest of job", runID)
-						continue
-					} else {
-						// other errors are not expected by the tested program
-						// and we stop there
-						fmt.Println("\nUnexpected error on", Prog1)
-						fmt.Println("Got output", signature)
-						log.Fatalln(errc)
-					}
-				}
-
-				result, errc := runProg(Prog2, runID,
-					[]string{N, e, signature, m})
-				if errc != nil {
-					// Errors which are "expected" should be marked with FAIL
-					if strings.Contains(result, "fail") {
-						errs = append(errs, fmt.Errorf("FAIL: %v", errc))
-						LogToFile.Printf("failed to run Prog2 on job#%s", runID)
-						continue
-					} else { // other errors are not expected and we stop there
-						LogError.Printf("failed to run %s on run %s\nerror: %v",
-							Prog2, runID, errc)
-						LogInfo.Println("after running:", Prog1, args)
-						log.Fatalln(errc)
-					}
-					fmt.Print("\n")
-				}
-
-				// If the message we fed to the Prog1 is not valid wrt its sign
-				//   according to Prog2, an error must have occurred:
-				if result != trueStr {
-					errs = append(errs,
-						fmt.Errorf("verification failed on length %d", len(m)/2))
-					LogToFile.Printf("error on inputs : %s \n"+
-						"Got outputs\t1: %s\n\t2: %s",
-						m, signature, result)
-				}
-			}
-			wg.Done()
-		}()
-	}
-
 	maxIter := Config.MaxMsgLen * 2         // since the settings are in byte
 	incrementMsg := Config.IncrementMsg * 2 // since the settings are in byte
 	if maxIter > iter*incrementMsg {
 		maxIter = iter * incrementMsg
 	}
-	// Let us now fill our channel with the messages to be processed:
+	var msgs []string
 	for i := Config.MinMsgLen * 2; i <= maxIter; i += incrementMsg {
-		TermPrintInline(1, "%d / %d", i/incrementMsg, maxIter/incrementMsg)
-		msgs <- msg[:i]
+		msgs = append(msgs, msg[:i])
 	}
 
-	fmt.Print("\n")
-	// We have to close the channel to inform the receiver that there are
-	//  no more messages coming.
-	close(msgs)
-	// let us wait for our workers to finish
-	wg.Wait()
-
-	if len(errs) > 0 {
-		return errs
+	// Let us now submit the messages to be processed:
+	jobs := newJobGroup("rsasign", len(msgs))
+	for _, m := range msgs {
+		m := m
+		jobs.Go(func() error {
+			runID := fmt.Sprintf("rsasign#%d#%d", iter, len(m))
+
+			args := []string{P, Q, e, d, m}
+			// sign the message m
+			signature, errc := runProg(Prog1, strconv.Itoa(len(m)), args)
+			if errc != nil {
+				// Errors which are "expected" should be marked with FAIL
+				// in the tested program
+				if strings.Contains(signature, "fail") {
+					LogToFile.Println("Skipping the rest of job", runID)
+					return fmt.Errorf("FAIL: %v", errc)
+				}
+				// other errors are not expected by the tested program
+				// and we rerun it to classify them
+				fmt.Println("\nUnexpected error on", Prog1)
+				fmt.Println("Got output", signature)
+				return reportRunError("rsasign", Prog1, strconv.Itoa(len(m)), args, errc)
+			}
+
+			args2 := []string{N, e, signature, m}
+			result, errc := runProg(Prog2, runID, args2)
+			if errc != nil {
+				// Errors which are "expected" should be marked with FAIL
+				if strings.Contains(result, "fail") {
+					LogToFile.Printf("failed to run Prog2 on job#%s", runID)
+					return fmt.Errorf("FAIL: %v", errc)
+				}
+				// other errors are not expected and we rerun it to
+				// classify them
+				LogInfo.Println("after running:", Prog1, args)
+				return reportRunError("rsasign", Prog2, runID, args2, errc)
+			}
+
+			accepted := result == trueStr
+			// the oracle checks the mismatches, and the agreements if enabled
+			note := ""
+			if !accepted || Config.Oracle {
+				v, ok := rsaSignVector(N, e, signature, m, "")
+				note = oracleSignature(v, ok, Prog1, Prog2, accepted)
+			}
+
+			// If the message we fed to the Prog1 is not valid wrt its sign
+			//   according to Prog2, an error must have occurred:
+			if !accepted {
+				LogToFile.Printf("error on inputs : %s \n"+
+					"Got outputs\t1: %s\n\t2: %s",
+					m, signature, result)
+				// we rerun the failing case to see whether it reproduces
+				class := classifyFailure(func() (bool, error) {
+					signature, err := runProg(Prog1, runID, args)
+					if err != nil {
+						return true, err
+					}
+					result, err := runProg(Prog2, runID, []string{N, e, signature, m})
+					return result != trueStr, err
+				})
+				addFinding(Finding{Test: "rsasign", Progs: []string{Prog1, Prog2},
+					Inputs: args, Message: "verification failure", Class: class.String(), Oracle: note})
+				if note != "" {
+					LogWarning.Println(note)
+				}
+				addVector(rsaSignVector(N, e, signature, m,
+					Prog2+" rejected the signature by "+Prog1, "Mismatch"))
+				return fmt.Errorf("verification failed on length %d, %v", len(m)/2, class)
+			}
+			if Config.Oracle && note != "" {
+				addFinding(Finding{Test: "rsasign", Progs: []string{Prog1, Prog2},
+					Inputs: args, Message: "invalid signature accepted", Oracle: note})
+				addVector(rsaSignVector(N, e, signature, m,
+					Prog2+" accepted the invalid signature by "+Prog1, "Mismatch"))
+				return fmt.Errorf("%s, on length %d", note, len(m)/2)
+			}
+			addGeneratedVector(rsaSignVector(N, e, signature, m,
+				"signature by "+Prog1, "Generated"))
+			return nil
+		})
 	}
-	return nil
+
+	// let us wait for our jobs to finish
+	err := jobs.Wait()
+	fmt.Print("\n")
+	return err
 }
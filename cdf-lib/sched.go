@@ -0,0 +1,97 @@
+package cdf
+
+import (
+	"sort"
+	"sync"
+)
+
+// slots is the pool of execution slots shared by all the tests: runProg
+// holds one while the tested program is running, so that at most
+// Config.Concurrency programs are running at the same time, whatever the
+// tests which submitted them. Since slots are only held while a program
+// runs, jobs may themselves submit and wait for other jobs.
+var slots = struct {
+	sync.Mutex
+	c chan struct{}
+}{}
+
+// acquireSlot blocks until an execution slot is available and returns the
+// function to call to release it.
+func acquireSlot() (release func()) {
+	slots.Lock()
+	n := int(Config.Concurrency)
+	if n < 1 {
+		n = 1
+	}
+	// the pool is (re)created lazily, since the Config is read after init
+	if slots.c == nil || cap(slots.c) != n {
+		slots.c = make(chan struct{}, n)
+	}
+	c := slots.c
+	slots.Unlock()
+
+	c <- struct{}{}
+	return func() { <-c }
+}
+
+// jobGroup is a set of jobs submitted to the scheduler by a test, it collects
+// their errors and displays their progress.
+type jobGroup struct {
+	name  string
+	total int
+	wg    sync.WaitGroup
+	mu    sync.Mutex
+	done  int
+	errs  MultiError
+}
+
+// newJobGroup creates a group for the given number of jobs, its name is used
+// when displaying the progress.
+func newJobGroup(name string, total int) *jobGroup {
+	return &jobGroup{name: name, total: total}
+}
+
+// Go submits a job to the scheduler. The jobs of a group run concurrently,
+// so they must not share any unprotected state, notably the Prng: random
+// inputs have to be drawn before submitting the jobs to keep runs
+// reproducible.
+func (g *jobGroup) Go(job func() error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		err := job()
+
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		g.done++
+		if err != nil {
+			g.errs = append(g.errs, err)
+		}
+		TermPrintInline(1, "%s: %d / %d", g.name, g.done, g.total)
+	}()
+}
+
+// Wait blocks until all the jobs of the group are done and returns their
+// errors as a MultiError sorted by message, or nil if they all succeeded.
+func (g *jobGroup) Wait() error {
+	g.wg.Wait()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.errs) == 0 {
+		return nil
+	}
+	sort.Slice(g.errs, func(i, j int) bool {
+		return g.errs[i].Error() < g.errs[j].Error()
+	})
+	return g.errs
+}
+
+// withArgs returns a new slice made of the base arguments followed by the
+// extra ones, without ever modifying the base slice, which may be shared
+// between concurrent jobs.
+func withArgs(base []string, extra ...string) []string {
+	args := make([]string, 0, len(base)+len(extra))
+	args = append(args, base...)
+	return append(args, extra...)
+}
@@ -0,0 +1,58 @@
+package cdf
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestJobGroup(t *testing.T) {
+	initForTesting("ENC")
+	Config.Concurrency = 2
+
+	var mu sync.Mutex
+	current, max := 0, 0
+	jobs := newJobGroup("test", 10)
+	for i := 0; i < 10; i++ {
+		i := i
+		jobs.Go(func() error {
+			release := acquireSlot()
+			defer release()
+			mu.Lock()
+			current++
+			if current > max {
+				max = current
+			}
+			mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			current--
+			mu.Unlock()
+			if i%3 == 0 {
+				return errors.New("failed")
+			}
+			return nil
+		})
+	}
+	err := jobs.Wait()
+	if max > 2 {
+		t.Error("Expected at most 2 concurrent jobs, got", max)
+	}
+	if errs, ok := err.(MultiError); !ok || len(errs) != 4 {
+		t.Error("Expected 4 errors, got", err)
+	}
+
+	if err := newJobGroup("empty", 0).Wait(); err != nil {
+		t.Error("Expected nil, got", err)
+	}
+}
+
+func TestWithArgs(t *testing.T) {
+	base := make([]string, 2, 10)
+	a := withArgs(base, "a")
+	b := withArgs(base, "b")
+	if a[2] != "a" || b[2] != "b" || len(base) != 2 {
+		t.Error("withArgs modified its base slice:", a, b)
+	}
+}
@@ -0,0 +1,135 @@
+package cdf
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minTimeout is the lower bound of a calibrated timeout, it absorbs the
+// scheduling noise affecting programs answering within a few milliseconds.
+const minTimeout = 250 * time.Millisecond
+
+// timeouts stores the per-program timeouts obtained by calibration, along
+// with the baseline latency they were derived from.
+var timeouts = struct {
+	sync.RWMutex
+	limit    map[string]time.Duration
+	baseline map[string]time.Duration
+}{limit: make(map[string]time.Duration), baseline: make(map[string]time.Duration)}
+
+// hangError is the error returned by runProg when a program exceeded its
+// timeout, which typically indicates an infinite loop.
+type hangError struct {
+	prog     string
+	timeout  time.Duration
+	baseline time.Duration
+}
+
+// (hangError) Error implements the error interface. It keeps the historical
+// STOP marker of the timeout errors.
+func (e hangError) Error() string {
+	if e.baseline > 0 {
+		return fmt.Sprintf("%s hang: no answer after %v (baseline %v). Cmd timed out! STOP",
+			e.prog, e.timeout, e.baseline)
+	}
+	return fmt.Sprintf("%s hang: no answer after %v. Cmd timed out! STOP",
+		e.prog, e.timeout)
+}
+
+// isHang tells whether the provided error is due to a program timing out.
+func isHang(err error) bool {
+	if err == nil {
+		return false
+	}
+	if _, ok := err.(hangError); ok {
+		return true
+	}
+	return strings.Contains(err.Error(), "STOP")
+}
+
+// timeoutFor returns the timeout to apply when running prog: its calibrated
+// one if any, the global Config.Timeout otherwise.
+func timeoutFor(prog string) (time.Duration, time.Duration) {
+	timeouts.RLock()
+	defer timeouts.RUnlock()
+	if limit, ok := timeouts.limit[prog]; ok {
+		return limit, timeouts.baseline[prog]
+	}
+	return time.Duration(Config.Timeout) * time.Second, 0
+}
+
+// calibrateTimeout measures the baseline latency of prog on the provided
+// warm-up inputs and sets its timeout to Config.TimeoutFactor times that
+// baseline. A first pass over the inputs is not measured, to let the caches
+// and JITs warm up, then the slowest of Config.WarmupRuns passes is taken as
+// baseline. Each pass runs Config.Concurrency copies of every input at once,
+// since the tests run that many programs at the same time and the latency
+// is higher under such a load than when running alone. Calibration is
+// disabled when TimeoutFactor is not set, and if one warm-up run fails, prog
+// keeps the global Config.Timeout.
+func calibrateTimeout(prog string, inputs ...[]string) {
+	if Config.TimeoutFactor <= 0 || len(inputs) == 0 {
+		return
+	}
+	runs := Config.WarmupRuns
+	if runs <= 0 {
+		runs = 3
+	}
+	copies := int(Config.Concurrency)
+	if copies < 1 {
+		copies = 1
+	}
+
+	var mu sync.Mutex
+	var baseline time.Duration
+	for i := 0; i <= runs; i++ {
+		i := i
+		jobs := newJobGroup("warm-up of "+prog, copies*len(inputs))
+		for _, args := range inputs {
+			args := args
+			for c := 0; c < copies; c++ {
+				jobs.Go(func() error {
+					start := time.Now()
+					if out, err := runProg(prog, "warmup#"+prog, args); err != nil {
+						return fmt.Errorf("%s %v", out, err)
+					}
+					elapsed := time.Since(start)
+					// the first pass is the cold one, we do not measure it
+					mu.Lock()
+					if i > 0 && elapsed > baseline {
+						baseline = elapsed
+					}
+					mu.Unlock()
+					return nil
+				})
+			}
+		}
+		if err := jobs.Wait(); err != nil {
+			LogWarning.Println("warm-up failed for", prog,
+				"keeping the default timeout. It returned:", err)
+			return
+		}
+	}
+
+	limit := baseline * time.Duration(Config.TimeoutFactor)
+	if limit < minTimeout {
+		limit = minTimeout
+	}
+	timeouts.Lock()
+	timeouts.limit[prog] = limit
+	timeouts.baseline[prog] = baseline
+	timeouts.Unlock()
+	LogInfo.Printf("calibrated timeout for %s: %v (baseline latency %v)\n",
+		prog, limit, baseline)
+}
+
+// warmupMsg returns a fixed, non-random, message of the given byte-length to
+// use as warm-up input without altering the seeded Prng sequence.
+func warmupMsg(length int) string {
+	if length <= 0 {
+		length = 1
+	}
+	return strings.Repeat("42", length)
+}
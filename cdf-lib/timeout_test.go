@@ -0,0 +1,40 @@
+package cdf
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCalibrateTimeout(t *testing.T) {
+	initForTesting("ENC")
+	defer func() { Config.TimeoutFactor = 0 }()
+
+	// calibration is disabled by default
+	calibrateTimeout("prog-disabled", []string{"00", "00"})
+	if limit, _ := timeoutFor("prog-disabled"); limit != time.Duration(Config.Timeout)*time.Second {
+		t.Error("Expected the default timeout, got", limit)
+	}
+
+	Config.TimeoutFactor = 10
+	Config.WarmupRuns = 2
+	calibrateTimeout("prog-calibrated", []string{"00", "00"}, []string{"00", "0011"})
+	limit, baseline := timeoutFor("prog-calibrated")
+	if baseline <= 0 || limit < minTimeout || limit < 10*baseline {
+		t.Errorf("Unexpected calibration, got timeout %v for baseline %v", limit, baseline)
+	}
+	// one cold pass and two measured ones, on two inputs run by as many
+	// programs at once as the tests do
+	if execCounter != 6*int(Config.Concurrency) {
+		t.Errorf("Expected %d executions, got %d", 6*Config.Concurrency, execCounter)
+	}
+}
+
+func TestIsHang(t *testing.T) {
+	if !isHang(hangError{prog: "prog", timeout: time.Second}) {
+		t.Error("Expected a hangError to be a hang")
+	}
+	if isHang(errors.New("exit status 1")) || isHang(nil) {
+		t.Error("Expected a regular error not to be a hang")
+	}
+}
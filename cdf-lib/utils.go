@@ -13,6 +13,7 @@ import (
 	"os/exec"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -34,8 +35,10 @@ var (
 	Interf       string      // interface
 	Prog1        string      // the path to the first executable
 	Prog2        string      // the path to the second executable in interfaces where two are needed
-	TestHashes   *bool       // specify if the -h flag is supported by both program
+	TestHashes   *bool       // specify if the -h flag is supported by the programs not declaring their capabilities
 	TestTimings  *int        // specify how many, if any, timing tests should be run
+	ExportFile   *string     // the file to export the findings to as Wycheproof test vectors
+	ExportAll    *bool       // whether all the generated cases are exported, not only the findings
 )
 
 // Config contains the global cdf Configuration variables:
@@ -45,32 +48,61 @@ var (
 // increment* is the number of bytes of increment between two loops in some interfaces
 // Rsa* for oaep/pkcs encryption: the primes P,Q, the modulus N, the public exponent E and the private one D. Must be given as hex strings in big endian representation
 // Ecdsa*: the X and Y public coordinates to use and the private big integer D, all to be given as hex strings in big endian representation
+// RsaKeyFile, DsaKeyFile, EcdsaKeyFile: PEM or DER key files to fill in the above Rsa*, Dsa* and Ecdsa* fields from
+// RsaKeySizes, DsaKeySizes, EcdsaKeys: the sizes of the RSA and DSA keys, and the number of ECDSA keys per curve, to generate and test along with the above ones
+// Curves: the curves the ecdsa programs are tested on, by default the one of the Ecdsa* key
+// EcdsaCurveKeys: the ECDSA keys to use, by curve, on the curves other than the one of the Ecdsa* key, a key being generated on the curves without one
+// Timeout: the number of seconds after which a program is killed, unless its timeout was calibrated
+// TimeoutFactor: if set, each program's timeout is calibrated to this multiple of its baseline latency
+// WarmupRuns: the number of measured warm-up runs used to compute the baseline latency
+// PropertyRuns: the number of times the same input is fed to a program to check it is deterministic, or randomised
+// Rfc6979: whether the dsa and ecdsa signatures are expected to be deterministic as per RFC 6979
+// Reruns: the number of times a failing case is rerun to classify it as deterministic, intermittent or environmental
+// Hash: the hash used by the tested programs (to sign, for OAEP or HMAC), used to compute the expected results of exported test vectors and by the oracle
+// Oracle: whether cdf checks with its own crypto the cases on which both programs agree, the mismatches being always checked
+// Capabilities: the capabilities of the programs, by path or base name, for the ones which cannot declare them with --cdf-capabilities
 // Concurrency: the maximum number of concurrent go routine which should be running an exec call to the tested program at the same time
 // VerboseLog: a boolean specifying whether all inputs/outputs are to be written to a log file or not. Can help with debugging
 var Config struct {
-	Seed         int64  `json:"seed"`
-	MinMsgLen    int    `json:"minMsgLen"`
-	MaxMsgLen    int    `json:"maxMsgLen"`
-	IncrementMsg int    `json:"incrementMsg"`
-	MinKeyLen    int    `json:"minKeyLen"`
-	MaxKeyLen    int    `json:"maxKeyLen"`
-	IncrementKey int    `json:"incrementKey"`
-	RsaP         string `json:"rsaP"`
-	RsaQ         string `json:"rsaQ"`
-	RsaN         string `json:"rsaN"`
-	RsaE         string `json:"rsaE"`
-	RsaD         string `json:"rsaD"`
-	EcdsaX       string `json:"ecdsaX"`
-	EcdsaY       string `json:"ecdsaY"`
-	EcdsaD       string `json:"ecdsaD"`
-	DsaP         string `json:"dsaP"`
-	DsaQ         string `json:"dsaQ"`
-	DsaG         string `json:"dsaG"`
-	DsaY         string `json:"dsaY"`
-	DsaX         string `json:"dsaX"`
-	Timeout      int    `json:"timeout"`
-	Concurrency  uint   `json:"concurrency"`
-	VerboseLog   bool   `json:"verboseLog"`
+	Seed           int64                   `json:"seed"`
+	MinMsgLen      int                     `json:"minMsgLen"`
+	MaxMsgLen      int                     `json:"maxMsgLen"`
+	IncrementMsg   int                     `json:"incrementMsg"`
+	MinKeyLen      int                     `json:"minKeyLen"`
+	MaxKeyLen      int                     `json:"maxKeyLen"`
+	IncrementKey   int                     `json:"incrementKey"`
+	RsaP           string                  `json:"rsaP"`
+	RsaQ           string                  `json:"rsaQ"`
+	RsaN           string                  `json:"rsaN"`
+	RsaE           string                  `json:"rsaE"`
+	RsaD           string                  `json:"rsaD"`
+	EcdsaX         string                  `json:"ecdsaX"`
+	EcdsaY         string                  `json:"ecdsaY"`
+	EcdsaD         string                  `json:"ecdsaD"`
+	DsaP           string                  `json:"dsaP"`
+	DsaQ           string                  `json:"dsaQ"`
+	DsaG           string                  `json:"dsaG"`
+	DsaY           string                  `json:"dsaY"`
+	DsaX           string                  `json:"dsaX"`
+	RsaKeyFile     string                  `json:"rsaKeyFile"`
+	DsaKeyFile     string                  `json:"dsaKeyFile"`
+	EcdsaKeyFile   string                  `json:"ecdsaKeyFile"`
+	RsaKeySizes    []int                   `json:"rsaKeySizes"`
+	DsaKeySizes    []DsaKeySize            `json:"dsaKeySizes"`
+	EcdsaKeys      int                     `json:"ecdsaKeys"`
+	Curves         []string                `json:"curves"`
+	EcdsaCurveKeys map[string]EcdsaKey     `json:"ecdsaCurveKeys"`
+	Timeout        int                     `json:"timeout"`
+	TimeoutFactor  int                     `json:"timeoutFactor"`
+	WarmupRuns     int                     `json:"warmupRuns"`
+	PropertyRuns   int                     `json:"propertyRuns"`
+	Rfc6979        bool                    `json:"rfc6979"`
+	Reruns         int                     `json:"reruns"`
+	Hash           string                  `json:"hash"`
+	Oracle         bool                    `json:"oracle"`
+	Capabilities   map[string]Capabilities `json:"capabilities"`
+	Concurrency    uint                    `json:"concurrency"`
+	VerboseLog     bool                    `json:"verboseLog"`
 }
 
 // MultiError allows to store multiple errors
@@ -135,7 +167,7 @@ func randomHex(len int) string {
 func fromBase16(base16 string) *big.Int {
 	i, ok := new(big.Int).SetString(base16, 16)
 	if !ok {
-		log.Fatalln("trying to convert from base16 a bad number: " + base16)
+		Fatalln("trying to convert from base16 a bad number: " + base16)
 	}
 	return i
 }
@@ -159,13 +191,87 @@ func DisableLogFile() {
 // which allows us to mimick the exec package in test files!
 var execCommand = exec.Command
 
+// running keeps track of the programs currently being run, so that their
+// whole process tree can be torn down when cdf exits.
+var running = struct {
+	sync.Mutex
+	cmds map[*exec.Cmd]bool
+}{cmds: make(map[*exec.Cmd]bool)}
+
+// trackProcess registers a started cmd as running
+func trackProcess(cmd *exec.Cmd) {
+	running.Lock()
+	running.cmds[cmd] = true
+	running.Unlock()
+}
+
+// untrackProcess removes a cmd from the running ones once it has been waited for
+func untrackProcess(cmd *exec.Cmd) {
+	running.Lock()
+	delete(running.cmds, cmd)
+	running.Unlock()
+}
+
+// KillRunning kills the process trees of all the programs currently being
+// run. It must be called before exiting, otherwise the processes spawned by
+// the tested programs may survive cdf as orphans.
+func KillRunning() {
+	running.Lock()
+	defer running.Unlock()
+	for cmd := range running.cmds {
+		if err := killProcGroup(cmd); err != nil {
+			LogToFile.Println("Could not kill the process tree of", cmd.Path, ":", err)
+		}
+	}
+}
+
+// Fatalln is log.Fatalln killing the programs still running first: exiting
+// skips the deferred calls to KillRunning, so every fatal error once the
+// programs may be running must go through it.
+func Fatalln(v ...interface{}) {
+	KillRunning()
+	log.Output(2, fmt.Sprintln(v...))
+	os.Exit(1)
+}
+
 // runProg is a helper function allowing to run the program with specific arguments
 func runProg(prog, runID string, args []string) (string, error) {
+	out, err := runProgRaw(prog, runID, args)
+	return strings.ToLower(strings.TrimSpace(out)), err
+}
+
+// runProgRaw runs the program as runProg does, but returns its output as is,
+// apart from the DER signatures, given and output as r and s by the tests
+func runProgRaw(prog, runID string, args []string) (string, error) {
+	der := usesDER(prog)
+	if der {
+		args = derArgs(args)
+	}
+	out, err := execProg(prog, runID, args)
+	if der && err == nil {
+		out = derOutput(out)
+	}
+	return out, err
+}
+
+// execProg runs the program, or the built-in one, on the arguments
+func execProg(prog, runID string, args []string) (string, error) {
+	// the programs declaring several hashes or curves are given the selected ones
+	args = withArgs(selectedArgs(prog), args...)
+	if strings.HasPrefix(prog, builtinPrefix) {
+		return runBuiltin(prog, runID, args)
+	}
 
 	LogToFile.Println(strings.Join(append([]string{"Batch#", runID,
 		"Attempting :", prog}, args...), " "))
 	var cmd *exec.Cmd
 	cmd = execCommand(prog, args...)
+	// we wait for an execution slot, to honour Config.Concurrency globally
+	release := acquireSlot()
+	defer release()
+	// we run the program in its own process group to be able to kill its
+	// children as well, typically when it is a wrapper around a JVM
+	setProcGroup(cmd)
 
 	// we link Stdout and Stderr to alternative bytes.Buffer to control the outputs
 	var out, outerr bytes.Buffer
@@ -173,10 +279,18 @@ func runProg(prog, runID string, args []string) (string, error) {
 	cmd.Stderr = &outerr
 	err := cmd.Start()
 	if err != nil {
-		LogError.Fatalln("Could not start exec Cmd:", err)
+		Fatalln("Could not start exec Cmd:", err)
 	}
+	trackProcess(cmd)
+	defer untrackProcess(cmd)
 	//out, err := cmd.CombinedOutput()
-	timer := time.AfterFunc(time.Duration(Config.Timeout)*time.Second, func() { cmd.Process.Kill() })
+	timeout, baseline := timeoutFor(prog)
+	timer := time.AfterFunc(timeout, func() {
+		if err := killProcGroup(cmd); err != nil {
+			LogToFile.Println("Could not kill the process tree of", prog, ":", err)
+			cmd.Process.Kill()
+		}
+	})
 	err = cmd.Wait()
 	if err != nil {
 		LogToFile.Println("Error on batch#", runID, "with", prog)
@@ -186,23 +300,34 @@ func runProg(prog, runID string, args []string) (string, error) {
 			"runned successfully, it returned: ", out.String())
 	}
 	if !timer.Stop() {
-		return "", fmt.Errorf("Cmd timed out! STOP")
+		return "", hangError{prog: prog, timeout: timeout, baseline: baseline}
 	}
 
-	return strings.ToLower(strings.TrimSpace(out.String() + outerr.String())), err
+	return out.String() + outerr.String(), err
 }
 
-// runOrExitOnErr invokes runProg and if we encounter an error
-// exits by invoking log.Fatal with the error.
-func runOrExitOnErr(prog, id string, args ...string) string {
+// runOrClassify invokes runProg and if it fails, classifies the failure with
+// classifyRunError and reports it as a finding of the test, typically an
+// environmental one when prog timed out. The error is returned for the caller
+// to report it instead of exiting.
+func runOrClassify(test, prog, id string, args ...string) (string, error) {
 	outStr, err := runProg(prog, id, args)
-	if err != nil {
-		fmt.Printf("\nExit on: %s\n", outStr)
-		LogError.Println(append([]string{"Failed after running:",
-			prog}, args...))
-		log.Fatalln(err)
+	if err == nil {
+		return outStr, nil
 	}
-	return outStr
+	return outStr, reportRunError(test, prog, id, args, err)
+}
+
+// reportRunError classifies the error err returned by runProg when running
+// prog on args with classifyRunError, reports it as a finding of the test and
+// returns the error the caller reports.
+func reportRunError(test, prog, id string, args []string, err error) error {
+	LogError.Println(append([]string{"Failed after running:",
+		prog}, args...))
+	class := classifyRunError(err, prog, id, args)
+	addFinding(Finding{Test: test, Progs: []string{prog}, Inputs: args,
+		Message: "failed to run: " + err.Error(), Class: class.String()})
+	return fmt.Errorf("%s failed on job %s: %v, %v", prog, id, err, class)
 }
 
 // bigSqrt is computing the integer square-root of x, for x a big integer
@@ -242,7 +367,7 @@ func (s Int64ToSort) Swap(i, j int) {
 func percentile(x []int64, perc float64) int64 {
 	val := int(perc * float64(len(x)))
 	if len(x) <= val || 0 >= val {
-		log.Fatalln("Error, percentile should be smaller than 1 and bigger than 0. Got:\n", val, len(x), perc)
+		Fatalln("Error, percentile should be smaller than 1 and bigger than 0. Got:\n", val, len(x), perc)
 	}
 	sort.Sort(Int64ToSort(x))
 	return x[val]
@@ -267,3 +392,47 @@ func leftPad(input []byte, size int) (out []byte) {
 	copy(out[len(out)-n:], input)
 	return
 }
+
+// factorModulus recovers the primes p > q of the RSA modulus n from the public
+// and private exponents e and d, using the classic probabilistic algorithm
+// (see e.g. the Handbook of Applied Cryptography, 8.2.2).
+func factorModulus(n, e, d *big.Int) (p, q *big.Int, err error) {
+	one := big.NewInt(1)
+	nm1 := new(big.Int).Sub(n, one)
+	// k = de - 1 is a multiple of λ(n), we write it k = 2^t * r with r odd
+	k := new(big.Int).Mul(d, e)
+	k.Sub(k, one)
+	if k.Sign() <= 0 || k.Bit(0) != 0 {
+		return nil, nil, fmt.Errorf("inconsistent RSA exponents")
+	}
+	r := new(big.Int).Set(k)
+	t := 0
+	for r.Bit(0) == 0 {
+		r.Rsh(r, 1)
+		t++
+	}
+
+	for g := int64(2); g < 100; g++ {
+		x := new(big.Int).Exp(big.NewInt(g), r, n)
+		if x.Cmp(one) == 0 || x.Cmp(nm1) == 0 {
+			continue
+		}
+		for i := 0; i < t; i++ {
+			y := new(big.Int).Exp(x, big.NewInt(2), n)
+			if y.Cmp(one) == 0 {
+				// x is a non-trivial square root of 1 mod n
+				p = new(big.Int).GCD(nil, nil, new(big.Int).Sub(x, one), n)
+				q = new(big.Int).Div(n, p)
+				if p.Cmp(q) < 0 {
+					p, q = q, p
+				}
+				return p, q, nil
+			}
+			if y.Cmp(nm1) == 0 {
+				break
+			}
+			x = y
+		}
+	}
+	return nil, nil, fmt.Errorf("could not factor the RSA modulus")
+}
@@ -7,6 +7,7 @@ import (
 	"math/rand"
 	"os"
 	"os/exec"
+	"strings"
 	"testing"
 )
 
@@ -107,4 +108,45 @@ func initForTesting(currentTest string) {
 	// Finally we setup the flags:
 	TestTimings = new(int)
 	TestHashes = new(bool)
+	ResetCapabilities()
+}
+
+// withBuiltins sets the tests of interf up to compare prog1 with prog2,
+// typically built-in programs, without any finding so far, and restores the
+// programs once the test is done
+func withBuiltins(t *testing.T, interf, prog1, prog2 string) {
+	initForTesting(strings.ToUpper(interf))
+	Config.Timeout = 10
+	findings.Lock()
+	findings.list = nil
+	findings.Unlock()
+	Prog1, Prog2, Interf = prog1, prog2, interf
+	t.Cleanup(func() {
+		Prog1, Prog2, Interf = "", "", ""
+		ResetCapabilities()
+	})
+}
+
+// registerBuiltin registers run as the built-in program name, with the
+// interface and capabilities of the base one, for the duration of the test.
+// It is meant for deliberately flawed variants of the built-in programs,
+// which the tests must report.
+func registerBuiltin(t *testing.T, name, base string, run func([]string) (string, error)) string {
+	builtins[name] = builtin{builtins[base].interf, run}
+	builtinCapabilities[name] = builtinCapabilities[base]
+	t.Cleanup(func() {
+		delete(builtins, name)
+		delete(builtinCapabilities, name)
+	})
+	return builtinPrefix + name
+}
+
+// hasFinding tells whether a finding of prog has the given message
+func hasFinding(prog, message string) bool {
+	for _, f := range Findings() {
+		if f.Message == message && len(f.Progs) > 0 && f.Progs[0] == prog {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,436 @@
+package cdf
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// Those are the possible verdicts of a Wycheproof test case
+const (
+	wycheValid      = "valid"
+	wycheInvalid    = "invalid"
+	wycheAcceptable = "acceptable"
+)
+
+// wycheproofFile is the top-level structure of a Wycheproof test vectors file.
+type wycheproofFile struct {
+	Algorithm     string            `json:"algorithm"`
+	NumberOfTests int               `json:"numberOfTests"`
+	Header        []string          `json:"header"`
+	Notes         map[string]string `json:"notes"`
+	TestGroups    []wycheproofGroup `json:"testGroups"`
+}
+
+// wycheproofKey holds the key material of a test group, which depends on its
+// type. Both the legacy (key, n, e, d) and the current (publicKey,
+// privateKey) layouts are supported.
+type wycheproofKey struct {
+	Type  string `json:"type,omitempty"`
+	Curve string `json:"curve,omitempty"`
+	Wx    string `json:"wx,omitempty"`
+	Wy    string `json:"wy,omitempty"`
+	P     string `json:"p,omitempty"`
+	Q     string `json:"q,omitempty"`
+	G     string `json:"g,omitempty"`
+	Y     string `json:"y,omitempty"`
+	// RSA keys
+	Modulus         string `json:"modulus,omitempty"`
+	PublicExponent  string `json:"publicExponent,omitempty"`
+	PrivateExponent string `json:"privateExponent,omitempty"`
+	Prime1          string `json:"prime1,omitempty"`
+	Prime2          string `json:"prime2,omitempty"`
+}
+
+// wycheproofGroup is a group of test cases sharing the same type and key.
+type wycheproofGroup struct {
+	Type       string           `json:"type"`
+	Sha        string           `json:"sha,omitempty"`
+	MgfSha     string           `json:"mgfSha,omitempty"`
+	KeySize    int              `json:"keySize,omitempty"`
+	IvSize     int              `json:"ivSize,omitempty"`
+	TagSize    int              `json:"tagSize,omitempty"`
+	Key        *wycheproofKey   `json:"key,omitempty"`
+	PublicKey  *wycheproofKey   `json:"publicKey,omitempty"`
+	PrivateKey *wycheproofKey   `json:"privateKey,omitempty"`
+	N          string           `json:"n,omitempty"`
+	E          string           `json:"e,omitempty"`
+	D          string           `json:"d,omitempty"`
+	Tests      []wycheproofTest `json:"tests"`
+}
+
+// wycheproofTest is a single test case with its expected verdict.
+type wycheproofTest struct {
+	TcID    int      `json:"tcId"`
+	Comment string   `json:"comment"`
+	Key     string   `json:"key,omitempty"`
+	Iv      string   `json:"iv,omitempty"`
+	Msg     string   `json:"msg"`
+	Ct      string   `json:"ct,omitempty"`
+	Label   string   `json:"label,omitempty"`
+	Sig     string   `json:"sig,omitempty"`
+	Tag     string   `json:"tag,omitempty"`
+	Result  string   `json:"result"`
+	Flags   []string `json:"flags"`
+}
+
+// wycheproofCase is a test case mapped onto a cdf interface: the arguments to
+// run the program with and how to tell whether it accepted the input.
+type wycheproofCase struct {
+	interf string
+	group  *wycheproofGroup
+	test   wycheproofTest
+	// hash and curve are the ones of the group, selected for the programs
+	// declaring several ones
+	hash, curve string
+	args        []string
+	// accepted interprets the program's output and error
+	accepted func(out string, err error) bool
+}
+
+// wycheproofInterfaces maps the algorithms of the Wycheproof files onto the
+// cdf interfaces. The rsaenc interface covering several of them, a program
+// must declare its algorithms to run their files. The AES ciphers are not
+// mapped, see encAlgorithm.
+var wycheproofInterfaces = map[string]string{
+	"DSA": "dsa", "ECDSA": "ecdsa", "RSASSA-PKCS1-v1_5": "rsasign",
+	"RSAES-OAEP": "rsaenc", "RSAES-PKCS1-v1_5": "rsaenc",
+	"HMACSHA1": "prf", "HMACSHA224": "prf", "HMACSHA256": "prf", "HMACSHA384": "prf", "HMACSHA512": "prf",
+	"HMACSHA3-224": "prf", "HMACSHA3-256": "prf", "HMACSHA3-384": "prf", "HMACSHA3-512": "prf",
+}
+
+// TestWycheproof runs the Wycheproof test vectors file against Prog1. The
+// file is mapped by its algorithm onto the matching cdf interface (ecdsa,
+// dsa, rsaenc, rsasign or prf) and every disagreement with the expected
+// verdict is reported, along with the key and flags of the test case. The
+// files of the algorithms Prog1 does not implement, and the vectors whose
+// inputs cannot be expressed in the cdf interfaces, or whose hash, curve or
+// key size Prog1 does not support, are skipped. The files of AES ciphers
+// are refused, the enc interface being unable to run them.
+func TestWycheproof(file string) error {
+	LogInfo.Println("running the Wycheproof test vectors from", file, "against", Prog1)
+
+	vectors, err := loadWycheproof(file)
+	if err != nil {
+		return err
+	}
+	if encAlgorithm(vectors.Algorithm) {
+		return fmt.Errorf("%s: %s unsupported by the enc interface, which is AES-CTR with a zero IV and is given no IV, nonce or AAD",
+			file, vectors.Algorithm)
+	}
+	LogInfo.Printf("%s: %d tests in %d groups\n", vectors.Algorithm,
+		vectors.NumberOfTests, len(vectors.TestGroups))
+
+	var cases []wycheproofCase
+	skipped := make(map[string]int)
+	interf, reason := algorithmSupport(Prog1, vectors.Algorithm)
+	if reason != "" {
+		skipped[reason] = vectors.NumberOfTests
+		vectors.TestGroups = nil
+	}
+	for i := range vectors.TestGroups {
+		group := &vectors.TestGroups[i]
+		if reason := group.support(); reason != "" {
+			skipped[reason] += len(group.Tests)
+			continue
+		}
+		for _, test := range group.Tests {
+			c, err := wycheproofToCase(group, test)
+			if err == nil && c.interf != interf {
+				err = fmt.Errorf("test group type %s does not match the %s algorithm", group.Type, vectors.Algorithm)
+			}
+			if err != nil {
+				skipped[err.Error()]++
+				continue
+			}
+			c.hash, c.curve = group.hash(vectors.Algorithm), group.publicKey().Curve
+			cases = append(cases, c)
+		}
+	}
+
+	TermPrepareFor(1)
+	verdicts := make([]bool, len(cases))
+	mainErr := MultiError{}
+	// the groups of each hash and curve are run with them selected
+	params := func(i int) (string, string) { return cases[i].hash, cases[i].curve }
+	for _, batch := range vectorBatches(len(cases), params) {
+		batch.run(func() {
+			jobs := newJobGroup("wycheproof", len(batch.indices))
+			for _, i := range batch.indices {
+				i, c := i, cases[i]
+				jobs.Go(func() error {
+					id := fmt.Sprintf("wycheproof#%s#%d", c.interf, c.test.TcID)
+					out, err := runProg(Prog1, id, c.args)
+					if isHang(err) {
+						return err
+					}
+					verdicts[i] = c.accepted(out, err)
+					return nil
+				})
+			}
+			if err := jobs.Wait(); err != nil {
+				mainErr = append(mainErr, err.(MultiError)...)
+			}
+		})
+	}
+	fmt.Print("\n")
+
+	passed, acceptable := 0, 0
+	for i, c := range cases {
+		expected := c.test.Result
+		switch {
+		case expected == wycheAcceptable:
+			acceptable++
+			LogToFile.Printf("tcId %d is acceptable, %s accepted it: %v", c.test.TcID, Prog1, verdicts[i])
+		case (expected == wycheValid) == verdicts[i]:
+			passed++
+		default:
+			got := "rejected"
+			if verdicts[i] {
+				got = "accepted"
+			}
+			msg := fmt.Sprintf("tcId %d (%s): expected %s, %s %s it, flags %v",
+				c.test.TcID, c.test.Comment, expected, Prog1, got, c.test.Flags)
+			LogWarning.Printf("%s\n\tkey: %s\n\targs: %v\n", msg, c.group.describeKey(), c.args)
+			addFinding(Finding{Test: "wycheproof." + c.interf, Progs: []string{Prog1},
+				Inputs: c.args, Message: msg, Interf: c.interf, Hash: c.hash, Curve: c.curve})
+			mainErr = append(mainErr, errors.New(msg))
+		}
+	}
+
+	LogInfo.Printf("%d / %d tests passed, %d acceptable ones, %d disagreements\n",
+		passed, len(cases), acceptable, len(cases)-passed-acceptable)
+	for reason, n := range skipped {
+		LogInfo.Printf("%d tests skipped: %s\n", n, reason)
+	}
+	if len(mainErr) > 0 {
+		return mainErr
+	}
+	return nil
+}
+
+// loadWycheproof parses a Wycheproof test vectors file
+func loadWycheproof(file string) (*wycheproofFile, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var vectors wycheproofFile
+	if err := json.NewDecoder(f).Decode(&vectors); err != nil {
+		return nil, fmt.Errorf("invalid Wycheproof file %s: %v", file, err)
+	}
+	return &vectors, nil
+}
+
+// algorithmSupport returns the interface of the Wycheproof algorithm, and
+// tells why prog cannot run its files, or returns an empty string. A program
+// declaring no algorithm runs the ones its interface determines, HMAC being
+// computed with the hash of config.json unless it declares others.
+func algorithmSupport(prog, algorithm string) (string, string) {
+	interf, ok := wycheproofInterfaces[algorithm]
+	if !ok {
+		return "", fmt.Sprintf("algorithm %s has no matching interface", algorithm)
+	}
+	c := ProgramCapabilities(prog)
+	if len(c.Algorithms) > 0 {
+		if !containsName(c.Algorithms, algorithm, strings.ToUpper) {
+			return interf, fmt.Sprintf("algorithm %s not supported by %s", algorithm, prog)
+		}
+		return interf, ""
+	}
+	switch {
+	case interf == "rsaenc":
+		return interf, fmt.Sprintf("algorithm %s not declared by %s, the %s interface covering several ones",
+			algorithm, prog, interf)
+	case interf == "prf":
+		hash := hmacHash(algorithm)
+		if len(c.Hashes) == 0 {
+			c.Hashes = []string{hashName()}
+		}
+		if !c.SupportsHash(hash) {
+			return interf, fmt.Sprintf("hash %s not supported by %s", hash, prog)
+		}
+	}
+	return interf, ""
+}
+
+// encAlgorithm tells whether the Wycheproof algorithm is an AES cipher, such
+// as AES-GCM or AES-CBC-PKCS5, whose vectors have a keystream differing from
+// the one of AES-CTR with a zero IV even with a zero IV or nonce, so that the
+// enc interface cannot run any of them
+func encAlgorithm(algorithm string) bool {
+	return strings.HasPrefix(algorithm, "AES-") && !strings.HasSuffix(algorithm, "MAC")
+}
+
+// hmacHash returns the hash of an HMAC algorithm, as named in signatureHashes
+func hmacHash(algorithm string) string {
+	name := strings.TrimPrefix(algorithm, "HMAC")
+	for _, hash := range signatureHashes {
+		if (Capabilities{Hashes: []string{hash}}).SupportsHash(name) {
+			return hash
+		}
+	}
+	return name
+}
+
+// hash returns the hash the tests of the group are run with, if any: the one
+// of the group, or of the HMAC algorithm of the file
+func (g *wycheproofGroup) hash(algorithm string) string {
+	if g.Sha == "" && strings.HasPrefix(algorithm, "HMAC") {
+		return hmacHash(algorithm)
+	}
+	return g.Sha
+}
+
+// publicKey returns the public key of the group, whatever the file layout
+func (g *wycheproofGroup) publicKey() *wycheproofKey {
+	if g.PublicKey != nil {
+		return g.PublicKey
+	}
+	if g.Key != nil {
+		return g.Key
+	}
+	return &wycheproofKey{}
+}
+
+// rsaKey returns the modulus and exponents of an RSA group, whatever the file
+// layout, the private exponent being empty for public keys.
+func (g *wycheproofGroup) rsaKey() (n, e, d string) {
+	n, e, d = g.N, g.E, g.D
+	if g.PrivateKey != nil {
+		n, e, d = g.PrivateKey.Modulus, g.PrivateKey.PublicExponent, g.PrivateKey.PrivateExponent
+	} else if g.PublicKey != nil && g.PublicKey.Modulus != "" {
+		n, e = g.PublicKey.Modulus, g.PublicKey.PublicExponent
+	}
+	return
+}
+
+// support tells why Prog1 cannot run the tests of the group, given its hash,
+// curve and RSA key size, or returns an empty string
+func (g *wycheproofGroup) support() string {
+	keySize := 0
+	if strings.HasPrefix(g.Type, "Rsa") {
+		keySize = g.KeySize
+	}
+	return vectorSupport(Prog1, g.Sha, g.publicKey().Curve, keySize)
+}
+
+// describeKey summarises the key of the group for reporting purposes
+func (g *wycheproofGroup) describeKey() string {
+	k := g.publicKey()
+	switch {
+	case k.Wx != "":
+		return fmt.Sprintf("curve %s, x=%s, y=%s", k.Curve, k.Wx, k.Wy)
+	case k.P != "":
+		return fmt.Sprintf("p=%s, q=%s, g=%s, y=%s", k.P, k.Q, k.G, k.Y)
+	}
+	if n, e, _ := g.rsaKey(); n != "" {
+		return fmt.Sprintf("n=%s, e=%s", n, e)
+	}
+	return fmt.Sprintf("%d-bit key given per test", g.KeySize)
+}
+
+// wycheproofToCase maps a test case of the given group onto the matching cdf
+// interface. Its error tells why the case cannot be run.
+func wycheproofToCase(g *wycheproofGroup, t wycheproofTest) (wycheproofCase, error) {
+	c := wycheproofCase{group: g, test: t}
+	verified := func(out string, err error) bool { return err == nil && out == trueStr }
+
+	switch g.Type {
+	case "EcdsaVerify", "DsaVerify":
+		r, s, err := parseDERSignature(t.Sig)
+		if err != nil {
+			return c, fmt.Errorf("signature not representable as r and s: %v", err)
+		}
+		k := g.publicKey()
+		if g.Type == "EcdsaVerify" {
+			c.interf = "ecdsa"
+			c.args = []string{k.Wx, k.Wy, r.Text(16), s.Text(16), t.Msg}
+		} else {
+			c.interf = "dsa"
+			c.args = []string{k.P, k.Q, k.G, k.Y, r.Text(16), s.Text(16), t.Msg}
+		}
+		c.accepted = verified
+	case "RsassaPkcs1Verify":
+		n, e, _ := g.rsaKey()
+		if t.Sig == "" {
+			return c, errors.New("empty signature")
+		}
+		c.interf = "rsasign"
+		c.args = []string{n, e, t.Sig, t.Msg}
+		c.accepted = verified
+	case "RsaesOaepDecrypt", "RsaesPkcs1Decrypt":
+		if t.Label != "" {
+			return c, errors.New("OAEP label not supported by the rsaenc interface")
+		}
+		n, e, d := g.rsaKey()
+		if !isHex(n) || !isHex(e) || !isHex(d) {
+			return c, errors.New("no private key in the test group")
+		}
+		p, q, err := factorModulus(fromBase16(n), fromBase16(e), fromBase16(d))
+		if err != nil {
+			return c, err
+		}
+		c.interf = "rsaenc"
+		c.args = []string{p.Text(16), q.Text(16), e, d, t.Ct}
+		msg := strings.ToLower(t.Msg)
+		c.accepted = func(out string, err error) bool {
+			// an invalid ciphertext is accepted if it decrypts at all, a valid
+			// one if it decrypts to the right message
+			return err == nil && (t.Result != wycheValid || out == msg)
+		}
+	case "MacTest":
+		if t.Key == "" {
+			return c, errors.New("empty MAC key")
+		}
+		c.interf = "prf"
+		c.args = []string{t.Key, t.Msg}
+		tag := strings.ToLower(t.Tag)
+		// the tags may be truncated, in which case we compare the prefixes
+		c.accepted = func(out string, err error) bool {
+			return err == nil && tag != "" && strings.HasPrefix(out, tag)
+		}
+	default:
+		return c, fmt.Errorf("test group type %s has no matching interface", g.Type)
+	}
+	return c, nil
+}
+
+// derSignature is the ASN.1 structure of DSA and ECDSA signatures
+type derSignature struct {
+	R, S *big.Int
+}
+
+// parseDERSignature decodes a hex encoded DER signature into r and s. Since
+// encoding/asn1 accepts some BER encodings, the signature is re-encoded to
+// make sure it was strict DER.
+func parseDERSignature(sig string) (r, s *big.Int, err error) {
+	raw, ok := new(big.Int).SetString(sig, 16)
+	if !ok || len(sig)%2 != 0 {
+		return nil, nil, errors.New("invalid hex signature")
+	}
+	der := leftPad(raw.Bytes(), len(sig)/2)
+
+	var ds derSignature
+	rest, err := asn1.Unmarshal(der, &ds)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rest) > 0 {
+		return nil, nil, errors.New("trailing data after the signature")
+	}
+	if reenc, err := asn1.Marshal(ds); err != nil || !bytes.Equal(reenc, der) {
+		return nil, nil, errors.New("signature is not DER encoded")
+	}
+	if ds.R.Sign() < 0 || ds.S.Sign() < 0 {
+		return nil, nil, errors.New("negative integer in signature")
+	}
+	return ds.R, ds.S, nil
+}
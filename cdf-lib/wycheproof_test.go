@@ -0,0 +1,230 @@
+package cdf
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseDERSignature(t *testing.T) {
+	cases := []struct {
+		sig   string
+		valid bool
+	}{
+		{"3006020101020102", true},
+		// r is encoded with an unnecessary leading zero
+		{"300702020001020102", false},
+		// trailing data after the sequence
+		{"300602010102010200", false},
+		// negative s
+		{"30060201010201ff", false},
+		// long form length for a short sequence
+		{"30810602010102010200", false},
+		{"30", false},
+		{"zz", false},
+	}
+	for _, c := range cases {
+		r, s, err := parseDERSignature(c.sig)
+		if (err == nil) != c.valid {
+			t.Errorf("%s: expected validity %v, got error %v", c.sig, c.valid, err)
+		}
+		if c.valid && (r.Int64() != 1 || s.Int64() != 2) {
+			t.Errorf("%s: expected r=1 and s=2, got %v and %v", c.sig, r, s)
+		}
+	}
+}
+
+func TestFactorModulus(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, q, err := factorModulus(key.N, big.NewInt(int64(key.E)), key.D)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Cmp(q) <= 0 {
+		t.Error("Expected p > q")
+	}
+	for _, prime := range key.Primes {
+		if prime.Cmp(p) != 0 && prime.Cmp(q) != 0 {
+			t.Error("Recovered wrong factors:", p, q)
+		}
+	}
+}
+
+func TestWycheproofToCase(t *testing.T) {
+	group := &wycheproofGroup{Type: "EcdsaVerify",
+		Key: &wycheproofKey{Curve: "secp256r1", Wx: "0a", Wy: "0b"}}
+	c, err := wycheproofToCase(group, wycheproofTest{TcID: 1, Msg: "00", Sig: "3006020101020102"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"0a", "0b", "1", "2", "00"}
+	if c.interf != "ecdsa" || len(c.args) != len(expected) {
+		t.Fatalf("Unexpected case %s %v", c.interf, c.args)
+	}
+	for i := range expected {
+		if c.args[i] != expected[i] {
+			t.Errorf("Expected argument %d to be %s, got %s", i, expected[i], c.args[i])
+		}
+	}
+	if !c.accepted(trueStr, nil) || c.accepted("false", nil) {
+		t.Error("Wrong interpretation of the verification output")
+	}
+
+	// truncated tags are compared on their prefix
+	group = &wycheproofGroup{Type: "MacTest"}
+	c, err = wycheproofToCase(group, wycheproofTest{Key: "00", Msg: "", Tag: "ABCD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.accepted("abcdef", nil) || c.accepted("abce", nil) {
+		t.Error("Wrong interpretation of the MAC output")
+	}
+
+	unsupported := []struct {
+		group *wycheproofGroup
+		test  wycheproofTest
+	}{
+		{&wycheproofGroup{Type: "AeadTest"}, wycheproofTest{}},
+		{&wycheproofGroup{Type: "IndCpaTest"}, wycheproofTest{Key: "00", Iv: "00"}},
+		{&wycheproofGroup{Type: "RsaesOaepDecrypt"}, wycheproofTest{Label: "00"}},
+		{&wycheproofGroup{Type: "DsaVerify", Key: &wycheproofKey{}}, wycheproofTest{Sig: "300702020001020102"}},
+	}
+	for _, u := range unsupported {
+		if _, err := wycheproofToCase(u.group, u.test); err == nil {
+			t.Errorf("Expected %s case %+v to be skipped", u.group.Type, u.test)
+		}
+	}
+}
+
+func TestAlgorithmSupport(t *testing.T) {
+	initForTesting("RSA")
+	defer func() { Config.Capabilities = nil }()
+	Config.Capabilities = map[string]Capabilities{"prf": {}, "rsaenc": {}}
+	Config.Hash = "SHA-512"
+	defer func() { Config.Hash = "" }()
+
+	cases := []struct {
+		prog, algorithm, interf string
+		supported               bool
+	}{
+		{"builtin:hmac-sha256", "HMACSHA256", "prf", true},
+		{"builtin:hmac-sha256", "HMACSHA512", "prf", false},
+		{"builtin:hmac-sha256", "AES-CMAC", "", false},
+		// undeclared, HMAC is computed with the hash of config.json
+		{"prf", "HMACSHA512", "prf", true},
+		{"prf", "HMACSHA256", "prf", false},
+		{"builtin:rsa-oaep-sha256", "RSAES-OAEP", "rsaenc", true},
+		{"builtin:rsa-oaep-sha256", "RSAES-PKCS1-v1_5", "rsaenc", false},
+		// undeclared, the rsaenc interface does not tell OAEP from PKCS 1.5
+		{"rsaenc", "RSAES-OAEP", "rsaenc", false},
+		{"builtin:ecdsa-p256-sha256", "ECDSA", "ecdsa", true},
+		// the enc interface cannot be given the IVs of the AES files
+		{"builtin:aes-ctr", "AES-GCM", "", false},
+		{"builtin:aes-ctr", "AES-CBC-PKCS5", "", false},
+	}
+	for _, c := range cases {
+		interf, reason := algorithmSupport(c.prog, c.algorithm)
+		if interf != c.interf || (reason == "") != c.supported {
+			t.Errorf("%s on %s: expected %q and support %v, got %q (%s)",
+				c.prog, c.algorithm, c.interf, c.supported, interf, reason)
+		}
+	}
+}
+
+// ecdsaWycheproofFile writes a Wycheproof file with a group of the given
+// curve and hash, whose first test is a valid signature and the second one an
+// invalid one
+func ecdsaWycheproofFile(t *testing.T, curveName, hash string) string {
+	curve, _ := curveByName(curveName)
+	d := randomScalar(Prng, curve.n)
+	x, y := curve.baseMult(d)
+	saved := Config.Hash
+	Config.Hash = hash
+	hashed, _ := digest("deadc0de")
+	Config.Hash = saved
+	r, s, err := curve.sign(d, hashed, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, _ := derSignatureHex(r, s)
+	vectors := wycheproofFile{Algorithm: "ECDSA", NumberOfTests: 2, TestGroups: []wycheproofGroup{{
+		Type: "EcdsaVerify", Sha: hash, Key: &wycheproofKey{Curve: curveName, Wx: x.Text(16), Wy: y.Text(16)},
+		Tests: []wycheproofTest{{TcID: 1, Msg: "deadc0de", Sig: sig, Result: wycheValid},
+			{TcID: 2, Msg: "deadc0df", Sig: sig, Result: wycheInvalid}}}}}
+	data, _ := json.Marshal(vectors)
+	file := filepath.Join(t.TempDir(), "ecdsa_test.json")
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestWycheproofHash(t *testing.T) {
+	initForTesting("ECDSA")
+	Config.Timeout = 10
+	defer func() { Prog1 = "" }()
+	findings.Lock()
+	findings.list = nil
+	findings.Unlock()
+
+	// the built-in program declares several hashes, it is given the one of
+	// the group with -H
+	Prog1 = "builtin:ecdsa-p256-sha256"
+	if err := TestWycheproof(ecdsaWycheproofFile(t, "secp256r1", "SHA-384")); err != nil {
+		t.Error("Expected the SHA-384 group to pass, got", err)
+	}
+	if Config.Hash != "" || len(selectedArgs(Prog1)) != 0 {
+		t.Errorf("Expected the previous hash to be selected again, got %q %v", Config.Hash, selectedArgs(Prog1))
+	}
+}
+
+func TestWycheproofCurve(t *testing.T) {
+	initForTesting("ECDSA")
+	Config.Timeout = 10
+	defer func() { Prog1 = "" }()
+	findings.Lock()
+	findings.list = nil
+	findings.Unlock()
+
+	// the built-in program declares several curves, it is given the one of
+	// the group with -C
+	Prog1 = "builtin:ecdsa-p256-sha256"
+	for _, name := range []string{"secp384r1", "secp224k1", "brainpoolP320r1"} {
+		if err := TestWycheproof(ecdsaWycheproofFile(t, name, "SHA-256")); err != nil {
+			t.Errorf("Expected the %s group to pass, got %v", name, err)
+		}
+	}
+	if len(selectedArgs(Prog1)) != 0 || selectedCurve() != "" {
+		t.Errorf("Expected no curve to be selected afterwards, got %v", selectedArgs(Prog1))
+	}
+}
+
+func TestWycheproofAES(t *testing.T) {
+	initForTesting("ENC")
+	defer func() { Prog1 = "" }()
+
+	// the AES files are refused, not skipped
+	Prog1 = "builtin:aes-ctr"
+	for _, algorithm := range []string{"AES-GCM", "AES-CBC-PKCS5"} {
+		data, _ := json.Marshal(wycheproofFile{Algorithm: algorithm, NumberOfTests: 1,
+			TestGroups: []wycheproofGroup{{Type: "AeadTest", Tests: []wycheproofTest{{TcID: 1, Key: "00", Iv: "00"}}}}})
+		file := filepath.Join(t.TempDir(), "aes_test.json")
+		if err := os.WriteFile(file, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := TestWycheproof(file); err == nil || !strings.Contains(err.Error(), "unsupported by the enc interface") {
+			t.Errorf("Expected the %s file to be refused, got %v", algorithm, err)
+		}
+	}
+	if encAlgorithm("AES-CMAC") {
+		t.Error("AES-CMAC is not an enc algorithm")
+	}
+}
@@ -12,44 +12,98 @@ import (
 func TestXof() error {
 	LogInfo.Print("testing xof")
 
+	// calibrating the timeouts on a short and a long message
+	for _, prog := range []string{Prog1, Prog2} {
+		calibrateTimeout(prog,
+			[]string{warmupMsg(Config.MinMsgLen)},
+			[]string{warmupMsg(Config.MaxMsgLen)})
+	}
+
 	failed := false
 
 	msg := randomHex(Config.MaxMsgLen)
 
-	// list of hashes
-	hashes := make(map[string]int)
-
-	LogInfo.Println("testing message lengths")
-
-	for i := Config.MinMsgLen; i <= Config.MaxMsgLen; i += Config.IncrementMsg {
+	if subTest("xof.msgLen") {
+		// list of hashes
+		hashes := make(map[string]int)
 
-		TermPrintInline(1, "%d / %d", i, Config.MaxMsgLen)
-		id := fmt.Sprintf("xof#msglen#%d", i)
-		// get the first i bytes, ie first i*2 nibbles
-		outStr1 := runOrExitOnErr(Prog1, id, msg[:(i*2)])
-		outStr2 := runOrExitOnErr(Prog2, id, msg[:(i*2)])
+		LogInfo.Println("testing message lengths")
+		TermPrepareFor(1)
 
-		if length, ok := hashes[outStr1]; ok {
-			fmt.Print("\n")
-			LogWarning.Printf("same hash for %d and %d", length, i)
+		var lengths []int
+		for i := Config.MinMsgLen; i <= Config.MaxMsgLen; i += Config.IncrementMsg {
+			lengths = append(lengths, i)
+		}
+		outs1 := make([]string, len(lengths))
+		outs2 := make([]string, len(lengths))
+		ran := make([]bool, len(lengths))
+		jobs := newJobGroup("xof message lengths", len(lengths))
+		for j, i := range lengths {
+			j, i := j, i
+			jobs.Go(func() (err error) {
+				id := fmt.Sprintf("xof#msglen#%d", i)
+				// get the first i bytes, ie first i*2 nibbles
+				if outs1[j], err = runOrClassify("xof", Prog1, id, msg[:(i*2)]); err != nil {
+					return err
+				}
+				if outs2[j], err = runOrClassify("xof", Prog2, id, msg[:(i*2)]); err != nil {
+					return err
+				}
+				ran[j] = true
+				return nil
+			})
+		}
+		if err := jobs.Wait(); err != nil {
+			LogWarning.Println(err)
 			failed = true
-		} else {
-			hashes[outStr1] = i
 		}
 
-		if outStr1 != outStr2 {
-			fmt.Print("\n")
-			LogWarning.Printf("mismatch on length %d\nGot:\n\t%s\n\t%s", i, outStr1, outStr2)
-			failed = true
-			if length, ok := hashes[outStr2]; ok {
+		// the outputs are then checked in order, but for the failed runs
+		// already reported
+		for j, i := range lengths {
+			if !ran[j] {
+				continue
+			}
+			outStr1, outStr2 := outs1[j], outs2[j]
+
+			if length, ok := hashes[outStr1]; ok {
+				fmt.Print("\n")
 				LogWarning.Printf("same hash for %d and %d", length, i)
 				failed = true
 			} else {
-				hashes[outStr2] = i
+				hashes[outStr1] = i
+			}
+
+			if outStr1 != outStr2 {
+				// we rerun the failing case to see whether it reproduces
+				id := fmt.Sprintf("xof#msglen#%d", i)
+				class := classifyFailure(func() (bool, error) {
+					return rerunMatch(id, []string{msg[:(i * 2)]})
+				})
+				addFinding(Finding{Test: "xof", Progs: []string{Prog1, Prog2},
+					Inputs: []string{msg[:(i * 2)]}, Message: "hash mismatch", Class: class.String()})
+				fmt.Print("\n")
+				LogWarning.Printf("mismatch on length %d, %v\nGot:\n\t%s\n\t%s", i, class, outStr1, outStr2)
+				failed = true
+				if length, ok := hashes[outStr2]; ok {
+					LogWarning.Printf("same hash for %d and %d", length, i)
+					failed = true
+				} else {
+					hashes[outStr2] = i
+				}
 			}
 		}
 	}
 
+	if subTest("xof.properties") {
+		if err := testProperties(
+			propertyCheck{prog: Prog1, op: "hashing", args: []string{msg}},
+			propertyCheck{prog: Prog2, op: "hashing", args: []string{msg}}); err != nil {
+			failed = true
+			LogError.Println("while testing determinism:", err)
+		}
+	}
+
 	if failed {
 		fmt.Print("\n")
 		return errors.New("one of more tests failed")
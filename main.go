@@ -7,90 +7,330 @@ import (
 	"log"
 	"math/rand"
 	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
 
 	"github.com/kudelskisecurity/cdf/cdf-lib"
 )
 
 var interf string
-var interfaces = map[string]bool{
-	//"aenc":  true,
-	"dsa":     true,
-	"enc":     true,
-	"ecdsa":   true,
-	"ecdh":    true,
-	"rsaenc":  true,
-	"rsasign": true,
-	"prf":     true,
-	"xof":     true,
+
+// vectorsFormat and vectorsFile are set when running test vectors instead of
+// comparing two programs
+var vectorsFormat, vectorsFile, vectorsSection string
+var vectorsFormats = map[string]bool{
+	"wycheproof": true,
+	"cavp":       true,
+}
+
+// findingsFile is the file the findings of a run are saved to, to replay them
+var findingsFile *string
+
+// a command is one of cdf's subcommands, taking its own flags and arguments
+type command struct {
+	args string
+	desc string
+	run  func(args []string)
+}
+
+var commands map[string]command
+
+func init() {
+	// the map refers to the functions using it through usage()
+	commands = map[string]command{
+		"run":          {"[-t N] [-h] [-v] [-only tests] [-skip tests] [-export file] [-export-all] [-findings file] interface prog1 prog2", "compare two programs implementing the interface", runCmd},
+		"list":         {"", "show the interfaces, their programs' i/o and their tests", listCmd},
+		"vectors":      {"[-h] [-v] [-export file] [-findings file] wycheproof|cavp file prog [section]", "run test vectors against a program", vectorsCmd},
+		"replay":       {"[-prog path] [-n index] findings.json", "run the programs of saved findings again on their inputs", replayCmd},
+		"check-config": {"interface", "check config.json and its keys for the interface", checkConfigCmd},
+		"doctor":       {"[-h] [-role 1|2] interface prog", "check that a program follows the i/o of the interface", doctorCmd},
+	}
+	// the lib dereferences those flags, which are not set by all commands
+	cdf.TestTimings = new(int)
+	cdf.TestHashes = new(bool)
+	cdf.ForceVerbose = new(bool)
+	cdf.ExportFile = new(string)
+	cdf.ExportAll = new(bool)
+	findingsFile = new(string)
 }
 
 // usage() is called when the input doesn't seem to match an accepted pattern, it also serves as help display
 func usage() {
-	flag.Usage()
-	fmt.Println("To perform the tests: \ncdf interface path/to/program1 path/to/program2")
-	fmt.Println("Interfaces and their programs' i/o:")
-	fmt.Println("\tecdsa\t[privkey msg -> sig] [pubkey sig msg -> validity]")
-	fmt.Println("\tenc\t[key plaintext -> ciphertext] [key ciphertext -> plaintext]")
-	fmt.Println("\tdsa\t[privkey msg -> sig] [pubkey msg sig -> validity]")
-	fmt.Println("\tprf\t[key msg -> tag] [key msg -> tag]")
-	fmt.Println("\trsaenc\t[pubkey plaintext -> ciphertext] [privkey ciphertext -> plaintext]")
-	fmt.Println("\trsasign\t[privkey msg -> sign] [pubkey sign msg -> validity]")
-	fmt.Println("\txof\t[message -> hash] [message -> hash]")
-}
-
-// init() is a function to handle flags initialization and parsing. It will initialize our flags to parse the Args data, must be done before using flag.Args(). It also perform basic existence checks on the provided program path. If something is missing, it falls back to usage() which will exit gracefully.
-func init() {
-	// the -t n flag allows to run n timing tests using the dudect method.
-	cdf.TestTimings = flag.Int("t", 0, "to perform N timing leak tests, specify N. It may take hours.")
+	fmt.Println("Usage: cdf command [flags] [arguments]")
+	fmt.Println("Commands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("\t%s %s\n\t\t%s\n", name, commands[name].args, commands[name].desc)
+	}
+	fmt.Println("The former invocation, cdf [flags] interface prog1 prog2, is the one of run.")
+	fmt.Println("Use cdf list to show the interfaces and their programs' i/o.")
+}
+
+// newFlagSet returns the flag set of a command, which displays the usage on error
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Printf("Usage: cdf %s %s\n", name, commands[name].args)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// addRunFlags adds the flags shared by the commands running tests
+func addRunFlags(flags *flag.FlagSet) {
 	// the -h flag can be used to specify that the provided programs both support the optional -h flag
-	cdf.TestHashes = flag.Bool("h", false, "specify that the provided programs both support the optional -h flag.")
+	flags.BoolVar(cdf.TestHashes, "h", false, "specify that the provided programs support the optional -h flag, unless they declare their capabilities.")
 	// the -v flag can be used to force verbose logging
-	cdf.ForceVerbose = flag.Bool("v", false, "force the VerboseLog option to true.")
+	flags.BoolVar(cdf.ForceVerbose, "v", false, "force the VerboseLog option to true.")
+	// the -export file flag allows to export the findings as Wycheproof test vectors
+	flags.StringVar(cdf.ExportFile, "export", "", "export the findings as Wycheproof test vectors to the given file.")
+	// the -export-all flag exports all the generated cases, not only the findings
+	flags.BoolVar(cdf.ExportAll, "export-all", false, "export all the generated cases along with the findings.")
+	// the -findings file flag saves the findings, to replay them later on
+	flags.StringVar(findingsFile, "findings", "", "save the findings to the given file, to replay them.")
+}
+
+func main() {
+	args := os.Args[1:]
+	name := "run"
+	if len(args) > 0 {
+		if _, ok := commands[args[0]]; ok {
+			name, args = args[0], args[1:]
+		} else if args[0] == "help" || args[0] == "-help" || args[0] == "--help" {
+			usage()
+			return
+		}
+	}
+	commands[name].run(args)
+}
+
+// runCmd compares two programs implementing an interface, it also handles the
+// flags and performs basic existence checks on the provided program paths.
+// If something is missing, it falls back to usage() which will exit
+// gracefully.
+func runCmd(args []string) {
+	flags := newFlagSet("run")
+	// the -t n flag allows to run n timing tests using the dudect method.
+	flags.IntVar(cdf.TestTimings, "t", 0, "to perform N timing leak tests, specify N. It may take hours.")
+	// the -only and -skip flags select the sub-tests to run, as named by cdf list
+	only := flags.String("only", "", "only run the given comma-separated sub-tests, e.g. rsaenc.maxExponent.")
+	skip := flags.String("skip", "", "skip the given comma-separated sub-tests, e.g. ecdsa.hashLen.")
+	addRunFlags(flags)
+	flags.Parse(args)
 
-	flag.Parse()
 	// check that we've three arguments left
-	nbArgs := len(flag.Args())
-	if nbArgs != 3 {
+	if flags.NArg() != 3 {
 		usage()
 		os.Exit(1)
 	}
-
-	if _, ok := interfaces[flag.Arg(0)]; ok {
-		interf = flag.Arg(0)
+	if _, ok := cdf.LookupInterface(flags.Arg(0)); ok {
+		interf = flags.Arg(0)
+		cdf.Interf = interf
 	} else {
 		log.Fatalln("invalid interface")
 	}
+	if err := cdf.SelectSubTests(interf, strings.Split(*only, ","), strings.Split(*skip, ",")); err != nil {
+		log.Fatalln(err)
+	}
+
+	// get programs' paths, check existence unless they are built-in ones
+	cdf.Prog1 = flags.Arg(1)
+	cdf.Prog2 = flags.Arg(2)
+	for _, prog := range []string{cdf.Prog1, cdf.Prog2} {
+		if err := cdf.CheckProgram(prog); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	runTests()
+}
+
+// vectorsCmd checks the arguments of the vectors mode: the format of the
+// test vectors, their file and the program to run them against. CAVP files
+// may be restricted to the sections containing a given string.
+func vectorsCmd(args []string) {
+	flags := newFlagSet("vectors")
+	addRunFlags(flags)
+	flags.Parse(args)
 
-	// get programs' paths, check existence
-	cdf.Prog1 = flag.Arg(1)
-	cdf.Prog2 = flag.Arg(2)
-	if _, err := os.Stat(cdf.Prog1); os.IsNotExist(err) {
-		log.Fatalln("this file doesn't exist: ", cdf.Prog1)
+	nbArgs := flags.NArg()
+	if nbArgs != 3 && !(nbArgs == 4 && flags.Arg(0) == "cavp") {
+		flags.Usage()
+		os.Exit(1)
+	}
+	if !vectorsFormats[flags.Arg(0)] {
+		log.Fatalln("invalid test vectors format:", flags.Arg(0))
 	}
-	if _, err := os.Stat(cdf.Prog2); os.IsNotExist(err) {
-		log.Fatalln("this file doesn't exist:", cdf.Prog2)
+	vectorsFormat = flags.Arg(0)
+	vectorsFile = flags.Arg(1)
+	cdf.Prog1 = flags.Arg(2)
+	vectorsSection = flags.Arg(3)
+	if _, err := os.Stat(vectorsFile); os.IsNotExist(err) {
+		log.Fatalln("this file doesn't exist:", vectorsFile)
+	}
+	if err := cdf.CheckProgram(cdf.Prog1); err != nil {
+		log.Fatalln(err)
 	}
+	runTests()
 }
 
-func main() {
-	logFile, err := os.OpenFile("log.txt", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+// listCmd shows the interfaces along with their programs' i/o, sub-tests and
+// built-in programs
+func listCmd(args []string) {
+	flags := newFlagSet("list")
+	flags.Parse(args)
+	for _, i := range cdf.Interfaces {
+		fmt.Printf("%s\t[%s] [%s]\n", i.Name, i.Prog1, i.Prog2)
+		for _, t := range i.SubTests {
+			fmt.Printf("\t%-20s %s\n", t.Name, t.Desc)
+		}
+		if builtins := cdf.Builtins(i.Name); len(builtins) > 0 {
+			fmt.Printf("\tbuilt-in programs: %s\n", strings.Join(builtins, ", "))
+		}
+	}
+}
+
+// checkConfigCmd checks config.json for the given interface, without running
+// any program
+func checkConfigCmd(args []string) {
+	flags := newFlagSet("check-config")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	defer initLog()()
+	cdf.DisableLogFile()
+
+	interf = flags.Arg(0)
+	loadConfig()
+	if err := cdf.CheckConfig(interf); err != nil {
+		cdf.LogError.Println("invalid config.json:", err)
+		os.Exit(1)
+	}
+	cdf.LogSuccess.Printf("config.json can be used to test %s\n", interf)
+}
+
+// doctorCmd probes a program against the i/o of an interface, using the
+// known answers of its built-in program, and explains what is wrong
+func doctorCmd(args []string) {
+	flags := newFlagSet("doctor")
+	flags.BoolVar(cdf.TestHashes, "h", false, "also probe the optional -h flag of the dsa and ecdsa programs.")
+	role := flags.Int("role", 0, "only probe the operation of the first (1) or of the second (2) program of the interface.")
+	flags.Parse(args)
+	if flags.NArg() != 2 || *role < 0 || *role > 2 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	defer initLog()()
+	cdf.DisableLogFile()
+
+	interf = flags.Arg(0)
+	if _, ok := cdf.LookupInterface(interf); !ok {
+		log.Fatalln("invalid interface")
+	}
+	prog := flags.Arg(1)
+	if err := cdf.CheckProgram(prog); err != nil {
+		log.Fatalln(err)
+	}
+	// the config is only needed for the keys
+	switch _, err := os.Stat("config.json"); {
+	case err == nil:
+		loadConfig()
+		if err := cdf.ValidateKeys(interf); err != nil {
+			log.Fatalln("invalid key:", err)
+		}
+	case interf == "enc" || interf == "prf" || interf == "xof":
+		cdf.Config.Timeout = 10
+	default:
+		log.Fatalln("config.json is needed for the keys of", interf)
+	}
+
+	// the DER signatures of the program are converted as when it is tested
+	cdf.Interf = interf
+	if err := cdf.Doctor(interf, prog, *role); err != nil {
+		cdf.LogError.Printf("%s does not follow the %s interface, %d problem(s) found\n", prog, interf,
+			len(err.(cdf.MultiError)))
+		os.Exit(1)
+	}
+	cdf.LogSuccess.Printf("%s follows the %s interface\n", prog, interf)
+}
+
+// replayCmd runs the programs of saved findings again on their inputs
+func replayCmd(args []string) {
+	flags := newFlagSet("replay")
+	prog := flags.String("prog", "", "replay the findings with this program instead of the recorded one.")
+	index := flags.Int("n", 0, "only replay the finding of the given index, starting from 1.")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	defer initLog()()
+	cdf.DisableLogFile()
+
+	if *prog != "" {
+		if err := cdf.CheckProgram(*prog); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	list, err := cdf.LoadFindings(flags.Arg(0))
 	if err != nil {
-		log.Fatalln("Failed to open log file:", err)
+		log.Fatalln(err)
 	}
-	// close logFile on exit checking for its error to ensure everything get written.
-	defer func() {
-		if err := logFile.Close(); err != nil {
-			panic(err)
+	if *index < 0 || *index > len(list) {
+		log.Fatalf("there are %d findings in %s\n", len(list), flags.Arg(0))
+	}
+	// the config is optional here, it only sets the timeout
+	if _, err := os.Stat("config.json"); err == nil {
+		loadConfig()
+	} else {
+		cdf.Config.Timeout = 10
+	}
+
+	replayed, failed := 0, 0
+	for i, f := range list {
+		if *index != 0 && i+1 != *index {
+			continue
 		}
-	}()
+		cdf.LogInfo.Printf("#%d\n", i+1)
+		replayed++
+		if cdf.ReplayFinding(f, *prog) != nil {
+			failed++
+		}
+	}
+	cdf.LogInfo.Printf("%d finding(s) replayed, %d failed\n", replayed, failed)
+}
 
+// initLog initialises the logs to the log file, it returns the function
+// closing it
+func initLog() func() {
+	logFile, err := os.OpenFile("log.txt", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		log.Fatalln("Failed to open log file:", err)
+	}
 	cdf.InitLog(logFile)
+	// close logFile on exit checking for its error to ensure everything get
+	// written, once since an interrupted run closes it too
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if err := logFile.Close(); err != nil {
+				panic(err)
+			}
+		})
+	}
+}
 
-	// clear the screen since we are not in usage mode
-	cdf.TermClear()
-	cdf.LogInfo.Println("Running CDF:")
-
-	// get config and show
+// loadConfig reads config.json, sets the defaults of the missing parameters
+// and loads the key files
+func loadConfig() {
 	configFile, err := os.Open("config.json")
 	if err != nil {
 		log.Fatalln(err)
@@ -108,7 +348,55 @@ func main() {
 	if cdf.Config.Timeout == 0 { // we specify a default timeout
 		cdf.Config.Timeout = 10
 	}
+	if cdf.Config.PropertyRuns == 0 { // by default each property check runs 40 times
+		cdf.Config.PropertyRuns = 40
+	}
+	if cdf.Config.Reruns == 0 { // by default failing cases are rerun 5 times
+		cdf.Config.Reruns = 5
+	}
+	if cdf.Config.Hash == "" { // the examples mostly rely on SHA-256
+		cdf.Config.Hash = "SHA-256"
+	}
+	// the keys may be given as files
+	if err := cdf.LoadKeyFiles(); err != nil {
+		log.Fatalln("while loading the key files:", err)
+	}
+}
+
+// runTests runs the tests of the run and vectors commands, once the
+// arguments are checked
+func runTests() {
+	closeLog := initLog()
+	defer closeLog()
+
+	// ensure no tested program nor its children survive us, even when we are
+	// interrupted, in which case the findings gathered so far are reported
+	defer cdf.KillRunning()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		cdf.KillRunning()
+		cdf.LogWarning.Println("interrupted, reporting the findings gathered so far")
+		reportRun()
+		closeLog()
+		os.Exit(1)
+	}()
+
+	// clear the screen now that the arguments are checked
+	cdf.TermClear()
+	cdf.LogInfo.Println("Running CDF:")
+
+	// get config, the keys must be consistent
+	loadConfig()
+	if err := cdf.ValidateKeys(interf); err != nil {
+		cdf.Fatalln("invalid key:", err)
+	}
 	cdf.LogInfo.Printf("config: %+v", cdf.Config)
+	// the tests are adapted to what the programs support
+	if err := cdf.NegotiateCapabilities(); err != nil {
+		cdf.Fatalln(err)
+	}
 
 	// disable logging if the setting is not set
 	if !cdf.Config.VerboseLog && !*cdf.ForceVerbose {
@@ -118,31 +406,31 @@ func main() {
 	var src = rand.NewSource(cdf.Config.Seed)
 	cdf.Prng = rand.New(src)
 
-	// depending on the selected interface, we run the according test function
-	switch interf {
-	case "dsa":
-		err = cdf.TestDsa()
-		break
-	case "ecdsa":
-		err = cdf.TestEcdsa()
-		break
-	case "enc":
-		err = cdf.TestEnc()
-		break
-	case "rsaenc":
-		err = cdf.TestRSAenc()
-		break
-	case "rsasign":
-		err = cdf.TestRSAsign()
-		break
-	case "prf":
-		err = cdf.TestPrf()
-		break
-	case "xof":
-		err = cdf.TestXof()
-		break
+	// the interface tests are run for each key, the one set in config.json
+	// and the generated ones
+	var err error
+	keys := cdf.TestKeys(interf)
+	switch len(keys) {
+	case 0:
+		cdf.LogWarning.Println("no key to test the programs with, on the curves they support")
+	case 1:
+		keys[0].Use()
+		err = runInterface()
+	default:
+		var errs cdf.MultiError
+		for _, key := range keys {
+			cdf.LogInfo.Println("testing with the key", key.Name)
+			key.Use()
+			if keyErr := runInterface(); keyErr != nil {
+				errs = append(errs, fmt.Errorf("with the key %s: %v", key.Name, keyErr))
+			}
+		}
+		if len(errs) > 0 {
+			err = errs
+		}
 	}
 
+	reportRun()
 	if err == nil {
 		cdf.LogSuccess.Println("test completed without error!")
 	} else {
@@ -151,3 +439,42 @@ func main() {
 
 	cdf.LogInfo.Println("exiting")
 }
+
+// reported makes sure the findings are reported once, by the end of the run
+// or its interruption
+var reported sync.Once
+
+// reportRun prints the report of the findings, and exports them and the test
+// vectors if asked to
+func reportRun() {
+	reported.Do(func() {
+		cdf.PrintReport()
+		if *cdf.ExportFile != "" {
+			if nb, err := cdf.ExportVectors(*cdf.ExportFile); err != nil {
+				cdf.LogError.Println("while exporting the test vectors:", err)
+			} else {
+				cdf.LogInfo.Printf("%d test vectors exported to %s\n", nb, *cdf.ExportFile)
+			}
+		}
+		if *findingsFile != "" {
+			if nb, err := cdf.SaveFindings(*findingsFile); err != nil {
+				cdf.LogError.Println("while saving the findings:", err)
+			} else {
+				cdf.LogInfo.Printf("%d finding(s) saved to %s\n", nb, *findingsFile)
+			}
+		}
+	})
+}
+
+// runInterface runs the tests of the selected interface
+func runInterface() error {
+	if interf == "" {
+		// we are running test vectors
+		if vectorsFormat == "cavp" {
+			return cdf.TestCAVP(vectorsFile, vectorsSection)
+		}
+		return cdf.TestWycheproof(vectorsFile)
+	}
+	i, _ := cdf.LookupInterface(interf)
+	return i.Run()
+}